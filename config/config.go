@@ -6,7 +6,10 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"task/internal/logger"
+	"task/internal/mailer"
+	"task/internal/storage"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
@@ -22,6 +25,17 @@ type Config struct {
 	Pagination  PaginationConfig
 	JwtSecret   string
 	RedisClient *redis.Client
+	AppURL      string
+	SMTP        SMTPConfig
+	Mailer      mailer.Mailer
+	Storage     storage.Storage
+
+	LoginThrottle LoginThrottleConfig
+	MFA           MFAConfig
+	OIDCProviders map[string]OIDCProviderConfig
+	Impersonation ImpersonationConfig
+	Invitation    InvitationConfig
+	ActivityLog   ActivityLogConfig
 }
 
 func getPort() string {
@@ -55,6 +69,14 @@ func getJwtSecret() string {
 	return jwtSecret
 }
 
+func getAppURL(port string) string {
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		return "http://localhost:" + port
+	}
+	return strings.TrimRight(appURL, "/")
+}
+
 func Load() *Config {
 	if err := godotenv.Load(); err != nil {
 		log.Fatalf("Error loading .env file: %v\n", err)
@@ -87,18 +109,45 @@ func Load() *Config {
 		log.Fatalf("Error connecting to Redis: %v\n", err)
 	}
 
+	port := getPort()
+
 	cfg := &Config{
-		Port:        getPort(),
+		Port:        port,
 		DatabaseUrl: getDatabaseUrl(),
 		Logger:      loggers,
 		DB:          dbConn,
 		JwtSecret:   getJwtSecret(),
 		RedisClient: redisClient,
+		AppURL:      getAppURL(port),
 	}
 	cfg.Logger = loggers
 
 	// Apply pagination config
 	cfg.LoadPaginationConfig()
 
+	// Apply mailer config
+	cfg.LoadSMTPConfig()
+
+	// Apply file storage config
+	cfg.LoadStorageConfig()
+
+	// Apply login throttling config
+	cfg.LoadLoginThrottleConfig()
+
+	// Apply two-factor authentication policy
+	cfg.LoadMFAConfig()
+
+	// Apply single sign-on providers
+	cfg.LoadOIDCConfig()
+
+	// Apply impersonation token lifetime
+	cfg.LoadImpersonationConfig()
+
+	// Apply invitation link lifetime
+	cfg.LoadInvitationConfig()
+
+	// Apply activity log queue settings
+	cfg.LoadActivityLogConfig()
+
 	return cfg
 }
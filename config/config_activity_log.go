@@ -0,0 +1,84 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultActivityLogQueueSize     = 4096
+	DefaultActivityLogBatchSize     = 200
+	DefaultActivityLogFlushInterval = time.Second
+	DefaultActivityLogBlockTimeout  = 50 * time.Millisecond
+
+	DefaultActivityLogCheckpointInterval = time.Hour
+)
+
+// What the activity log queue does with an entry when it is full
+const (
+	ActivityLogDrop  = "drop"  // Drop the entry right away
+	ActivityLogBlock = "block" // Wait up to BlockTimeout for room, then drop
+)
+
+type ActivityLogConfig struct {
+	QueueSize     int           // Entries waiting to be written before the full policy applies
+	BatchSize     int           // Entries written by a single INSERT
+	FlushInterval time.Duration // Longest time an entry waits for its batch to fill
+	FullPolicy    string        // ActivityLogDrop or ActivityLogBlock
+	BlockTimeout  time.Duration // How long a request waits for room with ActivityLogBlock
+
+	CheckpointInterval time.Duration      // How often the head of the hash chain is signed
+	SigningKey         ed25519.PrivateKey // Signs the checkpoints, nil disables them
+}
+
+func (cfg *Config) LoadActivityLogConfig() {
+	queueSize, err := strconv.Atoi(os.Getenv("ACTIVITY_LOG_QUEUE_SIZE"))
+	if err != nil || queueSize <= 0 {
+		queueSize = DefaultActivityLogQueueSize
+	}
+	cfg.ActivityLog.QueueSize = queueSize
+
+	batchSize, err := strconv.Atoi(os.Getenv("ACTIVITY_LOG_BATCH_SIZE"))
+	if err != nil || batchSize <= 0 {
+		batchSize = DefaultActivityLogBatchSize
+	}
+	cfg.ActivityLog.BatchSize = batchSize
+
+	interval, err := time.ParseDuration(os.Getenv("ACTIVITY_LOG_FLUSH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = DefaultActivityLogFlushInterval
+	}
+	cfg.ActivityLog.FlushInterval = interval
+
+	policy := os.Getenv("ACTIVITY_LOG_FULL_POLICY")
+	if policy != ActivityLogBlock {
+		policy = ActivityLogDrop
+	}
+	cfg.ActivityLog.FullPolicy = policy
+
+	timeout, err := time.ParseDuration(os.Getenv("ACTIVITY_LOG_BLOCK_TIMEOUT"))
+	if err != nil || timeout <= 0 {
+		timeout = DefaultActivityLogBlockTimeout
+	}
+	cfg.ActivityLog.BlockTimeout = timeout
+
+	checkpointInterval, err := time.ParseDuration(os.Getenv("ACTIVITY_LOG_CHECKPOINT_INTERVAL"))
+	if err != nil || checkpointInterval <= 0 {
+		checkpointInterval = DefaultActivityLogCheckpointInterval
+	}
+	cfg.ActivityLog.CheckpointInterval = checkpointInterval
+
+	// Base64 ed25519 seed, a key that is set but unusable must not silently
+	// turn the checkpoints off
+	if value := os.Getenv("ACTIVITY_LOG_SIGNING_KEY"); value != "" {
+		seed, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			log.Fatalf("ACTIVITY_LOG_SIGNING_KEY must be a base64 encoded %d byte ed25519 seed\n", ed25519.SeedSize)
+		}
+		cfg.ActivityLog.SigningKey = ed25519.NewKeyFromSeed(seed)
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+const (
+	DefaultImpersonationTTL = 15 * time.Minute
+	MaxImpersonationTTL     = time.Hour
+)
+
+type ImpersonationConfig struct {
+	TTL time.Duration // Lifetime of a token issued to act as another user
+}
+
+func (cfg *Config) LoadImpersonationConfig() {
+	ttl, err := time.ParseDuration(os.Getenv("IMPERSONATION_TTL"))
+	if err != nil || ttl <= 0 || ttl > MaxImpersonationTTL {
+		ttl = DefaultImpersonationTTL
+	}
+	cfg.Impersonation.TTL = ttl
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+type InvitationConfig struct {
+	TTL       time.Duration // How long an invite link can be accepted
+	AcceptURL string        // Page that asks for a password and posts the token to /api/invitations/accept
+}
+
+func (cfg *Config) LoadInvitationConfig() {
+	ttl, err := time.ParseDuration(os.Getenv("INVITATION_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = DefaultInvitationTTL
+	}
+	cfg.Invitation.TTL = ttl
+
+	cfg.Invitation.AcceptURL = os.Getenv("INVITATION_ACCEPT_URL")
+	if cfg.Invitation.AcceptURL == "" {
+		cfg.Invitation.AcceptURL = cfg.AppURL + "/invitations/accept"
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultLoginMaxAttempts   = 5
+	DefaultLoginIPMaxAttempts = 20
+	DefaultLoginLockoutWindow = 15 * time.Minute
+)
+
+type LoginThrottleConfig struct {
+	MaxAttempts   int           // Failed attempts per account before it is locked
+	IPMaxAttempts int           // Failed attempts per IP before it is locked
+	LockoutWindow time.Duration // How long failures are counted and locks are kept
+}
+
+func (cfg *Config) LoadLoginThrottleConfig() {
+	maxAttempts, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS"))
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = DefaultLoginMaxAttempts
+	}
+	cfg.LoginThrottle.MaxAttempts = maxAttempts
+
+	ipMaxAttempts, err := strconv.Atoi(os.Getenv("LOGIN_IP_MAX_ATTEMPTS"))
+	if err != nil || ipMaxAttempts <= 0 {
+		ipMaxAttempts = DefaultLoginIPMaxAttempts
+	}
+	cfg.LoginThrottle.IPMaxAttempts = ipMaxAttempts
+
+	window, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_WINDOW"))
+	if err != nil || window <= 0 {
+		window = DefaultLoginLockoutWindow
+	}
+	cfg.LoginThrottle.LockoutWindow = window
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"os"
+	"task/internal/mailer"
+)
+
+const (
+	DefaultSMTPPort = "587"
+	DefaultMailFrom = "no-reply@task.local"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (cfg *Config) LoadSMTPConfig() {
+	cfg.SMTP.Host = os.Getenv("SMTP_HOST")
+	cfg.SMTP.Username = os.Getenv("SMTP_USERNAME")
+	cfg.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+
+	cfg.SMTP.Port = os.Getenv("SMTP_PORT")
+	if cfg.SMTP.Port == "" {
+		cfg.SMTP.Port = DefaultSMTPPort
+	}
+
+	cfg.SMTP.From = os.Getenv("SMTP_FROM")
+	if cfg.SMTP.From == "" {
+		cfg.SMTP.From = DefaultMailFrom
+	}
+
+	// Fall back to logging emails when no relay is configured
+	if cfg.SMTP.Host == "" {
+		cfg.Mailer = mailer.NewLogMailer(cfg.Logger.Logger)
+		return
+	}
+
+	cfg.Mailer = mailer.NewSMTPMailer(
+		cfg.SMTP.Host,
+		cfg.SMTP.Port,
+		cfg.SMTP.Username,
+		cfg.SMTP.Password,
+		cfg.SMTP.From,
+	)
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"os"
+)
+
+const (
+	DefaultMFAIssuer        = "Task"
+	DefaultMFARequiredRoles = "superuser"
+)
+
+type MFAConfig struct {
+	Issuer        string          // Shown by authenticator apps next to the account
+	RequiredRoles map[string]bool // Roles that must enroll before they can log in
+}
+
+func (cfg *Config) LoadMFAConfig() {
+	cfg.MFA.Issuer = os.Getenv("MFA_ISSUER")
+	if cfg.MFA.Issuer == "" {
+		cfg.MFA.Issuer = DefaultMFAIssuer
+	}
+
+	requiredRoles, ok := os.LookupEnv("MFA_REQUIRED_ROLES")
+	if !ok {
+		requiredRoles = DefaultMFARequiredRoles
+	}
+
+	cfg.MFA.RequiredRoles = make(map[string]bool)
+	for _, role := range splitList(requiredRoles) {
+		cfg.MFA.RequiredRoles[role] = true
+	}
+}
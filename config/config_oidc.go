@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+const (
+	DefaultOIDCScopes      = "openid,email,profile"
+	DefaultOIDCGroupsClaim = "groups"
+	DefaultOIDCDefaultRole = "user"
+)
+
+type OIDCProviderConfig struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	GroupsClaim  string            // ID token claim holding the user's groups
+	RoleMapping  []OIDCRoleMapping // Checked in order, the first matching group wins
+	DefaultRole  string            // Role for provisioned users without a mapped group
+}
+
+type OIDCRoleMapping struct {
+	Group string
+	Role  string
+}
+
+// LoadOIDCConfig reads the providers listed in OIDC_PROVIDERS. Each provider
+// is configured through OIDC_<NAME>_* variables, e.g. OIDC_CORP_ISSUER.
+func (cfg *Config) LoadOIDCConfig() {
+	cfg.OIDCProviders = make(map[string]OIDCProviderConfig)
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		env := func(key, fallback string) string {
+			value := os.Getenv(prefix + key)
+			if value == "" {
+				return fallback
+			}
+			return value
+		}
+
+		provider := OIDCProviderConfig{
+			Name:         name,
+			IssuerURL:    env("ISSUER", ""),
+			ClientID:     env("CLIENT_ID", ""),
+			ClientSecret: env("CLIENT_SECRET", ""),
+			RedirectURL:  env("REDIRECT_URL", cfg.AppURL+"/api/auth/oidc/"+name+"/callback"),
+			Scopes:       splitList(env("SCOPES", DefaultOIDCScopes)),
+			GroupsClaim:  env("GROUPS_CLAIM", DefaultOIDCGroupsClaim),
+			DefaultRole:  env("DEFAULT_ROLE", DefaultOIDCDefaultRole),
+		}
+
+		// OIDC_<NAME>_ROLE_MAPPING=group=role,group=role
+		for _, pair := range splitList(env("ROLE_MAPPING", "")) {
+			group, role, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+			provider.RoleMapping = append(provider.RoleMapping, OIDCRoleMapping{
+				Group: strings.TrimSpace(group),
+				Role:  strings.TrimSpace(role),
+			})
+		}
+
+		if provider.IssuerURL == "" || provider.ClientID == "" {
+			cfg.Logger.Warn("Skipping incomplete OIDC provider " + name)
+			continue
+		}
+
+		cfg.OIDCProviders[name] = provider
+	}
+}
+
+func splitList(value string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,17 @@
+package config
+
+import (
+	"os"
+	"task/internal/storage"
+)
+
+const DefaultStorageDir = "./data/uploads"
+
+func (cfg *Config) LoadStorageConfig() {
+	dir := os.Getenv("STORAGE_DIR")
+	if dir == "" {
+		dir = DefaultStorageDir
+	}
+
+	cfg.Storage = storage.NewLocalStorage(dir)
+}
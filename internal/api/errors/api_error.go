@@ -80,6 +80,26 @@ func ErrorForbidden(err error) error {
 	)
 }
 
+func ErrorTooManyRequests(err error) error {
+	return NewApiError(
+		err,
+		fiber.StatusTooManyRequests,
+		err.Error(),
+		nil,
+	)
+}
+
+// ErrorWithCode builds an ApiError whose data carries the machine-readable
+// code of an ErrorStatus so clients can tell failures apart.
+func ErrorWithCode(err error, code int) error {
+	return NewApiError(
+		err,
+		code,
+		err.Error(),
+		err,
+	)
+}
+
 type ErrorStatus struct {
 	Code    string `json:"code"`
 	Message string `json:"message,omitempty"`
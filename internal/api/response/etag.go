@@ -0,0 +1,32 @@
+package response
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetETag exposes the version of a resource so clients can send it back in
+// If-Match when they update it.
+func SetETag(ctx *fiber.Ctx, version int) {
+	ctx.Set(fiber.HeaderETag, `"`+strconv.Itoa(version)+`"`)
+}
+
+// IfMatchVersion returns the version a client expects to update. It returns
+// 0 when the header is missing or "*", meaning any version is accepted.
+func IfMatchVersion(ctx *fiber.Ctx) (int, error) {
+	header := strings.TrimSpace(ctx.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+
+	version, err := strconv.Atoi(tag)
+	if err != nil || version <= 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Invalid If-Match header")
+	}
+
+	return version, nil
+}
@@ -9,77 +9,28 @@ const (
 	RoleSuperUser = "superuser"
 )
 
-// Define permissions
-var rolePermissions = map[string]map[string]bool{
-	RoleAdmin: {
-		"create": true,
-		"read":   true,
-		"update": true,
-	},
-	RoleHR: {
-		"create": true,
-		"read":   true,
-		"update": false,
-	},
-	RoleManager: {
-		"create": false,
-		"read":   true,
-		"update": true,
-	},
-	RoleUser: {
-		"read":   true,
-		"update": true,
-	},
-	RoleSuperUser: {
-		"create": true,
-		"read":   true,
-		"update": true,
-		"delete": true,
-	},
-}
+// Define permissions, each one names the resource and the action on it
+const (
+	PermUsersCreate = "users:create"
+	PermUsersRead   = "users:read"
+	PermUsersUpdate = "users:update"
+	PermUsersDelete = "users:delete"
+	PermUsersUnlock = "users:unlock"
+
+	PermUsersDeactivate = "users:deactivate"
 
-var taskPermissions = map[string]map[string]bool{
-	RoleAdmin: {
-		"create": true,
-		"read":   true,
-		"update": true,
-		"delete": true,
-	},
-	RoleHR: {
-		"read":   true,
-		"update": true,
-	},
-	RoleManager: {
-		"create": true,
-		"read":   true,
-		"update": true,
-	},
-	RoleUser: {
-		"read":   true,
-		"update": true,
-	},
-	RoleSuperUser: {
-		"create": true,
-		"read":   true,
-		"update": true,
-		"delete": true,
-	},
-}
+	PermDepartmentsCreate = "departments:create"
+	PermDepartmentsRead   = "departments:read"
+	PermDepartmentsUpdate = "departments:update"
+	PermDepartmentsDelete = "departments:delete"
+	PermDepartmentsAssign = "departments:assign"
 
-// Check if role has permission
-func HasPermission(role, permission string) bool {
-	perms, ok := rolePermissions[role]
-	if !ok {
-		return false
-	}
-	return perms[permission]
-}
+	PermTasksCreate  = "tasks:create"
+	PermTasksRead    = "tasks:read"
+	PermTasksUpdate  = "tasks:update"
+	PermTasksDelete  = "tasks:delete"
+	PermTasksSubmit  = "tasks:submit"
+	PermTasksApprove = "tasks:approve"
 
-// Check if role has permission for tasks
-func HasTaskPermission(role, permission string) bool {
-	perms, ok := taskPermissions[role]
-	if !ok {
-		return false
-	}
-	return perms[permission]
-}
+	PermActivityRead = "activity:read"
+)
@@ -0,0 +1,12 @@
+package accesstoken
+
+import "context"
+
+type Service interface {
+	CreateToken(ctx context.Context, cmd *CreateAccessTokenCommand) (*CreateAccessTokenResult, error)
+	ListTokens(ctx context.Context, email string) ([]*AccessToken, error)
+	RevokeToken(ctx context.Context, email string, id int) error
+
+	// Authenticate resolves the owner of a presented token
+	Authenticate(ctx context.Context, token string) (*TokenOwner, error)
+}
@@ -0,0 +1,135 @@
+package accesstokenimpl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"task/config"
+	"task/internal/db"
+	"task/internal/identity/accesstoken"
+	"task/internal/identity/user"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type service struct {
+	store *store
+	cfg   *config.Config
+	log   *zap.Logger
+	db    db.DB
+}
+
+func NewService(db db.DB, cfg *config.Config) *service {
+	return &service{
+		store: NewStore(db),
+		cfg:   cfg,
+		db:    db,
+		log:   zap.L().Named("accesstoken.service"),
+	}
+}
+
+func (s *service) ownerID(ctx context.Context, email string) (int, error) {
+	userID, err := s.store.getUserIDByEmail(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+
+	if userID == 0 {
+		return 0, user.ErrUserNotFound
+	}
+
+	return userID, nil
+}
+
+func (s *service) CreateToken(ctx context.Context, cmd *accesstoken.CreateAccessTokenCommand) (*accesstoken.CreateAccessTokenResult, error) {
+	userID, err := s.ownerID(ctx, cmd.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	taken, err := s.store.nameTaken(ctx, userID, cmd.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if taken {
+		return nil, accesstoken.ErrTokenNameTaken
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+
+	token := accesstoken.Prefix + base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().AddDate(0, 0, cmd.ExpirationDays)
+
+	result, err := s.store.create(ctx, userID, cmd, hashToken(token), token[:len(accesstoken.Prefix)+6], expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &accesstoken.CreateAccessTokenResult{
+		Token:       token,
+		AccessToken: result,
+	}, nil
+}
+
+func (s *service) ListTokens(ctx context.Context, email string) ([]*accesstoken.AccessToken, error) {
+	userID, err := s.ownerID(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store.listByUser(ctx, userID)
+}
+
+func (s *service) RevokeToken(ctx context.Context, email string, id int) error {
+	userID, err := s.ownerID(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.store.revoke(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if !revoked {
+		return accesstoken.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+func (s *service) Authenticate(ctx context.Context, token string) (*accesstoken.TokenOwner, error) {
+	if !strings.HasPrefix(token, accesstoken.Prefix) {
+		return nil, accesstoken.ErrInvalidToken
+	}
+
+	owner, err := s.store.getOwnerByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if owner == nil {
+		return nil, accesstoken.ErrInvalidToken
+	}
+
+	// Usage tracking is informational and must not fail the request
+	err = s.store.touch(ctx, owner.TokenID)
+	if err != nil {
+		s.log.Warn("Failed to record access token usage", zap.Int("token_id", owner.TokenID), zap.Error(err))
+	}
+
+	return owner, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
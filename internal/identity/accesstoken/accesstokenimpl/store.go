@@ -0,0 +1,203 @@
+package accesstokenimpl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"task/internal/db"
+	"task/internal/identity/accesstoken"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type store struct {
+	db     db.DB
+	logger *zap.Logger
+}
+
+func NewStore(db db.DB) *store {
+	return &store{
+		db:     db,
+		logger: zap.L().Named("accesstoken.store"),
+	}
+}
+
+func (s *store) getUserIDByEmail(ctx context.Context, email string) (int, error) {
+	var id int
+
+	err := s.db.Get(ctx, &id, "SELECT id FROM users WHERE email = $1", email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *store) create(ctx context.Context, userID int, cmd *accesstoken.CreateAccessTokenCommand, tokenHash, tokenPrefix string, expiresAt time.Time) (*accesstoken.AccessToken, error) {
+	var result accesstoken.AccessToken
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			INSERT INTO personal_access_tokens (
+				user_id,
+				name,
+				token_hash,
+				token_prefix,
+				scopes,
+				expires_at
+			) VALUES (
+				$1, $2, $3, $4, $5, $6
+			) RETURNING id, user_id, name, token_prefix, scopes, expires_at, created_at
+		`
+
+		return tx.QueryRow(
+			ctx,
+			rawSQL,
+			userID,
+			cmd.Name,
+			tokenHash,
+			tokenPrefix,
+			pq.Array(cmd.Scopes),
+			expiresAt,
+		).Scan(
+			&result.ID,
+			&result.UserID,
+			&result.Name,
+			&result.TokenPrefix,
+			&result.Scopes,
+			&result.ExpiresAt,
+			&result.CreatedAt,
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *store) nameTaken(ctx context.Context, userID int, name string) (bool, error) {
+	var count int
+
+	rawSQL := `
+		SELECT COUNT(*)
+		FROM personal_access_tokens
+		WHERE
+			user_id = $1 AND
+			name = $2 AND
+			revoked_at IS NULL
+	`
+
+	err := s.db.Get(ctx, &count, rawSQL, userID, name)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (s *store) listByUser(ctx context.Context, userID int) ([]*accesstoken.AccessToken, error) {
+	result := make([]*accesstoken.AccessToken, 0)
+
+	rawSQL := `
+		SELECT
+			id,
+			user_id,
+			name,
+			token_prefix,
+			scopes,
+			expires_at,
+			last_used_at,
+			revoked_at,
+			created_at
+		FROM
+			personal_access_tokens
+		WHERE
+			user_id = $1
+		ORDER BY id DESC
+	`
+
+	err := s.db.Select(ctx, &result, rawSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// revoke marks an active token of the user as revoked and reports whether
+// one was found.
+func (s *store) revoke(ctx context.Context, userID, id int) (bool, error) {
+	rawSQL := `
+		UPDATE personal_access_tokens
+		SET revoked_at = NOW()
+		WHERE
+			id = $1 AND
+			user_id = $2 AND
+			revoked_at IS NULL
+	`
+
+	result, err := s.db.Exec(ctx, rawSQL, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// getOwnerByHash returns the owner of an active, unexpired token
+func (s *store) getOwnerByHash(ctx context.Context, tokenHash string) (*accesstoken.TokenOwner, error) {
+	var owner accesstoken.TokenOwner
+
+	rawSQL := `
+		SELECT
+			t.id AS token_id,
+			u.id AS user_id,
+			u.email,
+			u.role,
+			t.scopes
+		FROM
+			personal_access_tokens t
+		JOIN
+			users u
+		ON t.user_id = u.id
+		WHERE
+			t.token_hash = $1 AND
+			t.revoked_at IS NULL AND
+			t.expires_at > NOW()
+	`
+
+	err := s.db.Get(ctx, &owner, rawSQL, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &owner, nil
+}
+
+// touch records token usage at most once a minute to keep writes down
+func (s *store) touch(ctx context.Context, id int) error {
+	rawSQL := `
+		UPDATE personal_access_tokens
+		SET last_used_at = NOW()
+		WHERE
+			id = $1 AND
+			(last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	_, err := s.db.Exec(ctx, rawSQL, id)
+	return err
+}
@@ -0,0 +1,122 @@
+package accesstoken
+
+import (
+	"strings"
+	"task/internal/api/errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrTokenNotFound     = errors.New("accesstoken.not-found", "Access token not found")
+	ErrTokenNameTaken    = errors.New("accesstoken.name-taken", "An active access token with this name already exists")
+	ErrInvalidTokenName  = errors.New("accesstoken.invalid-name", "Invalid access token name")
+	ErrInvalidScope      = errors.New("accesstoken.invalid-scope", "Invalid access token scope")
+	ErrInvalidExpiration = errors.New("accesstoken.invalid-expiration", "Access tokens must expire within 365 days")
+	ErrInvalidToken      = errors.New("accesstoken.invalid", "Invalid, expired or revoked access token")
+)
+
+// Prefix marks personal access tokens so they can be told apart from JWTs
+const Prefix = "tsk_"
+
+const (
+	DefaultExpirationDays = 90
+	MaxExpirationDays     = 365
+)
+
+const (
+	ScopeTasksRead        = "tasks:read"
+	ScopeTasksWrite       = "tasks:write"
+	ScopeUsersRead        = "users:read"
+	ScopeUsersWrite       = "users:write"
+	ScopeDepartmentsRead  = "departments:read"
+	ScopeDepartmentsWrite = "departments:write"
+	ScopeActivityRead     = "activity:read"
+)
+
+var validScopes = map[string]bool{
+	ScopeTasksRead:        true,
+	ScopeTasksWrite:       true,
+	ScopeUsersRead:        true,
+	ScopeUsersWrite:       true,
+	ScopeDepartmentsRead:  true,
+	ScopeDepartmentsWrite: true,
+	ScopeActivityRead:     true,
+}
+
+// IsValidScope checks if a scope can be granted to a token
+func IsValidScope(scope string) bool {
+	return validScopes[scope]
+}
+
+// ScopeForPermission returns the scope a token needs to use a permission,
+// reading a resource needs its read scope and any other action its write scope.
+func ScopeForPermission(permission string) string {
+	resource, action, _ := strings.Cut(permission, ":")
+	if action == "read" {
+		return resource + ":read"
+	}
+	return resource + ":write"
+}
+
+type AccessToken struct {
+	ID          int            `db:"id" json:"id"`
+	UserID      int            `db:"user_id" json:"user_id"`
+	Name        string         `db:"name" json:"name"`
+	TokenPrefix string         `db:"token_prefix" json:"token_prefix"`
+	Scopes      pq.StringArray `db:"scopes" json:"scopes"`
+	ExpiresAt   time.Time      `db:"expires_at" json:"expires_at"`
+	LastUsedAt  *time.Time     `db:"last_used_at" json:"last_used_at"`
+	RevokedAt   *time.Time     `db:"revoked_at" json:"revoked_at"`
+	CreatedAt   time.Time      `db:"created_at" json:"created_at"`
+}
+
+// TokenOwner is the user a valid token authenticates as
+type TokenOwner struct {
+	TokenID int            `db:"token_id"`
+	UserID  int            `db:"user_id"`
+	Email   string         `db:"email"`
+	Role    string         `db:"role"`
+	Scopes  pq.StringArray `db:"scopes"`
+}
+
+type CreateAccessTokenCommand struct {
+	Email          string   `json:"-"` // Owner, taken from the session
+	Name           string   `json:"name"`
+	Scopes         []string `json:"scopes"`
+	ExpirationDays int      `json:"expiration_days"`
+}
+
+// CreateAccessTokenResult contains the plain token, it is only shown once
+type CreateAccessTokenResult struct {
+	Token       string       `json:"token"`
+	AccessToken *AccessToken `json:"access_token"`
+}
+
+func (cmd *CreateAccessTokenCommand) Validate() error {
+	cmd.Name = strings.TrimSpace(cmd.Name)
+	if len(cmd.Name) == 0 || len(cmd.Name) > 100 {
+		return ErrInvalidTokenName
+	}
+
+	if len(cmd.Scopes) == 0 {
+		return ErrInvalidScope
+	}
+
+	for _, scope := range cmd.Scopes {
+		if !IsValidScope(scope) {
+			return ErrInvalidScope
+		}
+	}
+
+	if cmd.ExpirationDays == 0 {
+		cmd.ExpirationDays = DefaultExpirationDays
+	}
+
+	if cmd.ExpirationDays < 0 || cmd.ExpirationDays > MaxExpirationDays {
+		return ErrInvalidExpiration
+	}
+
+	return nil
+}
@@ -8,13 +8,25 @@ import (
 type Service interface {
 	CreateDepartment(ctx context.Context, cmd *CreateDepartmentCommand) error
 	UpdateDepartment(ctx context.Context, cmd *UpdateDepartmentCommand) error
+	PatchDepartment(ctx context.Context, cmd *PatchDepartmentCommand) (*Department, error)
 	GetDepartmentByID(ctx context.Context, id int) (*Department, error)
 	SearchDepartment(ctx context.Context, query *SearchDepartmentQuery) (*SearchDepartmentResult, error)
-	DeleteDepartment(ctx context.Context, id int) error
+	DeleteDepartment(ctx context.Context, cmd *DeleteDepartmentCommand) (*DeleteDepartmentResult, error)
 
-	// Assign user to specific department
+	// The head approves the tasks of the department
+	SetDepartmentHead(ctx context.Context, cmd *SetDepartmentHeadCommand) (*Department, error)
+
+	// Organisation tree built from the parent of each department
+	GetDepartmentTree(ctx context.Context) ([]*DepartmentNode, error)
+
+	// Assign user to specific department, a user can belong to several
 	AssignUserToDepartment(ctx context.Context, cmd *AssignUserToDepartmentCommand) error
+	AssignUsersToDepartment(ctx context.Context, cmd *AssignUsersToDepartmentCommand) (*AssignUsersResult, error)
 	GetUsersByDepartment(ctx context.Context, departmentID int) ([]*user.UserDepartmentDTO, error)
-	RemoveUserFromDepartment(ctx context.Context, userID int) error
+	RemoveUserFromDepartment(ctx context.Context, cmd *RemoveUserFromDepartmentCommand) error
+
+	// Current and, on request, past memberships of a user or a department
+	GetUserMemberships(ctx context.Context, query *SearchMembershipQuery) ([]*Membership, error)
+	GetDepartmentMembers(ctx context.Context, query *SearchMembershipQuery) ([]*Membership, error)
 	SearchAllUsersByDepartment(ctx context.Context, query *SearchAllUsersByDepartmentQuery) (*SearchAllUsersByDepartmentResult, error)
 }
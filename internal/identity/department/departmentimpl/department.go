@@ -2,10 +2,13 @@ package departmentimpl
 
 import (
 	"context"
+	"encoding/json"
 	"task/config"
 	"task/internal/db"
 	"task/internal/identity/department"
+	"task/internal/identity/monitoringactivities"
 	"task/internal/identity/user"
+	"task/pkg/util/mergepatch"
 
 	"go.uber.org/zap"
 )
@@ -37,11 +40,24 @@ func (s *service) CreateDepartment(ctx context.Context, cmd *department.CreateDe
 			return department.ErrDepartmentAlreadyExists
 		}
 
-		err = s.store.create(ctx, cmd)
+		if cmd.ParentID != nil {
+			parent, err := s.store.getDepartmentByID(ctx, *cmd.ParentID)
+			if err != nil {
+				return err
+			}
+
+			if parent == nil {
+				return department.ErrParentNotFound
+			}
+		}
+
+		id, err := s.store.create(ctx, cmd)
 		if err != nil {
 			return err
 		}
 
+		monitoringactivities.Record(ctx, monitoringactivities.EventDepartmentCreated, monitoringactivities.TargetDepartment, id, nil, cmd)
+
 		return nil
 	})
 }
@@ -61,15 +77,83 @@ func (s *service) UpdateDepartment(ctx context.Context, cmd *department.UpdateDe
 			return department.ErrDepartmentAlreadyExists
 		}
 
-		err = s.store.update(ctx, cmd)
+		before, err := s.store.getDepartmentByID(ctx, cmd.ID)
+		if err != nil {
+			return err
+		}
+
+		updated, err := s.store.update(ctx, cmd)
 		if err != nil {
 			return err
 		}
 
+		if !updated {
+			return department.ErrVersionConflict
+		}
+
+		after, err := s.store.getDepartmentByID(ctx, cmd.ID)
+		if err != nil {
+			return err
+		}
+
+		monitoringactivities.Record(ctx, monitoringactivities.EventDepartmentUpdated, monitoringactivities.TargetDepartment, cmd.ID, before, after)
+
 		return nil
 	})
 }
 
+func (s *service) PatchDepartment(ctx context.Context, cmd *department.PatchDepartmentCommand) (*department.Department, error) {
+	existing, err := s.store.getDepartmentByID(ctx, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, department.ErrDepartmentNotFound
+	}
+
+	if cmd.Version != 0 && cmd.Version != existing.Version {
+		return nil, department.ErrVersionConflict
+	}
+
+	current, err := json.Marshal(&department.UpdateDepartmentCommand{
+		ID:       existing.ID,
+		Name:     existing.Name,
+		Location: existing.Location,
+		ParentID: existing.ParentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := mergepatch.Apply(current, cmd.Patch)
+	if err != nil {
+		return nil, department.ErrInvalidPatch
+	}
+
+	var update department.UpdateDepartmentCommand
+	if err := json.Unmarshal(patched, &update); err != nil {
+		return nil, department.ErrInvalidPatch
+	}
+
+	// The patch cannot move the update to another department, and the version
+	// read above guards against changes made in between. The merged document
+	// is complete, a parent_id it lacks was removed by the patch.
+	update.ID = existing.ID
+	update.Version = existing.Version
+	update.SetParent = true
+
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.UpdateDepartment(ctx, &update); err != nil {
+		return nil, err
+	}
+
+	return s.GetDepartmentByID(ctx, existing.ID)
+}
+
 func (s *service) GetDepartmentByID(ctx context.Context, id int) (*department.Department, error) {
 	result, err := s.store.getDepartmentByID(ctx, id)
 	if err != nil {
@@ -83,24 +167,94 @@ func (s *service) GetDepartmentByID(ctx context.Context, id int) (*department.De
 	return result, nil
 }
 
-func (s *service) DeleteDepartment(ctx context.Context, id int) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
-		result, err := s.store.getDepartmentByID(ctx, id)
+// DeleteDepartment applies the delete strategy of the command, the result
+// lists the blockers when the deletion is rejected with ErrDepartmentInUse
+func (s *service) DeleteDepartment(ctx context.Context, cmd *department.DeleteDepartmentCommand) (*department.DeleteDepartmentResult, error) {
+	before, err := s.store.getDepartmentByID(ctx, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.store.delete(ctx, cmd)
+	if err != nil {
+		return result, err
+	}
+
+	monitoringactivities.Record(ctx, monitoringactivities.EventDepartmentDeleted, monitoringactivities.TargetDepartment, cmd.ID, before, result)
+
+	return result, nil
+}
+
+func (s *service) SetDepartmentHead(ctx context.Context, cmd *department.SetDepartmentHeadCommand) (*department.Department, error) {
+	if cmd.UserID != nil {
+		active, err := s.store.isActiveUser(ctx, *cmd.UserID)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if result == nil {
-			return department.ErrDepartmentNotFound
+		if !active {
+			return nil, department.ErrHeadNotFound
 		}
+	}
 
-		err = s.store.delete(ctx, id)
-		if err != nil {
-			return err
+	before, err := s.store.getDepartmentByID(ctx, cmd.DepartmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.store.setHead(ctx, cmd.DepartmentID, cmd.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !updated {
+		return nil, department.ErrDepartmentNotFound
+	}
+
+	after, err := s.GetDepartmentByID(ctx, cmd.DepartmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if before != nil {
+		monitoringactivities.Record(ctx, monitoringactivities.EventDepartmentHeadChanged, monitoringactivities.TargetDepartment, cmd.DepartmentID,
+			map[string]interface{}{"head_id": before.HeadID},
+			map[string]interface{}{"head_id": after.HeadID},
+		)
+	}
+
+	return after, nil
+}
+
+// GetDepartmentTree returns the top level departments with their
+// sub-departments nested below them, siblings are sorted by name
+func (s *service) GetDepartmentTree(ctx context.Context) ([]*department.DepartmentNode, error) {
+	departments, err := s.store.getDepartmentTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]*department.DepartmentNode, len(departments))
+	for _, d := range departments {
+		nodes[d.ID] = &department.DepartmentNode{
+			Department: d,
+			Children:   make([]*department.DepartmentNode, 0),
 		}
+	}
 
-		return nil
-	})
+	roots := make([]*department.DepartmentNode, 0)
+	for _, d := range departments {
+		if d.ParentID != nil {
+			if parent, ok := nodes[*d.ParentID]; ok {
+				parent.Children = append(parent.Children, nodes[d.ID])
+				continue
+			}
+		}
+
+		roots = append(roots, nodes[d.ID])
+	}
+
+	return roots, nil
 }
 
 func (s *service) SearchDepartment(ctx context.Context, query *department.SearchDepartmentQuery) (*department.SearchDepartmentResult, error) {
@@ -124,15 +278,32 @@ func (s *service) SearchDepartment(ctx context.Context, query *department.Search
 }
 
 func (s *service) AssignUserToDepartment(ctx context.Context, cmd *department.AssignUserToDepartmentCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
-		err := s.store.assignUserToDepartment(ctx, cmd)
-		if err != nil {
-			return err
-		}
+	_, err := s.AssignUsersToDepartment(ctx, &department.AssignUsersToDepartmentCommand{
+		DepartmentID: cmd.DepartmentID,
+		UserIDs:      []int{cmd.UserID},
+		Role:         cmd.Role,
+	})
 
-		return nil
+	return err
+}
+
+// AssignUsersToDepartment returns the users it could not assign along with
+// ErrUserDepartmentNotFound or ErrUserAlreadyAssigned
+func (s *service) AssignUsersToDepartment(ctx context.Context, cmd *department.AssignUsersToDepartmentCommand) (*department.AssignUsersResult, error) {
+	result, err := s.store.assignUsersToDepartment(ctx, cmd)
+	if err != nil {
+		return result, err
+	}
+
+	monitoringactivities.Record(ctx, monitoringactivities.EventMembersAssigned, monitoringactivities.TargetDepartment, cmd.DepartmentID, nil, map[string]interface{}{
+		"role":         cmd.Role,
+		"assigned":     result.Assigned,
+		"role_changed": result.RoleChanged,
 	})
+
+	return result, nil
 }
+
 func (s *service) GetUsersByDepartment(ctx context.Context, departmentID int) ([]*user.UserDepartmentDTO, error) {
 	result, err := s.store.getUsersByDepartment(ctx, departmentID)
 	if err != nil {
@@ -146,15 +317,40 @@ func (s *service) GetUsersByDepartment(ctx context.Context, departmentID int) ([
 	return result, nil
 }
 
-func (s *service) RemoveUserFromDepartment(ctx context.Context, userID int) error {
-	err := s.store.removeUserFromDepartment(ctx, userID)
+func (s *service) RemoveUserFromDepartment(ctx context.Context, cmd *department.RemoveUserFromDepartmentCommand) error {
+	err := s.store.removeUserFromDepartment(ctx, cmd)
 	if err != nil {
 		return err
 	}
 
+	monitoringactivities.Record(ctx, monitoringactivities.EventMemberRemoved, monitoringactivities.TargetUser, cmd.UserID, nil, map[string]interface{}{
+		"department_id": cmd.DepartmentID, // 0 when removed from every department
+	})
+
 	return nil
 }
 
+func (s *service) GetUserMemberships(ctx context.Context, query *department.SearchMembershipQuery) ([]*department.Membership, error) {
+	query.DepartmentID = 0
+
+	return s.store.searchMemberships(ctx, query)
+}
+
+func (s *service) GetDepartmentMembers(ctx context.Context, query *department.SearchMembershipQuery) ([]*department.Membership, error) {
+	result, err := s.store.getDepartmentByID(ctx, query.DepartmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, department.ErrDepartmentNotFound
+	}
+
+	query.UserID = 0
+
+	return s.store.searchMemberships(ctx, query)
+}
+
 func (s *service) SearchAllUsersByDepartment(ctx context.Context, query *department.SearchAllUsersByDepartmentQuery) (*department.SearchAllUsersByDepartmentResult, error) {
 	if query.Page <= 0 {
 		query.Page = s.cfg.Pagination.Page
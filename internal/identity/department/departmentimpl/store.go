@@ -6,12 +6,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"task/internal/db"
 	"task/internal/identity/department"
+	"task/internal/identity/task"
 	"task/internal/identity/user"
 
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -27,25 +30,28 @@ func NewStore(db db.DB) *store {
 	}
 }
 
-func (s *store) create(ctx context.Context, cmd *department.CreateDepartmentCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+func (s *store) create(ctx context.Context, cmd *department.CreateDepartmentCommand) (int, error) {
+	var id int
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
 		rawSQL := `
 			INSERT INTO departments (
 				name,
-				location
+				location,
+				parent_id
 			)VALUES (
 				$1,
-				$2
+				$2,
+				$3
 			) RETURNING id
 		`
 
-		var id int
-
 		err := tx.QueryRow(
 			ctx,
 			rawSQL,
 			cmd.Name,
 			cmd.Location,
+			cmd.ParentID,
 		).Scan(&id)
 		if err != nil {
 			return err
@@ -53,6 +59,8 @@ func (s *store) create(ctx context.Context, cmd *department.CreateDepartmentComm
 
 		return nil
 	})
+
+	return id, err
 }
 
 func (s *store) getDepartmentByID(ctx context.Context, id int) (*department.Department, error) {
@@ -63,8 +71,11 @@ func (s *store) getDepartmentByID(ctx context.Context, id int) (*department.Depa
 			id,
 			name,
 			location,
+			parent_id,
+			head_id,
 			created_at,
-			updated_at
+			updated_at,
+			version
 		FROM
 			departments
 		WHERE
@@ -83,46 +94,385 @@ func (s *store) getDepartmentByID(ctx context.Context, id int) (*department.Depa
 	return &department, nil
 }
 
-func (s *store) update(ctx context.Context, cmd *department.UpdateDepartmentCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+// update returns false when cmd.Version no longer matches the stored version.
+// The parent is left as is unless cmd.SetParent. Moves are serialized so two
+// concurrent moves cannot close a cycle.
+func (s *store) update(ctx context.Context, cmd *department.UpdateDepartmentCommand) (bool, error) {
+	var updated bool
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		if cmd.SetParent && cmd.ParentID != nil {
+			_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", hierarchyLock)
+			if err != nil {
+				return err
+			}
+
+			err = checkParent(ctx, tx, cmd.ID, *cmd.ParentID)
+			if err != nil {
+				return err
+			}
+		}
+
 		rawSQL := `
 			UPDATE departments
 			SET
 				name = $1,
-				location = $2
+				location = $2,
+				parent_id = CASE WHEN $6 THEN $3 ELSE parent_id END,
+				version = version + 1,
+				updated_at = NOW()
 			WHERE
-				id = $3
+				id = $4 AND
+				($5 = 0 OR version = $5)
 		`
 
-		_, err := tx.Exec(
+		result, err := tx.Exec(
 			ctx,
 			rawSQL,
 			cmd.Name,
 			cmd.Location,
+			cmd.ParentID,
 			cmd.ID,
+			cmd.Version,
+			cmd.SetParent,
 		)
 		if err != nil {
 			return err
 		}
 
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		updated = affected > 0
+
 		return nil
 	})
+
+	return updated, err
 }
 
-func (s *store) delete(ctx context.Context, id int) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+// hierarchyLock is the advisory lock key taken while departments are moved
+const hierarchyLock = 4201
+
+// checkParent fails when parentID does not exist or is id itself or one of
+// its descendants. id is 0 for new departments.
+func checkParent(ctx context.Context, tx db.Tx, id, parentID int) error {
+	rawSQL := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM departments WHERE id = $1
+			UNION
+			SELECT d.id, d.parent_id FROM departments d JOIN ancestors a ON d.id = a.parent_id
+		)
+		SELECT
+			EXISTS (SELECT 1 FROM ancestors WHERE id = $1) AS found,
+			EXISTS (SELECT 1 FROM ancestors WHERE id = $2) AS cycle
+	`
+
+	var found, cycle bool
+
+	err := tx.QueryRow(ctx, rawSQL, parentID, id).Scan(&found, &cycle)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return department.ErrParentNotFound
+	}
+
+	if cycle {
+		return department.ErrDepartmentCycle
+	}
+
+	return nil
+}
+
+func (s *store) getDepartmentTree(ctx context.Context) ([]*department.Department, error) {
+	result := make([]*department.Department, 0)
+
+	rawSQL := `
+		SELECT
+			id,
+			name,
+			location,
+			parent_id,
+			head_id,
+			created_at,
+			updated_at,
+			version
+		FROM
+			departments
+		ORDER BY name
+	`
+
+	err := s.db.Select(ctx, &result, rawSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// setHead returns false when the department does not exist
+func (s *store) setHead(ctx context.Context, id int, headID *int) (bool, error) {
+	rawSQL := `
+		UPDATE departments
+		SET
+			head_id = $1,
+			version = version + 1,
+			updated_at = NOW()
+		WHERE
+			id = $2
+	`
+
+	result, err := s.db.Exec(ctx, rawSQL, headID, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (s *store) isActiveUser(ctx context.Context, id int) (bool, error) {
+	var active bool
+
+	err := s.db.Get(ctx, &active, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND status = $2)", id, user.Active)
+	if err != nil {
+		return false, err
+	}
+
+	return active, nil
+}
+
+// delete removes the department once nothing blocks it anymore. The blockers
+// are read under the same locks as the changes, so a member assigned in
+// between cannot be lost. Membership rows of the department, current and
+// past, go away with it whatever the strategy, moved members start a new
+// membership in the target.
+func (s *store) delete(ctx context.Context, cmd *department.DeleteDepartmentCommand) (*department.DeleteDepartmentResult, error) {
+	result := &department.DeleteDepartmentResult{
+		ID: cmd.ID,
+	}
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		// Children cannot be added while the tree is locked
+		_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", hierarchyLock)
+		if err != nil {
+			return err
+		}
+
+		var parentID *int
+
+		err = tx.QueryRow(ctx, "SELECT parent_id FROM departments WHERE id = $1 FOR UPDATE", cmd.ID).Scan(&parentID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return department.ErrDepartmentNotFound
+			}
+			return err
+		}
+
+		children, err := selectIDs(ctx, tx, "SELECT id FROM departments WHERE parent_id = $1 ORDER BY id", cmd.ID)
+		if err != nil {
+			return err
+		}
+
+		// Locking the memberships keeps them from ending or changing role
+		// until the department is gone
 		rawSQL := `
+			SELECT user_id
+			FROM department_members
+			WHERE
+				department_id = $1 AND
+				left_at IS NULL
+			ORDER BY user_id
+			FOR UPDATE
+		`
+
+		members, err := selectIDs(ctx, tx, rawSQL, cmd.ID)
+		if err != nil {
+			return err
+		}
+
+		rawSQL = `
+			SELECT id
+			FROM tasks
+			WHERE department_id = $1
+			ORDER BY id
+			FOR UPDATE
+		`
+
+		tasks, err := selectIDs(ctx, tx, rawSQL, cmd.ID)
+		if err != nil {
+			return err
+		}
+
+		rawSQL = `
+			SELECT id
+			FROM tasks
+			WHERE
+				department_id = $1 AND
+				status <> $2
+			ORDER BY id
+		`
+
+		openTasks, err := selectIDs(ctx, tx, rawSQL, cmd.ID, task.TaskDone)
+		if err != nil {
+			return err
+		}
+
+		if len(children) > 0 && !cmd.Reparent {
+			result.Blockers = append(result.Blockers, &department.DeletionBlocker{
+				Type: department.BlockerChildren,
+				IDs:  children,
+			})
+		}
+
+		if len(members) > 0 && cmd.Strategy == department.DeleteReject {
+			result.Blockers = append(result.Blockers, &department.DeletionBlocker{
+				Type: department.BlockerMembers,
+				IDs:  members,
+			})
+		}
+
+		if len(openTasks) > 0 && cmd.Strategy == department.DeleteReject {
+			result.Blockers = append(result.Blockers, &department.DeletionBlocker{
+				Type: department.BlockerTasks,
+				IDs:  openTasks,
+			})
+		}
+
+		if len(result.Blockers) > 0 {
+			return department.ErrDepartmentInUse
+		}
+
+		if len(children) > 0 {
+			if cmd.NewParentID > 0 {
+				err = checkParent(ctx, tx, cmd.ID, cmd.NewParentID)
+				if err != nil {
+					return err
+				}
+
+				parentID = &cmd.NewParentID
+			}
+
+			rawSQL = `
+				UPDATE departments
+				SET
+					parent_id = $1,
+					version = version + 1,
+					updated_at = NOW()
+				WHERE
+					parent_id = $2
+			`
+
+			_, err = tx.Exec(ctx, rawSQL, parentID, cmd.ID)
+			if err != nil {
+				return err
+			}
+
+			result.ReparentedChildren = len(children)
+		}
+
+		switch cmd.Strategy {
+		case department.DeleteMove:
+			err = moveMembers(ctx, tx, cmd.ID, cmd.TargetID)
+			if err != nil {
+				return err
+			}
+
+			rawSQL = `
+				UPDATE tasks
+				SET
+					department_id = $2,
+					version = version + 1,
+					updated_at = NOW()
+				WHERE
+					department_id = $1
+			`
+
+			_, err = tx.Exec(ctx, rawSQL, cmd.ID, cmd.TargetID)
+			if err != nil {
+				return err
+			}
+
+			result.MovedMembers = len(members)
+			result.MovedTasks = len(tasks)
+		case department.DeleteUnassign:
+			// The foreign keys delete the membership rows, past ones
+			// included, and clear the department of the tasks
+			result.UnassignedMembers = len(members)
+			result.UnassignedTasks = len(tasks)
+		}
+
+		rawSQL = `
 			DELETE FROM departments
-			WHERE id = $1	
+			WHERE id = $1
 		`
 
-		_, err := tx.Exec(ctx, rawSQL, id)
+		_, err = tx.Exec(ctx, rawSQL, cmd.ID)
 		if err != nil {
 			return err
 		}
 
 		return nil
 	})
+
+	return result, err
+}
+
+// moveMembers adds the current members of a department to the target one
+// with the same role, users already in the target keep their membership. It
+// also checks that the target exists, so it runs with or without members.
+func moveMembers(ctx context.Context, tx db.Tx, id, targetID int) error {
+	var exists bool
+
+	err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM departments WHERE id = $1 FOR SHARE)", targetID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return department.ErrTargetNotFound
+	}
+
+	rawSQL := `
+		INSERT INTO department_members (department_id, user_id, role)
+		SELECT $2, user_id, role
+		FROM department_members
+		WHERE
+			department_id = $1 AND
+			left_at IS NULL
+		ON CONFLICT (department_id, user_id) WHERE left_at IS NULL DO NOTHING
+	`
+
+	_, err = tx.Exec(ctx, rawSQL, id, targetID)
+
+	return err
+}
+
+func selectIDs(ctx context.Context, tx db.Tx, rawSQL string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(ctx, rawSQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
 }
 
 func (s *store) departmentTaken(ctx context.Context, id int, name string) ([]*department.Department, error) {
@@ -164,6 +514,8 @@ func (s *store) search(ctx context.Context, query *department.SearchDepartmentQu
 			id,
 			name,
 			location,
+			parent_id,
+			head_id,
 			created_at,
 			updated_at
 		FROM
@@ -222,21 +574,133 @@ func (s *store) getCount(ctx context.Context, sql bytes.Buffer, whereParams []in
 	return count, nil
 }
 
-// Assign user to specific department
-func (s *store) assignUserToDepartment(ctx context.Context, cmd *department.AssignUserToDepartmentCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+// assignUsersToDepartment checks the department and the users and assigns
+// them in one transaction, nothing is written when one of them is missing or
+// already a member with the same role
+func (s *store) assignUsersToDepartment(ctx context.Context, cmd *department.AssignUsersToDepartmentCommand) (*department.AssignUsersResult, error) {
+	result := &department.AssignUsersResult{
+		DepartmentID: cmd.DepartmentID,
+		Assigned:     make([]int, 0),
+		RoleChanged:  make([]int, 0),
+	}
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		// Keeps the department from being deleted until the members are in
+		var exists bool
+
+		err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM departments WHERE id = $1 FOR SHARE)", cmd.DepartmentID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return department.ErrDepartmentNotFound
+		}
+
 		rawSQL := `
-			UPDATE users
-			SET department_id = $1
-			WHERE id = $2
+			SELECT id
+			FROM users
+			WHERE
+				id = ANY($1) AND
+				status <> $2
+			FOR SHARE
+		`
+
+		found, err := selectIDs(ctx, tx, rawSQL, pq.Array(cmd.UserIDs), user.Deleted)
+		if err != nil {
+			return err
+		}
+
+		if len(found) < len(cmd.UserIDs) {
+			for _, id := range cmd.UserIDs {
+				if !slices.Contains(found, id) {
+					result.Missing = append(result.Missing, id)
+				}
+			}
+			return department.ErrUserDepartmentNotFound
+		}
+
+		rawSQL = `
+			SELECT user_id, role
+			FROM department_members
+			WHERE
+				department_id = $1 AND
+				user_id = ANY($2) AND
+				left_at IS NULL
+			FOR UPDATE
+		`
+
+		rows, err := tx.Query(ctx, rawSQL, cmd.DepartmentID, pq.Array(cmd.UserIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		members := make(map[int]bool)
+		for rows.Next() {
+			var (
+				userID int
+				role   department.MembershipRole
+			)
+			if err := rows.Scan(&userID, &role); err != nil {
+				return err
+			}
+
+			members[userID] = true
+			if role == cmd.Role {
+				result.Duplicates = append(result.Duplicates, userID)
+			} else {
+				result.RoleChanged = append(result.RoleChanged, userID)
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(result.Duplicates) > 0 {
+			return department.ErrUserAlreadyAssigned
+		}
+
+		for _, id := range cmd.UserIDs {
+			if !members[id] {
+				result.Assigned = append(result.Assigned, id)
+			}
+		}
+
+		// A role change ends the current membership so the old role stays in
+		// the history
+		if len(result.RoleChanged) > 0 {
+			rawSQL = `
+				UPDATE department_members
+				SET left_at = NOW()
+				WHERE
+					department_id = $1 AND
+					user_id = ANY($2) AND
+					left_at IS NULL
+			`
+
+			_, err = tx.Exec(ctx, rawSQL, cmd.DepartmentID, pq.Array(result.RoleChanged))
+			if err != nil {
+				return err
+			}
+		}
+
+		rawSQL = `
+			INSERT INTO department_members (department_id, user_id, role)
+			SELECT $1, id, $3
+			FROM unnest($2::int[]) AS id
 		`
-		_, err := tx.Exec(ctx, rawSQL, cmd.DepartmentID, cmd.UserID)
+
+		_, err = tx.Exec(ctx, rawSQL, cmd.DepartmentID, pq.Array(cmd.UserIDs), cmd.Role)
 		if err != nil {
 			return err
 		}
 
 		return nil
 	})
+
+	return result, err
 }
 
 func (s *store) getUsersByDepartment(ctx context.Context, departmentID int) ([]*user.UserDepartmentDTO, error) {
@@ -257,15 +721,17 @@ func (s *store) getUsersByDepartment(ctx context.Context, departmentID int) ([]*
 			u.status,
 			u.created_at,
 			u.updated_at,
-			u.department_id,
-			d.name AS department_name
+			m.department_id,
+			d.name AS department_name,
+			m.role AS membership_role,
+			m.joined_at
 		FROM
-			users u
-		LEFT JOIN
-			departments d
-		ON u.department_id = d.id
+			department_members m
+		JOIN users u ON u.id = m.user_id
+		JOIN departments d ON d.id = m.department_id
 		WHERE
-			u.department_id = $1
+			m.department_id = $1 AND
+			m.left_at IS NULL
 	`
 
 	err := s.db.Select(ctx, &users, rawSQL, departmentID)
@@ -276,16 +742,20 @@ func (s *store) getUsersByDepartment(ctx context.Context, departmentID int) ([]*
 	return users, nil
 }
 
-// RemoveUserFromDepartment removes the department association from the user by setting department_id to NULL
-func (s *store) removeUserFromDepartment(ctx context.Context, userID int) error {
+// removeUserFromDepartment ends the current memberships of the user, the rows
+// are kept as history
+func (s *store) removeUserFromDepartment(ctx context.Context, cmd *department.RemoveUserFromDepartmentCommand) error {
 	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
 		rawSQL := `
-			UPDATE users
-			SET department_id = NULL
-			WHERE id = $1	
+			UPDATE department_members
+			SET left_at = NOW()
+			WHERE
+				user_id = $1 AND
+				($2 = 0 OR department_id = $2) AND
+				left_at IS NULL
 		`
 
-		_, err := tx.Exec(ctx, rawSQL, userID)
+		_, err := tx.Exec(ctx, rawSQL, cmd.UserID, cmd.DepartmentID)
 		if err != nil {
 			return err
 		}
@@ -294,6 +764,60 @@ func (s *store) removeUserFromDepartment(ctx context.Context, userID int) error
 	})
 }
 
+func (s *store) searchMemberships(ctx context.Context, query *department.SearchMembershipQuery) ([]*department.Membership, error) {
+	var (
+		result         = make([]*department.Membership, 0)
+		sql            bytes.Buffer
+		whereCondition = make([]string, 0)
+		whereParams    = make([]interface{}, 0)
+		paramIndex     = 1
+	)
+
+	sql.WriteString(`
+		SELECT
+			m.id,
+			m.user_id,
+			m.department_id,
+			d.name AS department_name,
+			m.role,
+			m.joined_at,
+			m.left_at
+		FROM
+			department_members m
+		JOIN departments d ON d.id = m.department_id
+		WHERE 1=1
+	`)
+
+	if query.UserID > 0 {
+		whereCondition = append(whereCondition, "m.user_id = $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, query.UserID)
+		paramIndex++
+	}
+
+	if query.DepartmentID > 0 {
+		whereCondition = append(whereCondition, "m.department_id = $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, query.DepartmentID)
+		paramIndex++
+	}
+
+	if !query.History {
+		whereCondition = append(whereCondition, "m.left_at IS NULL")
+	}
+
+	if len(whereCondition) > 0 {
+		sql.WriteString(" AND " + strings.Join(whereCondition, " AND "))
+	}
+
+	sql.WriteString(" ORDER BY m.joined_at DESC, m.id DESC")
+
+	err := s.db.Select(ctx, &result, sql.String(), whereParams...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (s *store) searchAllUsersByDepartment(ctx context.Context, query *department.SearchAllUsersByDepartmentQuery) (*department.SearchAllUsersByDepartmentResult, error) {
 	var (
 		result = &department.SearchAllUsersByDepartmentResult{
@@ -320,20 +844,57 @@ func (s *store) searchAllUsersByDepartment(ctx context.Context, query *departmen
 			u.status,
 			u.created_at,
 			u.updated_at,
-			u.department_id,
-			d.name AS department_name
+			m.department_id,
+			d.name AS department_name,
+			m.role AS membership_role,
+			m.joined_at
 		FROM
 			users u
+		LEFT JOIN
+			department_members m
+		ON m.user_id = u.id AND m.left_at IS NULL
 		LEFT JOIN
 			departments d
-		ON u.department_id = d.id
+		ON m.department_id = d.id
 		WHERE 1=1
 	`)
 
-	if len(query.DepartmentName) > 0 {
-		whereCondition = append(whereCondition, "d.name ILIKE $"+strconv.Itoa(paramIndex))
-		whereParams = append(whereParams, "%"+query.DepartmentName+"%")
-		paramIndex++
+	if query.IncludeDescendants && (query.DepartmentID > 0 || len(query.DepartmentName) > 0) {
+		// The department filters select the roots of the subtrees to search
+		roots := make([]string, 0)
+
+		if query.DepartmentID > 0 {
+			roots = append(roots, "id = $"+strconv.Itoa(paramIndex))
+			whereParams = append(whereParams, query.DepartmentID)
+			paramIndex++
+		}
+
+		if len(query.DepartmentName) > 0 {
+			roots = append(roots, "name ILIKE $"+strconv.Itoa(paramIndex))
+			whereParams = append(whereParams, "%"+query.DepartmentName+"%")
+			paramIndex++
+		}
+
+		whereCondition = append(whereCondition, `m.department_id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM departments WHERE `+strings.Join(roots, " AND ")+`
+				UNION
+				SELECT c.id FROM departments c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT id FROM subtree
+		)`)
+	} else {
+		if query.DepartmentID > 0 {
+			whereCondition = append(whereCondition, "m.department_id = $"+strconv.Itoa(paramIndex))
+			whereParams = append(whereParams, query.DepartmentID)
+			paramIndex++
+		}
+
+		if len(query.DepartmentName) > 0 {
+			whereCondition = append(whereCondition, "d.name ILIKE $"+strconv.Itoa(paramIndex))
+			whereParams = append(whereParams, "%"+query.DepartmentName+"%")
+			paramIndex++
+		}
 	}
 
 	if len(query.Role) > 0 {
@@ -346,7 +907,7 @@ func (s *store) searchAllUsersByDepartment(ctx context.Context, query *departmen
 		sql.WriteString(" AND " + strings.Join(whereCondition, " AND "))
 	}
 
-	sql.WriteString(" ORDER BY u.id DESC")
+	sql.WriteString(" ORDER BY u.id DESC, m.department_id")
 
 	count, err := s.getCount(ctx, sql, whereParams)
 	if err != nil {
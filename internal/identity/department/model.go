@@ -3,6 +3,7 @@ package department
 import (
 	"task/internal/api/errors"
 	"task/internal/identity/user"
+	"time"
 )
 
 var (
@@ -10,25 +11,125 @@ var (
 	ErrDepartmentNotFound      = errors.New("department.not-found", "Department not found")
 	ErrInvalidDepartmentName   = errors.New("department.invalid-name", "Invalid department name")
 	ErrUserDepartmentNotFound  = errors.New("user.department-not-found", "User department not found")
+	ErrInvalidPatch            = errors.New("department.invalid-patch", "Invalid JSON merge patch")
+	ErrVersionConflict         = errors.New("department.version-conflict", "Department was modified by someone else, reload it and try again")
+	ErrParentNotFound          = errors.New("department.parent-not-found", "Parent department not found")
+	ErrDepartmentCycle         = errors.New("department.cycle", "A department cannot be placed under itself or one of its descendants")
+	ErrHeadNotFound            = errors.New("department.head-not-found", "Department head must be an existing active user")
+	ErrDepartmentInUse         = errors.New("department.in-use", "Department still has members, open tasks or child departments")
+	ErrInvalidDeleteStrategy   = errors.New("department.invalid-delete-strategy", "Delete strategy must be reject, move or unassign")
+	ErrTargetNotFound          = errors.New("department.target-not-found", "Target department for the members not found")
+	ErrUserAlreadyAssigned     = errors.New("department.user-already-assigned", "User is already a member of the department with this role")
+	ErrNoUsersToAssign         = errors.New("department.no-users", "No users to assign")
+	ErrTooManyUsersToAssign    = errors.New("department.too-many-users", "Too many users to assign at once")
+	ErrInvalidMembershipRole   = errors.New("department.invalid-membership-role", "Membership role must be member or lead")
+)
+
+// MembershipRole is the role of a user inside a department
+type MembershipRole string
+
+const (
+	RoleMember MembershipRole = "member"
+	RoleLead   MembershipRole = "lead"
+)
+
+// DeleteStrategy tells what happens to the current members and the tasks of
+// a deleted department. Its membership history is deleted with it in every
+// case, only the activity log keeps a trace of the deletion.
+type DeleteStrategy string
+
+const (
+	DeleteReject   DeleteStrategy = "reject"   // Members and open tasks block the deletion
+	DeleteMove     DeleteStrategy = "move"     // Members join the target department with the same role, tasks move there
+	DeleteUnassign DeleteStrategy = "unassign" // Memberships are deleted, tasks are left without department
+)
+
+// MaxBulkAssign is the most users a single bulk assignment accepts
+const MaxBulkAssign = 500
+
+// Kinds of DeletionBlocker
+const (
+	BlockerMembers  = "members"
+	BlockerChildren = "children"
+	BlockerTasks    = "tasks"
 )
 
 type Department struct {
 	ID        int    `db:"id" json:"id"`
 	Name      string `db:"name" json:"name"`
 	Location  string `db:"location" json:"location"`
+	ParentID  *int   `db:"parent_id" json:"parent_id"` // Nil for top level departments
+	HeadID    *int   `db:"head_id" json:"head_id"`     // User leading the department
 	CreatedAt string `db:"created_at" json:"created_at"`
 	UpdatedAt string `db:"updated_at" json:"updated_at"`
+	Version   int    `db:"version" json:"version"` // Incremented on every update, used as ETag
+}
+
+// DepartmentNode is a department with its sub-departments in the org tree
+type DepartmentNode struct {
+	*Department
+	Children []*DepartmentNode `json:"children"`
 }
 
 type CreateDepartmentCommand struct {
 	Name     string `json:"name"`
 	Location string `json:"location"`
+	ParentID *int   `json:"parent_id"`
 }
 
+// UpdateDepartmentCommand replaces the department. The parent only changes
+// when SetParent is true, a body without parent_id keeps it and an explicit
+// null moves the department to the top level.
 type UpdateDepartmentCommand struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Location string `json:"location"`
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Location  string `json:"location"`
+	ParentID  *int   `json:"parent_id"`
+	SetParent bool   `json:"-"` // Set when the body names parent_id
+	Version   int    `json:"-"` // Expected version from If-Match, 0 skips the check
+}
+
+// SetDepartmentHeadCommand sets the user leading a department, a nil UserID
+// leaves the department without head
+type SetDepartmentHeadCommand struct {
+	DepartmentID int  `json:"-"`
+	UserID       *int `json:"user_id"`
+}
+
+// DeleteDepartmentCommand deletes a department. Child departments block the
+// deletion unless Reparent is set, they then move to NewParentID or, when it
+// is 0, to the parent of the deleted department. Current members are handled
+// by Strategy, TargetID is the department they join with DeleteMove.
+type DeleteDepartmentCommand struct {
+	ID          int            `query:"-"`
+	Reparent    bool           `query:"reparent"`
+	NewParentID int            `query:"new_parent_id"`
+	Strategy    DeleteStrategy `query:"strategy"` // Defaults to reject
+	TargetID    int            `query:"target_id"`
+}
+
+// DeletionBlocker lists what prevents a department from being deleted, IDs
+// are users for members, departments for children and tasks for open tasks
+type DeletionBlocker struct {
+	Type string `json:"type"`
+	IDs  []int  `json:"ids"`
+}
+
+type DeleteDepartmentResult struct {
+	ID                 int                `json:"id"`
+	Blockers           []*DeletionBlocker `json:"blockers,omitempty"` // Set when the deletion was rejected
+	MovedMembers       int                `json:"moved_members"`
+	UnassignedMembers  int                `json:"unassigned_members"`
+	MovedTasks         int                `json:"moved_tasks"`
+	UnassignedTasks    int                `json:"unassigned_tasks"`
+	ReparentedChildren int                `json:"reparented_children"`
+}
+
+// PatchDepartmentCommand applies a JSON Merge Patch to the fields of UpdateDepartmentCommand
+type PatchDepartmentCommand struct {
+	ID      int
+	Patch   []byte
+	Version int // Expected version from If-Match, 0 skips the check
 }
 
 type SearchDepartmentQuery struct {
@@ -45,9 +146,58 @@ type SearchDepartmentResult struct {
 	PerPage    int           `json:"per_page"`
 }
 
+// Membership is one period a user spent in a department, LeftAt is nil while
+// it is current
+type Membership struct {
+	ID             int            `db:"id" json:"id"`
+	UserID         int            `db:"user_id" json:"user_id"`
+	DepartmentID   int            `db:"department_id" json:"department_id"`
+	DepartmentName string         `db:"department_name" json:"department_name"`
+	Role           MembershipRole `db:"role" json:"role"`
+	JoinedAt       time.Time      `db:"joined_at" json:"joined_at"`
+	LeftAt         *time.Time     `db:"left_at" json:"left_at"`
+}
+
+// AssignUserToDepartmentCommand adds the user to the department, assigning a
+// current member again with another role closes the membership and opens a
+// new one so the change stays in the history
 type AssignUserToDepartmentCommand struct {
-	UserID       int `json:"user_id"`
-	DepartmentID int `json:"department_id"`
+	UserID       int            `json:"user_id"`
+	DepartmentID int            `json:"department_id"`
+	Role         MembershipRole `json:"role"` // Defaults to member
+}
+
+// AssignUsersToDepartmentCommand assigns many users at once, either all of
+// them are assigned or none
+type AssignUsersToDepartmentCommand struct {
+	DepartmentID int            `json:"-"`
+	UserIDs      []int          `json:"user_ids"`
+	Role         MembershipRole `json:"role"` // Defaults to member
+}
+
+// AssignUsersResult tells what happened to each user, Missing and Duplicates
+// are only set when the assignment was rejected
+type AssignUsersResult struct {
+	DepartmentID int   `json:"department_id"`
+	Assigned     []int `json:"assigned"`     // New members
+	RoleChanged  []int `json:"role_changed"` // Current members given another role
+	Missing      []int `json:"missing,omitempty"`
+	Duplicates   []int `json:"duplicates,omitempty"`
+}
+
+// RemoveUserFromDepartmentCommand ends the current memberships of the user,
+// only the one in DepartmentID when it is set
+type RemoveUserFromDepartmentCommand struct {
+	UserID       int `query:"-"`
+	DepartmentID int `query:"department_id"`
+}
+
+// SearchMembershipQuery lists the memberships of a user or of a department,
+// past ones are only returned with History
+type SearchMembershipQuery struct {
+	UserID       int  `query:"-"`
+	DepartmentID int  `query:"-"`
+	History      bool `query:"history"`
 }
 
 type SearchAllUsersByDepartmentQuery struct {
@@ -64,6 +214,10 @@ type SearchAllUsersByDepartmentQuery struct {
 	DepartmentName string      `query:"department_name"`
 	Page           int         `query:"page"`
 	PerPage        int         `query:"per_page"`
+
+	// IncludeDescendants also returns users of the sub-departments of the
+	// departments matched by DepartmentID and DepartmentName
+	IncludeDescendants bool `query:"include_descendants"`
 }
 
 type SearchAllUsersByDepartmentResult struct {
@@ -78,6 +232,10 @@ func (cmd *CreateDepartmentCommand) Validate() error {
 		return ErrInvalidDepartmentName
 	}
 
+	if cmd.ParentID != nil && *cmd.ParentID <= 0 {
+		return ErrParentNotFound
+	}
+
 	return nil
 }
 
@@ -90,5 +248,110 @@ func (cmd *UpdateDepartmentCommand) Validate() error {
 		return ErrInvalidDepartmentName
 	}
 
+	if cmd.ParentID != nil && *cmd.ParentID <= 0 {
+		return ErrParentNotFound
+	}
+
+	if cmd.ParentID != nil && *cmd.ParentID == cmd.ID {
+		return ErrDepartmentCycle
+	}
+
+	return nil
+}
+
+func (cmd *SetDepartmentHeadCommand) Validate() error {
+	if cmd.DepartmentID <= 0 {
+		return ErrDepartmentNotFound
+	}
+
+	if cmd.UserID != nil && *cmd.UserID <= 0 {
+		return ErrHeadNotFound
+	}
+
+	return nil
+}
+
+func (cmd *DeleteDepartmentCommand) Validate() error {
+	if cmd.ID <= 0 {
+		return ErrDepartmentNotFound
+	}
+
+	if cmd.NewParentID < 0 || cmd.NewParentID == cmd.ID {
+		return ErrDepartmentCycle
+	}
+
+	if len(cmd.Strategy) == 0 {
+		cmd.Strategy = DeleteReject
+	}
+
+	switch cmd.Strategy {
+	case DeleteReject, DeleteUnassign:
+	case DeleteMove:
+		if cmd.TargetID <= 0 || cmd.TargetID == cmd.ID {
+			return ErrTargetNotFound
+		}
+	default:
+		return ErrInvalidDeleteStrategy
+	}
+
+	return nil
+}
+
+func (cmd *AssignUserToDepartmentCommand) Validate() error {
+	if cmd.UserID <= 0 {
+		return ErrUserDepartmentNotFound
+	}
+
+	if cmd.DepartmentID <= 0 {
+		return ErrDepartmentNotFound
+	}
+
+	if len(cmd.Role) == 0 {
+		cmd.Role = RoleMember
+	}
+
+	if cmd.Role != RoleMember && cmd.Role != RoleLead {
+		return ErrInvalidMembershipRole
+	}
+
+	return nil
+}
+
+// Validate also drops the users listed more than once
+func (cmd *AssignUsersToDepartmentCommand) Validate() error {
+	if cmd.DepartmentID <= 0 {
+		return ErrDepartmentNotFound
+	}
+
+	if len(cmd.UserIDs) == 0 {
+		return ErrNoUsersToAssign
+	}
+
+	if len(cmd.UserIDs) > MaxBulkAssign {
+		return ErrTooManyUsersToAssign
+	}
+
+	seen := make(map[int]bool, len(cmd.UserIDs))
+	userIDs := make([]int, 0, len(cmd.UserIDs))
+	for _, id := range cmd.UserIDs {
+		if id <= 0 {
+			return ErrUserDepartmentNotFound
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	cmd.UserIDs = userIDs
+
+	if len(cmd.Role) == 0 {
+		cmd.Role = RoleMember
+	}
+
+	if cmd.Role != RoleMember && cmd.Role != RoleLead {
+		return ErrInvalidMembershipRole
+	}
+
 	return nil
 }
@@ -0,0 +1,17 @@
+package invitation
+
+import "context"
+
+type Service interface {
+	// InviteUser creates a pending user and emails them a link to set a password,
+	// the invitation carries a warning when the email could not be sent
+	InviteUser(ctx context.Context, cmd *InviteUserCommand) (*Invitation, error)
+	// InviteUsers invites every user or none of them, used by bulk imports
+	InviteUsers(ctx context.Context, cmds []*InviteUserCommand) ([]*Invitation, error)
+	SearchInvitations(ctx context.Context, query *SearchInvitationQuery) (*SearchInvitationResult, error)
+	// ResendInvitation sends a new link and extends the expiry, older links stop working
+	ResendInvitation(ctx context.Context, id int) (*Invitation, error)
+	// RevokeInvitation invalidates the link and removes the pending user
+	RevokeInvitation(ctx context.Context, id int) error
+	AcceptInvitation(ctx context.Context, cmd *AcceptInvitationCommand) error
+}
@@ -0,0 +1,308 @@
+package invitationimpl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"task/config"
+	"task/internal/db"
+	"task/internal/identity/invitation"
+	"task/internal/mailer"
+	"task/pkg/util/jwt"
+	util "task/pkg/util/password"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type service struct {
+	store *store
+	cfg   *config.Config
+	log   *zap.Logger
+	db    db.DB
+}
+
+func NewService(db db.DB, cfg *config.Config) *service {
+	return &service{
+		store: NewStore(db),
+		cfg:   cfg,
+		db:    db,
+		log:   zap.L().Named("invitation.service"),
+	}
+}
+
+func (s *service) InviteUser(ctx context.Context, cmd *invitation.InviteUserCommand) (*invitation.Invitation, error) {
+	taken, err := s.store.userTaken(ctx, cmd.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if taken {
+		return nil, invitation.ErrUserAlreadyExists
+	}
+
+	if cmd.DepartmentID != nil {
+		exists, err := s.store.departmentExists(ctx, *cmd.DepartmentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			return nil, invitation.ErrDepartmentNotFound
+		}
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.store.create(ctx, cmd, nonce, time.Now().Add(s.cfg.Invitation.TTL))
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.store.getInvitationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The invitation stays pending if the mail fails. It is returned anyway,
+	// inviting again would fail since the pending user already exists.
+	err = s.send(ctx, result)
+	if err != nil {
+		s.log.Error("Failed to send invitation", zap.String("email", result.Email), zap.Error(err))
+		result.Warning = invitation.WarningNotSent
+	}
+
+	return result, nil
+}
+
+// InviteUsers creates all the invitations in one transaction, then emails
+// them. The emails must not be taken, invitations whose email could not be
+// sent carry a warning.
+func (s *service) InviteUsers(ctx context.Context, cmds []*invitation.InviteUserCommand) ([]*invitation.Invitation, error) {
+	checked := make(map[int]bool)
+
+	for _, cmd := range cmds {
+		if cmd.DepartmentID == nil || checked[*cmd.DepartmentID] {
+			continue
+		}
+
+		exists, err := s.store.departmentExists(ctx, *cmd.DepartmentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			return nil, invitation.ErrDepartmentNotFound
+		}
+
+		checked[*cmd.DepartmentID] = true
+	}
+
+	nonces := make([]string, len(cmds))
+	for i := range cmds {
+		nonce, err := randomNonce()
+		if err != nil {
+			return nil, err
+		}
+
+		nonces[i] = nonce
+	}
+
+	ids, err := s.store.createBatch(ctx, cmds, nonces, time.Now().Add(s.cfg.Invitation.TTL))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*invitation.Invitation, 0, len(ids))
+
+	for _, id := range ids {
+		result, err := s.store.getInvitationByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.send(ctx, result)
+		if err != nil {
+			s.log.Error("Failed to send invitation", zap.String("email", result.Email), zap.Error(err))
+			result.Warning = invitation.WarningNotSent
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (s *service) SearchInvitations(ctx context.Context, query *invitation.SearchInvitationQuery) (*invitation.SearchInvitationResult, error) {
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+
+	if query.PerPage <= 0 {
+		query.PerPage = 20
+	}
+
+	result, err := s.store.search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Page = query.Page
+	result.PerPage = query.PerPage
+
+	return result, nil
+}
+
+func (s *service) ResendInvitation(ctx context.Context, id int) (*invitation.Invitation, error) {
+	result, err := s.store.getInvitationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, invitation.ErrInvitationNotFound
+	}
+
+	if result.Status != invitation.StatusPending {
+		return nil, invitation.ErrInvitationNotPending
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.store.rotate(ctx, id, nonce, time.Now().Add(s.cfg.Invitation.TTL))
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, invitation.ErrInvitationNotPending
+	}
+
+	result, err = s.store.getInvitationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.send(ctx, result)
+	if err != nil {
+		s.log.Error("Failed to resend invitation", zap.String("email", result.Email), zap.Error(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *service) RevokeInvitation(ctx context.Context, id int) error {
+	result, err := s.store.getInvitationByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return invitation.ErrInvitationNotFound
+	}
+
+	if result.Status != invitation.StatusPending {
+		return invitation.ErrInvitationNotPending
+	}
+
+	return s.store.revoke(ctx, result)
+}
+
+func (s *service) AcceptInvitation(ctx context.Context, cmd *invitation.AcceptInvitationCommand) error {
+	subject, err := jwt.ValidateActionToken(cmd.Token, jwt.PurposeInvitation)
+	if err != nil {
+		return invitation.ErrInvalidInvitationToken
+	}
+
+	id, nonce, ok := parseSubject(subject)
+	if !ok {
+		return invitation.ErrInvalidInvitationToken
+	}
+
+	result, err := s.store.getInvitationByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// A resent or revoked invitation has a different nonce or status, so
+	// older links are rejected even if their signature is still valid
+	if result == nil || result.Nonce != nonce || result.Status != invitation.StatusPending || result.Expired() {
+		return invitation.ErrInvalidInvitationToken
+	}
+
+	passwordHash, err := util.HashPassword(cmd.Password)
+	if err != nil {
+		return err
+	}
+
+	return s.store.accept(ctx, result, passwordHash)
+}
+
+// send emails a signed link bound to the current nonce of the invitation. The
+// link opens the accept page, which asks for a password and posts it with the
+// token since accepting needs both.
+func (s *service) send(ctx context.Context, inv *invitation.Invitation) error {
+	ttl := time.Until(inv.ExpiresAt)
+
+	token, err := jwt.GenerateActionToken(fmt.Sprintf("%d.%s", inv.ID, inv.Nonce), jwt.PurposeInvitation, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := acceptLink(s.cfg.Invitation.AcceptURL, token)
+
+	return s.cfg.Mailer.Send(ctx, &mailer.Message{
+		To:      []string{inv.Email},
+		Subject: "You have been invited",
+		Body: fmt.Sprintf(
+			"Hello!\n\nYou have been invited to join. Open the link below to choose your password:\n\n%s\n\nThe link expires on %s.\n",
+			link,
+			inv.ExpiresAt.UTC().Format(time.RFC1123),
+		),
+	})
+}
+
+// acceptLink adds the token to the accept page URL, which may already have a
+// query string
+func acceptLink(acceptURL, token string) string {
+	separator := "?"
+	if strings.Contains(acceptURL, "?") {
+		separator = "&"
+	}
+
+	return acceptURL + separator + "token=" + url.QueryEscape(token)
+}
+
+func parseSubject(subject string) (int, string, bool) {
+	rawID, nonce, found := strings.Cut(subject, ".")
+	if !found || len(nonce) == 0 {
+		return 0, "", false
+	}
+
+	id, err := strconv.Atoi(rawID)
+	if err != nil {
+		return 0, "", false
+	}
+
+	return id, nonce, true
+}
+
+func randomNonce() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
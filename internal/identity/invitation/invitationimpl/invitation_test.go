@@ -0,0 +1,264 @@
+package invitationimpl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"task/config"
+	"task/internal/db"
+	"task/internal/identity/invitation"
+	"task/internal/mailer"
+	"task/pkg/util/jwt"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB serves one invitation and records the statements of accept
+type fakeDB struct {
+	invitation *invitation.Invitation
+	executed   []string
+}
+
+func (f *fakeDB) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	result, ok := dest.(*invitation.Invitation)
+	if !ok || f.invitation == nil || args[0] != f.invitation.ID {
+		return sql.ErrNoRows
+	}
+
+	*result = *f.invitation
+	return nil
+}
+
+func (f *fakeDB) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return errors.New("unexpected select")
+}
+
+func (f *fakeDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, errors.New("unexpected exec")
+}
+
+func (f *fakeDB) Queryx(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (db.Tx, error) {
+	return nil, errors.New("unexpected transaction")
+}
+
+func (f *fakeDB) WithTransaction(ctx context.Context, fn func(ctx context.Context, tx db.Tx) error) error {
+	return fn(ctx, &fakeTx{db: f})
+}
+
+// fakeTx updates one row per statement, like the pending rows accept expects
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (t *fakeTx) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	t.db.executed = append(t.db.executed, query)
+	return driverResult(1), nil
+}
+
+func (t *fakeTx) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (t *fakeTx) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (t *fakeTx) Commit() error   { return nil }
+func (t *fakeTx) Rollback() error { return nil }
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+// fakeMailer keeps the messages instead of sending them
+type fakeMailer struct {
+	sent []*mailer.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+func newTestService(t *testing.T, inv *invitation.Invitation) (*service, *fakeDB, *fakeMailer) {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	database := &fakeDB{invitation: inv}
+	mail := &fakeMailer{}
+
+	cfg := &config.Config{
+		AppURL: "http://localhost:8080",
+		Mailer: mail,
+	}
+	cfg.Invitation.AcceptURL = "https://app.example.com/invitations/accept"
+
+	return &service{store: NewStore(database), cfg: cfg, db: database}, database, mail
+}
+
+func pendingInvitation() *invitation.Invitation {
+	userID := 42
+
+	return &invitation.Invitation{
+		ID:        7,
+		UserID:    &userID,
+		Email:     "jane@example.com",
+		Nonce:     "current-nonce",
+		Status:    invitation.StatusPending,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+// emailedToken sends the invitation and returns the token of the link in the
+// email, after checking the link opens the accept page
+func emailedToken(t *testing.T, s *service, mail *fakeMailer, inv *invitation.Invitation) string {
+	t.Helper()
+
+	if err := s.send(context.Background(), inv); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if len(mail.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(mail.sent))
+	}
+
+	link, err := url.Parse(linkPattern.FindString(mail.sent[0].Body))
+	if err != nil {
+		t.Fatalf("invalid link: %v", err)
+	}
+
+	if page := link.Scheme + "://" + link.Host + link.Path; page != s.cfg.Invitation.AcceptURL {
+		t.Fatalf("link opens %s, want %s", page, s.cfg.Invitation.AcceptURL)
+	}
+
+	return link.Query().Get("token")
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	s, database, mail := newTestService(t, pendingInvitation())
+	token := emailedToken(t, s, mail, database.invitation)
+
+	err := s.AcceptInvitation(context.Background(), &invitation.AcceptInvitationCommand{
+		Token:    token,
+		Password: "Str0ng!Password",
+	})
+	if err != nil {
+		t.Fatalf("AcceptInvitation: %v", err)
+	}
+
+	// The invitation is accepted, then the pending user activated
+	if len(database.executed) != 2 {
+		t.Fatalf("executed %d statements, want 2", len(database.executed))
+	}
+}
+
+func TestAcceptInvitationRejected(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	otherPurpose, err := jwt.GenerateActionToken("7.current-nonce", jwt.PurposeEmailVerification, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(inv *invitation.Invitation)
+		token  func(token string) string
+	}{
+		{
+			name:   "resent",
+			change: func(inv *invitation.Invitation) { inv.Nonce = "rotated-nonce" },
+		},
+		{
+			name:   "revoked",
+			change: func(inv *invitation.Invitation) { inv.Status = invitation.StatusRevoked },
+		},
+		{
+			name:   "already accepted",
+			change: func(inv *invitation.Invitation) { inv.Status = invitation.StatusAccepted },
+		},
+		{
+			name:   "expired",
+			change: func(inv *invitation.Invitation) { inv.ExpiresAt = time.Now().Add(-time.Minute) },
+		},
+		{
+			name:   "deleted",
+			change: func(inv *invitation.Invitation) { inv.ID = 8 },
+		},
+		{
+			name:  "tampered token",
+			token: func(token string) string { return tamper(token) },
+		},
+		{
+			name:  "token for another purpose",
+			token: func(token string) string { return otherPurpose },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, database, mail := newTestService(t, pendingInvitation())
+			token := emailedToken(t, s, mail, database.invitation)
+
+			if tt.change != nil {
+				tt.change(database.invitation)
+			}
+			if tt.token != nil {
+				token = tt.token(token)
+			}
+
+			err := s.AcceptInvitation(context.Background(), &invitation.AcceptInvitationCommand{
+				Token:    token,
+				Password: "Str0ng!Password",
+			})
+			if err != invitation.ErrInvalidInvitationToken {
+				t.Fatalf("AcceptInvitation() error = %v, want ErrInvalidInvitationToken", err)
+			}
+
+			if len(database.executed) != 0 {
+				t.Fatalf("executed %d statements for a rejected invitation", len(database.executed))
+			}
+		})
+	}
+}
+
+// tamper changes the first character of the signature, the last one may only
+// hold padding bits
+func tamper(token string) string {
+	i := strings.LastIndex(token, ".") + 1
+
+	replacement := "A"
+	if token[i] == 'A' {
+		replacement = "B"
+	}
+
+	return token[:i] + replacement + token[i+1:]
+}
+
+func TestAcceptLink(t *testing.T) {
+	tests := []struct {
+		acceptURL string
+		want      string
+	}{
+		{"https://app.example.com/invitations/accept", "https://app.example.com/invitations/accept?token=a%2Bb"},
+		{"https://app.example.com/#/accept?lang=en", "https://app.example.com/#/accept?lang=en&token=a%2Bb"},
+	}
+
+	for _, tt := range tests {
+		if got := acceptLink(tt.acceptURL, "a+b"); got != tt.want {
+			t.Errorf("acceptLink(%s) = %s, want %s", tt.acceptURL, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+package invitationimpl
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"task/internal/db"
+	"task/internal/identity/invitation"
+	"task/internal/identity/user"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type store struct {
+	db     db.DB
+	logger *zap.Logger
+}
+
+func NewStore(db db.DB) *store {
+	return &store{
+		db:     db,
+		logger: zap.L().Named("invitation.store"),
+	}
+}
+
+func (s *store) userTaken(ctx context.Context, email string) (bool, error) {
+	var taken bool
+
+	err := s.db.Get(ctx, &taken, "SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)", email)
+	if err != nil {
+		return false, err
+	}
+
+	return taken, nil
+}
+
+func (s *store) departmentExists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+
+	err := s.db.Get(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM departments WHERE id = $1)", id)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// create inserts the pending user together with its invitation
+func (s *store) create(ctx context.Context, cmd *invitation.InviteUserCommand, nonce string, expiresAt time.Time) (int, error) {
+	var id int
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		var err error
+
+		id, err = insertInvitation(ctx, tx, cmd, nonce, expiresAt)
+
+		return err
+	})
+
+	return id, err
+}
+
+// createBatch inserts every invitation or none of them, nonces[i] belongs to
+// cmds[i]
+func (s *store) createBatch(ctx context.Context, cmds []*invitation.InviteUserCommand, nonces []string, expiresAt time.Time) ([]int, error) {
+	ids := make([]int, 0, len(cmds))
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		for i, cmd := range cmds {
+			id, err := insertInvitation(ctx, tx, cmd, nonces[i], expiresAt)
+			if err != nil {
+				return err
+			}
+
+			ids = append(ids, id)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func insertInvitation(ctx context.Context, tx db.Tx, cmd *invitation.InviteUserCommand, nonce string, expiresAt time.Time) (int, error) {
+	rawSQL := `
+		INSERT INTO users (
+			first_name,
+			last_name,
+			email,
+			password_hash,
+			address,
+			phone_number,
+			date_of_birth,
+			role,
+			status
+		) VALUES (
+			$1, $2, $3, '', $4, $5, NULLIF($6, '')::date, $7, $8
+		) RETURNING id
+	`
+
+	var userID int
+
+	err := tx.QueryRow(
+		ctx,
+		rawSQL,
+		cmd.FirstName,
+		cmd.LastName,
+		cmd.Email,
+		cmd.Address,
+		cmd.PhoneNumber,
+		cmd.DateOfBirth,
+		cmd.Role,
+		user.Pending,
+	).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if cmd.DepartmentID != nil {
+		rawSQL = `
+			INSERT INTO department_members (department_id, user_id)
+			VALUES ($1, $2)
+		`
+
+		_, err = tx.Exec(ctx, rawSQL, *cmd.DepartmentID, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	rawSQL = `
+		INSERT INTO user_invitations (
+			user_id,
+			email,
+			role,
+			department_id,
+			invited_by,
+			nonce,
+			expires_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7
+		) RETURNING id
+	`
+
+	var id int
+
+	err = tx.QueryRow(
+		ctx,
+		rawSQL,
+		userID,
+		cmd.Email,
+		cmd.Role,
+		cmd.DepartmentID,
+		cmd.InvitedBy,
+		nonce,
+		expiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *store) getInvitationByID(ctx context.Context, id int) (*invitation.Invitation, error) {
+	var result invitation.Invitation
+
+	rawSQL := `
+		SELECT
+			id,
+			user_id,
+			email,
+			role,
+			department_id,
+			invited_by,
+			nonce,
+			status,
+			expires_at,
+			sent_at,
+			accepted_at,
+			revoked_at,
+			created_at,
+			updated_at
+		FROM
+			user_invitations
+		WHERE
+			id = $1
+	`
+
+	err := s.db.Get(ctx, &result, rawSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *store) search(ctx context.Context, query *invitation.SearchInvitationQuery) (*invitation.SearchInvitationResult, error) {
+	var (
+		result = &invitation.SearchInvitationResult{
+			Invitations: make([]*invitation.Invitation, 0),
+		}
+		sql            bytes.Buffer
+		whereCondition = make([]string, 0)
+		whereParams    = make([]interface{}, 0)
+		paramIndex     = 1
+	)
+
+	sql.WriteString(`
+		SELECT
+			id,
+			user_id,
+			email,
+			role,
+			department_id,
+			invited_by,
+			nonce,
+			status,
+			expires_at,
+			sent_at,
+			accepted_at,
+			revoked_at,
+			created_at,
+			updated_at
+		FROM
+			user_invitations
+	`)
+
+	if len(query.Email) > 0 {
+		whereCondition = append(whereCondition, "email ILIKE $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, "%"+query.Email+"%")
+		paramIndex++
+	}
+
+	if len(query.Status) > 0 {
+		whereCondition = append(whereCondition, "status = $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, query.Status)
+		paramIndex++
+	}
+
+	if len(whereCondition) > 0 {
+		sql.WriteString(" WHERE " + strings.Join(whereCondition, " AND "))
+	}
+
+	sql.WriteString(" ORDER BY created_at DESC")
+
+	count, err := s.getCount(ctx, sql, whereParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.PerPage > 0 {
+		offset := query.PerPage * (query.Page - 1)
+		sql.WriteString(fmt.Sprintf(" LIMIT $%d OFFSET $%d", paramIndex, paramIndex+1))
+		whereParams = append(whereParams, query.PerPage, offset)
+	}
+
+	err = s.db.Select(ctx, &result.Invitations, sql.String(), whereParams...)
+	if err != nil {
+		return nil, err
+	}
+
+	result.TotalCount = count
+
+	return result, nil
+}
+
+func (s *store) getCount(ctx context.Context, sql bytes.Buffer, whereParams []interface{}) (int, error) {
+	var count int
+
+	rawSQL := "SELECT COUNT(*) FROM (" + sql.String() + ") as t1"
+
+	err := s.db.Get(ctx, &count, rawSQL, whereParams...)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// rotate replaces the nonce so links sent before stop working
+func (s *store) rotate(ctx context.Context, id int, nonce string, expiresAt time.Time) (bool, error) {
+	rawSQL := `
+		UPDATE user_invitations
+		SET
+			nonce = $1,
+			expires_at = $2,
+			sent_at = NOW(),
+			updated_at = NOW()
+		WHERE
+			id = $3 AND
+			status = 'pending'
+	`
+
+	result, err := s.db.Exec(ctx, rawSQL, nonce, expiresAt, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// revoke marks the invitation revoked and removes the user if they never accepted
+func (s *store) revoke(ctx context.Context, inv *invitation.Invitation) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE user_invitations
+			SET
+				status = 'revoked',
+				revoked_at = NOW(),
+				user_id = NULL,
+				updated_at = NOW()
+			WHERE
+				id = $1 AND
+				status = 'pending'
+		`
+
+		result, err := tx.Exec(ctx, rawSQL, inv.ID)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return invitation.ErrInvitationNotPending
+		}
+
+		if inv.UserID == nil {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM users WHERE id = $1 AND status = $2", *inv.UserID, user.Pending)
+		return err
+	})
+}
+
+// accept activates the pending user with the chosen password. The email is
+// verified since the invitee received the link.
+func (s *store) accept(ctx context.Context, inv *invitation.Invitation, passwordHash string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE user_invitations
+			SET
+				status = 'accepted',
+				accepted_at = NOW(),
+				updated_at = NOW()
+			WHERE
+				id = $1 AND
+				status = 'pending'
+		`
+
+		result, err := tx.Exec(ctx, rawSQL, inv.ID)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 || inv.UserID == nil {
+			return invitation.ErrInvalidInvitationToken
+		}
+
+		rawSQL = `
+			UPDATE users
+			SET
+				password_hash = $1,
+				status = $2,
+				email_verified_at = NOW(),
+				version = version + 1,
+				updated_at = NOW()
+			WHERE
+				id = $3 AND
+				status = $4
+		`
+
+		result, err = tx.Exec(ctx, rawSQL, passwordHash, user.Active, *inv.UserID, user.Pending)
+		if err != nil {
+			return err
+		}
+
+		affected, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return invitation.ErrInvalidInvitationToken
+		}
+
+		return nil
+	})
+}
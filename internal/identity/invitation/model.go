@@ -0,0 +1,117 @@
+package invitation
+
+import (
+	"strings"
+	"task/internal/api/errors"
+	"task/internal/identity/user"
+	util "task/pkg/util/password"
+	"task/pkg/util/validation"
+	"time"
+)
+
+var (
+	ErrInvitationNotFound     = errors.New("invitation.not-found", "Invitation not found")
+	ErrInvitationNotPending   = errors.New("invitation.not-pending", "Invitation was already accepted or revoked")
+	ErrInvalidInvitationToken = errors.New("invitation.invalid-token", "Invalid, expired or revoked invitation link")
+	ErrUserAlreadyExists      = errors.New("invitation.user-already-exists", "A user with this email already exists")
+	ErrDepartmentNotFound     = errors.New("invitation.department-not-found", "Department not found")
+)
+
+// WarningNotSent is set on an invitation that was created but could not be
+// emailed, it stays pending and can be resent
+const WarningNotSent = "The invitation was created but the email could not be sent, use resend to try again"
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusAccepted Status = "accepted"
+	StatusRevoked  Status = "revoked"
+)
+
+type Invitation struct {
+	ID           int        `db:"id" json:"id"`
+	UserID       *int       `db:"user_id" json:"user_id"`
+	Email        string     `db:"email" json:"email"`
+	Role         string     `db:"role" json:"role"`
+	DepartmentID *int       `db:"department_id" json:"department_id"`
+	InvitedBy    string     `db:"invited_by" json:"invited_by"`
+	Nonce        string     `db:"nonce" json:"-"`
+	Status       Status     `db:"status" json:"status"`
+	ExpiresAt    time.Time  `db:"expires_at" json:"expires_at"`
+	SentAt       time.Time  `db:"sent_at" json:"sent_at"`
+	AcceptedAt   *time.Time `db:"accepted_at" json:"accepted_at"`
+	RevokedAt    *time.Time `db:"revoked_at" json:"revoked_at"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+	Warning      string     `db:"-" json:"warning,omitempty"`
+}
+
+// Expired reports whether a pending invitation can no longer be accepted
+func (i *Invitation) Expired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
+
+type InviteUserCommand struct {
+	Email        string `json:"email"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Role         string `json:"role"`
+	DepartmentID *int   `json:"department_id"`
+	InvitedBy    string `json:"-"`
+
+	// Optional contact details, the invitee can fill them in later
+	Address     string `json:"address"`
+	PhoneNumber string `json:"phone_number"`
+	DateOfBirth string `json:"date_of_birth"`
+}
+
+type AcceptInvitationCommand struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type SearchInvitationQuery struct {
+	Email   string `query:"email"`
+	Status  string `query:"status"`
+	Page    int    `query:"page"`
+	PerPage int    `query:"per_page"`
+}
+
+type SearchInvitationResult struct {
+	TotalCount  int           `json:"total_count"`
+	Invitations []*Invitation `json:"result"`
+	Page        int           `json:"page"`
+	PerPage     int           `json:"per_page"`
+}
+
+// Validation for InviteUserCommand
+func (cmd *InviteUserCommand) Validate() error {
+	if len(cmd.Email) == 0 || !validation.IsValidEmail(cmd.Email) {
+		return user.ErrInvalidEmail
+	}
+	if len(strings.TrimSpace(cmd.FirstName)) == 0 || len(cmd.FirstName) <= 2 {
+		return user.ErrInvalidFirstName
+	}
+	if len(strings.TrimSpace(cmd.LastName)) == 0 || len(cmd.LastName) <= 2 {
+		return user.ErrInvalidLastName
+	}
+	if !user.IsValidRole(cmd.Role) {
+		return user.ErrorInvalidRole
+	}
+	if cmd.DepartmentID != nil && *cmd.DepartmentID <= 0 {
+		return ErrDepartmentNotFound
+	}
+	return nil
+}
+
+// Validation for AcceptInvitationCommand
+func (cmd *AcceptInvitationCommand) Validate() error {
+	if len(cmd.Token) == 0 {
+		return ErrInvalidInvitationToken
+	}
+	if len(cmd.Password) == 0 || !util.IsValidPassword(cmd.Password) {
+		return user.ErrInvalidPassword
+	}
+	return nil
+}
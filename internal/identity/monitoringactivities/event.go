@@ -0,0 +1,138 @@
+package monitoringactivities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Names of the audit events emitted by the services
+const (
+	EventRequest = "api.request" // Request that emitted no other event
+
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskDeleted   = "task.deleted"
+	EventTaskSubmitted = "task.submitted"
+	EventTaskApproved  = "task.approved"
+
+	EventUserUpdated        = "user.updated"
+	EventUserDeleted        = "user.deleted"
+	EventUserRoleChanged    = "user.role_changed"
+	EventUserManagerChanged = "user.manager_changed"
+	EventUserDeactivated    = "user.deactivated"
+	EventUserReactivated    = "user.reactivated"
+
+	EventImpersonationStarted = "impersonation.started"
+
+	EventDepartmentCreated     = "department.created"
+	EventDepartmentUpdated     = "department.updated"
+	EventDepartmentDeleted     = "department.deleted"
+	EventDepartmentHeadChanged = "department.head_changed"
+	EventMembersAssigned       = "department.members_assigned"
+	EventMemberRemoved         = "department.member_removed"
+)
+
+// Types of the audit event targets
+const (
+	TargetTask       = "task"
+	TargetUser       = "user"
+	TargetDepartment = "department"
+)
+
+// Event is a change made by a service while handling a request. Before and
+// After only keep the top level fields that differ when both are objects.
+type Event struct {
+	Name       string
+	TargetType string
+	TargetID   string
+	Before     json.RawMessage
+	After      json.RawMessage
+}
+
+type recorderKey struct{}
+
+// RecorderKey is the request local holding the Recorder of the request
+var RecorderKey = recorderKey{}
+
+// Recorder collects the events of a request until the request is done
+type Recorder struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Events() []*Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.events
+}
+
+// Record adds an event to the recorder of the request behind ctx, nothing is
+// recorded outside of a request. Before and After are marshalled to JSON,
+// nil leaves them empty.
+func Record(ctx context.Context, name, targetType string, targetID interface{}, before, after interface{}) {
+	r, ok := ctx.Value(RecorderKey).(*Recorder)
+	if !ok {
+		return
+	}
+
+	event := &Event{
+		Name:       name,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+	}
+	event.Before, event.After = diff(before, after)
+
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+// diff marshals both sides and drops the fields they have in common, values
+// that are not objects are kept whole
+func diff(before, after interface{}) (json.RawMessage, json.RawMessage) {
+	b := marshal(before)
+	a := marshal(after)
+	if b == nil || a == nil {
+		return b, a
+	}
+
+	var bm, am map[string]interface{}
+	if json.Unmarshal(b, &bm) != nil || json.Unmarshal(a, &am) != nil {
+		return b, a
+	}
+
+	for key, value := range bm {
+		if other, ok := am[key]; ok && reflect.DeepEqual(value, other) {
+			delete(bm, key)
+			delete(am, key)
+		}
+	}
+
+	return marshal(bm), marshal(am)
+}
+
+func marshal(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
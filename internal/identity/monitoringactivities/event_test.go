@@ -0,0 +1,146 @@
+package monitoringactivities
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type user struct {
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+	Admin bool   `json:"admin"`
+}
+
+func TestDiff(t *testing.T) {
+	var nilUser *user
+
+	tests := []struct {
+		name       string
+		before     interface{}
+		after      interface{}
+		wantBefore string
+		wantAfter  string
+	}{
+		{
+			name:       "changed fields only",
+			before:     &user{Name: "Jane", Role: "user"},
+			after:      &user{Name: "Jane", Role: "admin", Admin: true},
+			wantBefore: `{"role":"user","admin":false}`,
+			wantAfter:  `{"role":"admin","admin":true}`,
+		},
+		{
+			name:       "no change",
+			before:     &user{Name: "Jane"},
+			after:      &user{Name: "Jane"},
+			wantBefore: `{}`,
+			wantAfter:  `{}`,
+		},
+		{
+			name:       "nested values are compared whole",
+			before:     map[string]interface{}{"ids": []int{1, 2}, "name": "a"},
+			after:      map[string]interface{}{"ids": []int{1, 3}, "name": "a"},
+			wantBefore: `{"ids":[1,2]}`,
+			wantAfter:  `{"ids":[1,3]}`,
+		},
+		{
+			name:       "fields on one side only",
+			before:     map[string]interface{}{"a": 1},
+			after:      map[string]interface{}{"b": 1},
+			wantBefore: `{"a":1}`,
+			wantAfter:  `{"b":1}`,
+		},
+		{
+			name:      "created",
+			before:    nil,
+			after:     &user{Name: "Jane"},
+			wantAfter: `{"name":"Jane","role":"","admin":false}`,
+		},
+		{
+			name:       "deleted",
+			before:     &user{Name: "Jane"},
+			after:      nilUser,
+			wantBefore: `{"name":"Jane","role":"","admin":false}`,
+		},
+		{
+			name:       "not objects",
+			before:     []string{"a"},
+			after:      []string{"a"},
+			wantBefore: `["a"]`,
+			wantAfter:  `["a"]`,
+		},
+		{
+			name:       "object and scalar",
+			before:     map[string]int{"a": 1},
+			after:      "a",
+			wantBefore: `{"a":1}`,
+			wantAfter:  `"a"`,
+		},
+		{
+			name:       "unmarshallable",
+			before:     make(chan int),
+			after:      map[string]int{"a": 1},
+			wantBefore: ``,
+			wantAfter:  `{"a":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := diff(tt.before, tt.after)
+
+			assertJSON(t, "before", before, tt.wantBefore)
+			assertJSON(t, "after", after, tt.wantAfter)
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	// Outside of a request nothing is recorded and nothing panics
+	Record(context.Background(), EventUserUpdated, TargetUser, 1, nil, nil)
+
+	recorder := NewRecorder()
+	ctx := context.WithValue(context.Background(), RecorderKey, recorder)
+
+	Record(ctx, EventUserRoleChanged, TargetUser, 42, &user{Role: "user"}, &user{Role: "admin"})
+	Record(ctx, EventTaskDeleted, TargetTask, "7", &user{Name: "Jane"}, nil)
+
+	events := recorder.Events()
+	if len(events) != 2 {
+		t.Fatalf("len(events) = %d, want 2", len(events))
+	}
+
+	if events[0].Name != EventUserRoleChanged || events[0].TargetType != TargetUser || events[0].TargetID != "42" {
+		t.Errorf("events[0] = %s %s %s", events[0].Name, events[0].TargetType, events[0].TargetID)
+	}
+	assertJSON(t, "events[0].Before", events[0].Before, `{"role":"user"}`)
+	assertJSON(t, "events[0].After", events[0].After, `{"role":"admin"}`)
+
+	if events[1].TargetID != "7" || events[1].After != nil {
+		t.Errorf("events[1] = %s %s", events[1].TargetID, events[1].After)
+	}
+}
+
+func assertJSON(t *testing.T, what string, got json.RawMessage, want string) {
+	t.Helper()
+
+	if want == "" {
+		if got != nil {
+			t.Errorf("%s = %s, want nil", what, got)
+		}
+		return
+	}
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("%s: invalid JSON %s: %v", what, got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("%s: invalid expectation %s: %v", what, want, err)
+	}
+
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("%s = %s, want %s", what, got, want)
+	}
+}
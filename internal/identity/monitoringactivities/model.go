@@ -1,35 +1,69 @@
 package monitoringactivities
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/jmoiron/sqlx/types"
+)
 
 type ActivityLog struct {
-	ID        int    `db:"id" json:"id"`
-	UserID    string `db:"user_id" json:"user_id"`
-	Activity  string `db:"activity" json:"activity"`
-	Action    string `db:"action" json:"action"`
-	Resource  string `db:"resource" json:"resource"`
-	Details   string `db:"details" json:"details"`
-	CreatedAt string `db:"created_at" json:"created_at"`
+	ID         int             `db:"id" json:"id"`
+	UserID     string          `db:"user_id" json:"user_id"`
+	ActorID    *string         `db:"actor_id" json:"actor_id"` // Superuser impersonating UserID, if any
+	Activity   string          `db:"activity" json:"activity"`
+	Action     string          `db:"action" json:"action"`
+	Resource   string          `db:"resource" json:"resource"`
+	Details    string          `db:"details" json:"details"`
+	Event      string          `db:"event" json:"event"`
+	TargetType *string         `db:"target_type" json:"target_type"`
+	TargetID   *string         `db:"target_id" json:"target_id"`
+	Before     *types.JSONText `db:"before" json:"before"`
+	After      *types.JSONText `db:"after" json:"after"`
+	Status     *int            `db:"status" json:"status"` // HTTP status of the response
+	IP         *string         `db:"ip" json:"ip"`
+	UserAgent  *string         `db:"user_agent" json:"user_agent"`
+	RequestID  *string         `db:"request_id" json:"request_id"`
+	CreatedAt  string          `db:"created_at" json:"created_at"`
+	Seq        int64           `db:"seq" json:"seq"` // Position in the hash chain
+	PrevHash   string          `db:"prev_hash" json:"prev_hash"`
+	Hash       string          `db:"hash" json:"hash"`
 }
 
 type CreateActivityLogCommand struct {
-	UserID    string `json:"user_id"` // Change UserID to string
-	Activity  string `json:"activity"`
-	Action    string `json:"action"`
-	Resource  string `json:"resource"`
-	Details   string `json:"details"`
-	CreatedAt string `json:"created_at"`
+	UserID     string          `json:"user_id"` // Change UserID to string
+	ActorID    string          `json:"actor_id"`
+	Activity   string          `json:"activity"`
+	Action     string          `json:"action"`
+	Resource   string          `json:"resource"`
+	Details    string          `json:"details"`
+	Event      string          `json:"event"` // Defaults to EventRequest
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	Status     int             `json:"status"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  string          `json:"created_at"`
 }
 
 type SearchLogActivityQuery struct {
-	UserID    string `query:"user_id"`
-	Activity  string `query:"activity"`
-	Action    string `query:"action"`
-	Resource  string `query:"resource"`
-	Details   string `query:"details"`
-	CreatedAt string `query:"created_at"`
-	Page      int    `query:"page"`
-	PerPage   int    `query:"per_page"`
+	UserID     string `query:"user_id"`
+	ActorID    string `query:"actor_id"`
+	Activity   string `query:"activity"`
+	Action     string `query:"action"`
+	Resource   string `query:"resource"`
+	Details    string `query:"details"`
+	Event      string `query:"event"`
+	TargetType string `query:"target_type"`
+	TargetID   string `query:"target_id"`
+	RequestID  string `query:"request_id"`
+	CreatedAt  string `query:"created_at"`
+	Page       int    `query:"page"`
+	PerPage    int    `query:"per_page"`
 }
 
 type SearchLogActivityResult struct {
@@ -39,6 +73,61 @@ type SearchLogActivityResult struct {
 	PerPage    int            `json:"per_page"`
 }
 
+// QueueStats describes the queue of activities waiting to be written
+type QueueStats struct {
+	Depth    int   `json:"depth"`    // Activities waiting in the queue
+	Capacity int   `json:"capacity"` // Activities the queue holds before the full policy applies
+	Enqueued int64 `json:"enqueued"`
+	Dropped  int64 `json:"dropped"` // Queue full or closed
+	Written  int64 `json:"written"`
+	Failed   int64 `json:"failed"` // Lost because their batch could not be inserted
+	Batches  int64 `json:"batches"`
+}
+
+// GenesisHash is the previous hash of the first entry of the chain
+var GenesisHash = strings.Repeat("0", 64)
+
+// Why the verification stopped at an entry
+const (
+	BreakSeqGap         = "seq_gap"         // Entries before this one were deleted
+	BreakPrevHash       = "prev_hash"       // The entry does not link to the one before it
+	BreakHash           = "hash"            // The content of the entry was changed
+	BreakCheckpoint     = "checkpoint"      // The chain was rewritten after a checkpoint was signed
+	BreakSignature      = "signature"       // The checkpoint was not signed by the configured key
+	BreakMissingEntries = "missing_entries" // Entries after the last one were deleted
+)
+
+// Checkpoint is the signed seq and hash of the last entry at a point in time
+type Checkpoint struct {
+	ID        int    `db:"id" json:"id"`
+	Seq       int64  `db:"seq" json:"seq"`
+	Hash      string `db:"hash" json:"hash"`
+	Signature string `db:"signature" json:"signature"`
+	KeyID     string `db:"key_id" json:"key_id"`
+	CreatedAt string `db:"created_at" json:"created_at"`
+}
+
+// ChainBreak is the first entry or checkpoint that does not match the chain
+type ChainBreak struct {
+	Seq          int64  `json:"seq"`
+	ID           int    `json:"id,omitempty"`            // Entry, 0 for a checkpoint
+	CheckpointID int    `json:"checkpoint_id,omitempty"` // Checkpoint, 0 for an entry
+	Reason       string `json:"reason"`
+	Expected     string `json:"expected"`
+	Actual       string `json:"actual"`
+}
+
+type ChainVerification struct {
+	Valid    bool        `json:"valid"`
+	Checked  int64       `json:"checked"` // Entries checked before the break, or all of them
+	LastSeq  int64       `json:"last_seq"`
+	LastHash string      `json:"last_hash"`
+	Break    *ChainBreak `json:"break"`
+
+	CheckpointsVerified int `json:"checkpoints_verified"`
+	CheckpointsSkipped  int `json:"checkpoints_skipped"` // Signed by another key or no key configured
+}
+
 func (cmd *CreateActivityLogCommand) Validate() error {
 	if cmd.UserID == "" || cmd.Activity == "" || cmd.Action == "" || cmd.Resource == "" {
 		return errors.New("user_id, activity, action, and resource fields are required")
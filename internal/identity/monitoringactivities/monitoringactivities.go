@@ -7,4 +7,16 @@ import (
 type Service interface {
 	LogActivity(ctx context.Context, cmd *CreateActivityLogCommand) error
 	SearchLogActivities(ctx context.Context, query *SearchLogActivityQuery) (*SearchLogActivityResult, error)
+
+	// Enqueue hands the activity to the background writer instead of writing
+	// it right away, it returns false when the activity was dropped
+	Enqueue(cmd *CreateActivityLogCommand) bool
+	QueueStats() *QueueStats
+
+	// Close writes the queued activities and stops the background writer
+	Close(ctx context.Context) error
+
+	// VerifyChain walks the hash chain of the activities and reports the
+	// first entry or checkpoint that does not match
+	VerifyChain(ctx context.Context) (*ChainVerification, error)
 }
@@ -0,0 +1,140 @@
+package monitoringactivitiesimpl
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"task/internal/identity/monitoringactivities"
+)
+
+// chainPageSize is the number of entries read at once while verifying
+const chainPageSize = 1000
+
+// chainHash is the hash of an entry as computed by the activity_logs_chain
+// trigger
+func chainHash(prevHash, payload string) string {
+	sum := sha256.Sum256([]byte(prevHash + payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyChain walks the chain from the first entry and stops at the first
+// entry or checkpoint that does not match. Checkpoints are only trusted when
+// signed by key, the others are skipped.
+func verifyChain(ctx context.Context, store *store, key ed25519.PublicKey) (*monitoringactivities.ChainVerification, error) {
+	result := &monitoringactivities.ChainVerification{
+		LastHash: monitoringactivities.GenesisHash,
+	}
+
+	checkpoints, err := store.getCheckpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var id string
+	if key != nil {
+		id = keyID(key)
+	}
+
+	// Drop the checkpoints that cannot be trusted, a bad signature from the
+	// current key is a break on its own
+	trusted := make([]*monitoringactivities.Checkpoint, 0, len(checkpoints))
+	for _, checkpoint := range checkpoints {
+		if key == nil || checkpoint.KeyID != id {
+			result.CheckpointsSkipped++
+			continue
+		}
+
+		if !verifyCheckpoint(key, checkpoint) {
+			result.Break = &monitoringactivities.ChainBreak{
+				Seq:          checkpoint.Seq,
+				CheckpointID: checkpoint.ID,
+				Reason:       monitoringactivities.BreakSignature,
+				Expected:     id,
+				Actual:       checkpoint.Signature,
+			}
+			return result, nil
+		}
+
+		trusted = append(trusted, checkpoint)
+	}
+
+	next := 0 // First trusted checkpoint not reached yet
+
+	for {
+		links, err := store.getChainLinks(ctx, result.LastSeq, chainPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, link := range links {
+			if link.Seq != result.LastSeq+1 {
+				result.Break = linkBreak(link, monitoringactivities.BreakSeqGap, strconv.FormatInt(result.LastSeq+1, 10), strconv.FormatInt(link.Seq, 10))
+				return result, nil
+			}
+
+			if link.PrevHash != result.LastHash {
+				result.Break = linkBreak(link, monitoringactivities.BreakPrevHash, result.LastHash, link.PrevHash)
+				return result, nil
+			}
+
+			hash := chainHash(link.PrevHash, link.Payload)
+			if link.Hash != hash {
+				result.Break = linkBreak(link, monitoringactivities.BreakHash, hash, link.Hash)
+				return result, nil
+			}
+
+			for next < len(trusted) && trusted[next].Seq == link.Seq {
+				if trusted[next].Hash != link.Hash {
+					result.Break = &monitoringactivities.ChainBreak{
+						Seq:          link.Seq,
+						ID:           link.ID,
+						CheckpointID: trusted[next].ID,
+						Reason:       monitoringactivities.BreakCheckpoint,
+						Expected:     trusted[next].Hash,
+						Actual:       link.Hash,
+					}
+					return result, nil
+				}
+
+				result.CheckpointsVerified++
+				next++
+			}
+
+			result.Checked++
+			result.LastSeq = link.Seq
+			result.LastHash = link.Hash
+		}
+
+		if len(links) < chainPageSize {
+			break
+		}
+	}
+
+	// A checkpoint past the last entry means the end of the chain was cut
+	if next < len(trusted) {
+		result.Break = &monitoringactivities.ChainBreak{
+			Seq:          trusted[next].Seq,
+			CheckpointID: trusted[next].ID,
+			Reason:       monitoringactivities.BreakMissingEntries,
+			Expected:     trusted[next].Hash,
+			Actual:       result.LastHash,
+		}
+		return result, nil
+	}
+
+	result.Valid = true
+
+	return result, nil
+}
+
+func linkBreak(link *chainLink, reason, expected, actual string) *monitoringactivities.ChainBreak {
+	return &monitoringactivities.ChainBreak{
+		Seq:      link.Seq,
+		ID:       link.ID,
+		Reason:   reason,
+		Expected: expected,
+		Actual:   actual,
+	}
+}
@@ -0,0 +1,421 @@
+package monitoringactivitiesimpl
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"task/internal/db"
+	"task/internal/identity/monitoringactivities"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// fakeDB keeps the chain and the checkpoints in memory and answers the
+// queries of the store that verifyChain and the checkpointer use
+type fakeDB struct {
+	links       []*chainLink
+	checkpoints []*monitoringactivities.Checkpoint
+}
+
+func (f *fakeDB) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	switch dest := dest.(type) {
+	case *[]*chainLink:
+		afterSeq, limit := args[0].(int64), args[1].(int)
+		for _, link := range f.links {
+			if link.Seq > afterSeq && len(*dest) < limit {
+				copied := *link
+				*dest = append(*dest, &copied)
+			}
+		}
+		return nil
+
+	case *[]*monitoringactivities.Checkpoint:
+		if strings.Contains(query, "activity_log_checkpoints") {
+			checkpoints := append([]*monitoringactivities.Checkpoint(nil), f.checkpoints...)
+			sort.SliceStable(checkpoints, func(i, j int) bool {
+				return checkpoints[i].Seq < checkpoints[j].Seq
+			})
+			for _, checkpoint := range checkpoints {
+				copied := *checkpoint
+				*dest = append(*dest, &copied)
+			}
+			return nil
+		}
+
+		if len(f.links) > 0 {
+			last := f.links[len(f.links)-1]
+			*dest = append(*dest, &monitoringactivities.Checkpoint{Seq: last.Seq, Hash: last.Hash})
+		}
+		return nil
+	}
+
+	return errors.New("unexpected select")
+}
+
+func (f *fakeDB) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	seq, ok := dest.(*int64)
+	if !ok {
+		return errors.New("unexpected get")
+	}
+
+	*seq = 0
+	for _, checkpoint := range f.checkpoints {
+		if checkpoint.Seq > *seq {
+			*seq = checkpoint.Seq
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	f.checkpoints = append(f.checkpoints, &monitoringactivities.Checkpoint{
+		ID:        len(f.checkpoints) + 1,
+		Seq:       args[0].(int64),
+		Hash:      args[1].(string),
+		Signature: args[2].(string),
+		KeyID:     args[3].(string),
+	})
+
+	return nil, nil
+}
+
+func (f *fakeDB) Queryx(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (db.Tx, error) {
+	return nil, errors.New("unexpected transaction")
+}
+
+func (f *fakeDB) WithTransaction(ctx context.Context, fn func(ctx context.Context, tx db.Tx) error) error {
+	return errors.New("unexpected transaction")
+}
+
+// buildChain returns n entries linked the way the trigger links them
+func buildChain(n int) []*chainLink {
+	links := make([]*chainLink, n)
+	for i := range links {
+		links[i] = &chainLink{
+			ID:      100 + i,
+			Seq:     int64(i + 1),
+			Payload: "entry " + strconv.Itoa(i+1),
+		}
+	}
+
+	relink(links, 0)
+
+	return links
+}
+
+// relink recomputes the hashes from index from, as someone rewriting the
+// chain would
+func relink(links []*chainLink, from int) {
+	for i := from; i < len(links); i++ {
+		links[i].PrevHash = monitoringactivities.GenesisHash
+		if i > 0 {
+			links[i].PrevHash = links[i-1].Hash
+		}
+		links[i].Hash = chainHash(links[i].PrevHash, links[i].Payload)
+	}
+}
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func newTestCheckpointer(f *fakeDB, key ed25519.PrivateKey) *checkpointer {
+	return &checkpointer{
+		store: NewStore(f),
+		key:   key,
+		log:   zap.NewNop(),
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	key := newKey(t)
+	otherKey := newKey(t)
+
+	// signAt adds a checkpoint of the current chain at seq
+	signAt := func(f *fakeDB, key ed25519.PrivateKey, seq int64) {
+		links := f.links
+		f.links = links[:seq]
+		newTestCheckpointer(f, key).checkpoint()
+		f.links = links
+	}
+
+	tests := []struct {
+		name         string
+		size         int
+		setup        func(f *fakeDB)
+		noKey        bool
+		wantValid    bool
+		wantReason   string
+		wantSeq      int64
+		wantChecked  int64
+		wantVerified int
+		wantSkipped  int
+	}{
+		{
+			name:      "empty chain",
+			wantValid: true,
+		},
+		{
+			name:        "valid chain without checkpoints",
+			size:        5,
+			wantValid:   true,
+			wantChecked: 5,
+		},
+		{
+			name: "valid chain with checkpoints",
+			size: 5,
+			setup: func(f *fakeDB) {
+				signAt(f, key, 2)
+				signAt(f, key, 5)
+			},
+			wantValid:    true,
+			wantChecked:  5,
+			wantVerified: 2,
+		},
+		{
+			name: "chain over several pages",
+			size: 2*chainPageSize + 1,
+			setup: func(f *fakeDB) {
+				signAt(f, key, chainPageSize)
+				signAt(f, key, 2*chainPageSize+1)
+			},
+			wantValid:    true,
+			wantChecked:  2*chainPageSize + 1,
+			wantVerified: 2,
+		},
+		{
+			name: "checkpoints of another key are skipped",
+			size: 5,
+			setup: func(f *fakeDB) {
+				signAt(f, otherKey, 2)
+				signAt(f, key, 4)
+			},
+			wantValid:    true,
+			wantChecked:  5,
+			wantVerified: 1,
+			wantSkipped:  1,
+		},
+		{
+			name: "checkpoints are skipped without a key",
+			size: 5,
+			setup: func(f *fakeDB) {
+				signAt(f, key, 3)
+			},
+			noKey:       true,
+			wantValid:   true,
+			wantChecked: 5,
+			wantSkipped: 1,
+		},
+		{
+			name: "edited entry",
+			size: 5,
+			setup: func(f *fakeDB) {
+				f.links[2].Payload = "edited"
+			},
+			wantReason:  monitoringactivities.BreakHash,
+			wantSeq:     3,
+			wantChecked: 2,
+		},
+		{
+			name: "deleted entry",
+			size: 5,
+			setup: func(f *fakeDB) {
+				f.links = append(f.links[:2], f.links[3:]...)
+			},
+			wantReason:  monitoringactivities.BreakSeqGap,
+			wantSeq:     4,
+			wantChecked: 2,
+		},
+		{
+			name: "deleted first entry",
+			size: 3,
+			setup: func(f *fakeDB) {
+				f.links = f.links[1:]
+			},
+			wantReason: monitoringactivities.BreakSeqGap,
+			wantSeq:    2,
+		},
+		{
+			name: "entry linked to the wrong previous entry",
+			size: 5,
+			setup: func(f *fakeDB) {
+				f.links[3].PrevHash = f.links[1].Hash
+				f.links[3].Hash = chainHash(f.links[3].PrevHash, f.links[3].Payload)
+			},
+			wantReason:  monitoringactivities.BreakPrevHash,
+			wantSeq:     4,
+			wantChecked: 3,
+		},
+		{
+			name: "rewritten chain before a checkpoint",
+			size: 5,
+			setup: func(f *fakeDB) {
+				signAt(f, key, 4)
+				f.links[1].Payload = "edited"
+				relink(f.links, 1)
+			},
+			wantReason:  monitoringactivities.BreakCheckpoint,
+			wantSeq:     4,
+			wantChecked: 3,
+		},
+		{
+			name: "rewritten chain after the last checkpoint",
+			size: 5,
+			setup: func(f *fakeDB) {
+				signAt(f, key, 2)
+				f.links[3].Payload = "edited"
+				relink(f.links, 3)
+			},
+			wantValid:    true,
+			wantChecked:  5,
+			wantVerified: 1,
+		},
+		{
+			name: "truncated chain",
+			size: 5,
+			setup: func(f *fakeDB) {
+				signAt(f, key, 5)
+				f.links = f.links[:3]
+			},
+			wantReason:  monitoringactivities.BreakMissingEntries,
+			wantSeq:     5,
+			wantChecked: 3,
+		},
+		{
+			name: "tampered checkpoint",
+			size: 5,
+			setup: func(f *fakeDB) {
+				signAt(f, key, 3)
+				f.checkpoints[0].Hash = f.links[1].Hash
+			},
+			wantReason: monitoringactivities.BreakSignature,
+			wantSeq:    3,
+		},
+		{
+			name: "checkpoint with an invalid signature",
+			size: 5,
+			setup: func(f *fakeDB) {
+				signAt(f, key, 3)
+				f.checkpoints[0].Signature = "not base64!"
+			},
+			wantReason: monitoringactivities.BreakSignature,
+			wantSeq:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeDB{links: buildChain(tt.size)}
+			if tt.setup != nil {
+				tt.setup(f)
+			}
+
+			var public ed25519.PublicKey
+			if !tt.noKey {
+				public = key.Public().(ed25519.PublicKey)
+			}
+
+			result, err := verifyChain(context.Background(), NewStore(f), public)
+			if err != nil {
+				t.Fatalf("verifyChain: %v", err)
+			}
+
+			if result.Valid != tt.wantValid {
+				t.Fatalf("Valid = %v, want %v (break %+v)", result.Valid, tt.wantValid, result.Break)
+			}
+
+			if tt.wantValid {
+				if result.Break != nil {
+					t.Errorf("Break = %+v, want nil", result.Break)
+				}
+			} else {
+				if result.Break == nil {
+					t.Fatal("Break = nil")
+				}
+				if result.Break.Reason != tt.wantReason || result.Break.Seq != tt.wantSeq {
+					t.Errorf("Break = %s at %d, want %s at %d", result.Break.Reason, result.Break.Seq, tt.wantReason, tt.wantSeq)
+				}
+			}
+
+			if result.Checked != tt.wantChecked {
+				t.Errorf("Checked = %d, want %d", result.Checked, tt.wantChecked)
+			}
+			if result.CheckpointsVerified != tt.wantVerified {
+				t.Errorf("CheckpointsVerified = %d, want %d", result.CheckpointsVerified, tt.wantVerified)
+			}
+			if result.CheckpointsSkipped != tt.wantSkipped {
+				t.Errorf("CheckpointsSkipped = %d, want %d", result.CheckpointsSkipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	key := newKey(t)
+	f := &fakeDB{}
+	c := newTestCheckpointer(f, key)
+
+	// Nothing to sign yet
+	c.checkpoint()
+	if len(f.checkpoints) != 0 {
+		t.Fatalf("len(checkpoints) = %d, want 0", len(f.checkpoints))
+	}
+
+	f.links = buildChain(3)
+	c.checkpoint()
+	c.checkpoint() // The head did not move, nothing new to sign
+
+	if len(f.checkpoints) != 1 {
+		t.Fatalf("len(checkpoints) = %d, want 1", len(f.checkpoints))
+	}
+
+	checkpoint := f.checkpoints[0]
+	if checkpoint.Seq != 3 || checkpoint.Hash != f.links[2].Hash {
+		t.Errorf("checkpoint = %d %s, want 3 %s", checkpoint.Seq, checkpoint.Hash, f.links[2].Hash)
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+	if checkpoint.KeyID != keyID(public) {
+		t.Errorf("KeyID = %s, want %s", checkpoint.KeyID, keyID(public))
+	}
+	if !verifyCheckpoint(public, checkpoint) {
+		t.Error("checkpoint signature does not verify")
+	}
+	if verifyCheckpoint(newKey(t).Public().(ed25519.PublicKey), checkpoint) {
+		t.Error("checkpoint verifies with another key")
+	}
+
+	f.links = buildChain(4)
+	c.checkpoint()
+
+	if len(f.checkpoints) != 2 || f.checkpoints[1].Seq != 4 {
+		t.Fatalf("checkpoints = %+v, want a second one at seq 4", f.checkpoints)
+	}
+}
+
+func TestCheckpointerDisabled(t *testing.T) {
+	c := newCheckpointer(NewStore(&fakeDB{}), nil, 0)
+
+	if err := c.close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package monitoringactivitiesimpl
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"task/internal/identity/monitoringactivities"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// checkpointTimeout bounds the writing of a single checkpoint
+const checkpointTimeout = 10 * time.Second
+
+// checkpointMessage is what gets signed, the seq and hash of the last entry
+func checkpointMessage(seq int64, hash string) []byte {
+	return []byte("activity_logs:" + strconv.FormatInt(seq, 10) + ":" + hash)
+}
+
+// keyID is a short fingerprint of the public key, so checkpoints signed
+// before a key rotation are recognised
+func keyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkpointer signs the head of the chain every interval from a background
+// goroutine, it does nothing when no signing key is configured
+type checkpointer struct {
+	store    *store
+	key      ed25519.PrivateKey
+	interval time.Duration
+	log      *zap.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newCheckpointer(store *store, key ed25519.PrivateKey, interval time.Duration) *checkpointer {
+	c := &checkpointer{
+		store:    store,
+		key:      key,
+		interval: interval,
+		log:      zap.L().Named("monitoringactivities.checkpointer"),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if key == nil {
+		c.log.Warn("ACTIVITY_LOG_SIGNING_KEY is not set, activity log checkpoints are disabled")
+		close(c.done)
+		return c
+	}
+
+	go c.run()
+
+	return c
+}
+
+func (c *checkpointer) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkpoint()
+		case <-c.stop:
+			// Sign what the queue wrote while draining
+			c.checkpoint()
+			return
+		}
+	}
+}
+
+// checkpoint signs the head of the chain unless it was already signed
+func (c *checkpointer) checkpoint() {
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+
+	head, err := c.store.getChainHead(ctx)
+	if err != nil {
+		c.log.Error("Failed to read the head of the activity log chain", zap.Error(err))
+		return
+	}
+
+	if head == nil {
+		return
+	}
+
+	lastSeq, err := c.store.getLastCheckpointSeq(ctx)
+	if err != nil {
+		c.log.Error("Failed to read the last activity log checkpoint", zap.Error(err))
+		return
+	}
+
+	if head.Seq <= lastSeq {
+		return
+	}
+
+	head.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(c.key, checkpointMessage(head.Seq, head.Hash)))
+	head.KeyID = keyID(c.key.Public().(ed25519.PublicKey))
+
+	err = c.store.createCheckpoint(ctx, head)
+	if err != nil {
+		c.log.Error("Failed to write activity log checkpoint", zap.Int64("seq", head.Seq), zap.Error(err))
+	}
+}
+
+// close writes a last checkpoint and waits for the goroutine or ctx
+func (c *checkpointer) close(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// verifyCheckpoint reports whether the checkpoint was signed by key
+func verifyCheckpoint(key ed25519.PublicKey, checkpoint *monitoringactivities.Checkpoint) bool {
+	signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+	if err != nil {
+		return false
+	}
+
+	return ed25519.Verify(key, checkpointMessage(checkpoint.Seq, checkpoint.Hash), signature)
+}
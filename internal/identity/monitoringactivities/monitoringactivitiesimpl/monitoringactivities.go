@@ -2,6 +2,7 @@ package monitoringactivitiesimpl
 
 import (
 	"context"
+	"crypto/ed25519"
 	"task/config"
 	"task/internal/db"
 	"task/internal/identity/monitoringactivities"
@@ -10,18 +11,26 @@ import (
 )
 
 type service struct {
-	store *store
-	db    db.DB
-	cfg   *config.Config
-	log   *zap.Logger
+	store        *store
+	queue        *queue
+	checkpointer *checkpointer
+	db           db.DB
+	cfg          *config.Config
+	log          *zap.Logger
 }
 
+// NewService starts the background writer of the activity queue and the
+// checkpointer of the hash chain, Close stops them
 func NewService(db db.DB, cfg *config.Config) *service {
+	store := NewStore(db)
+
 	return &service{
-		store: NewStore(db),
-		db:    db,
-		cfg:   cfg,
-		log:   zap.L().Named("monitoringactivities.service"),
+		store:        store,
+		queue:        newQueue(store, cfg.ActivityLog),
+		checkpointer: newCheckpointer(store, cfg.ActivityLog.SigningKey, cfg.ActivityLog.CheckpointInterval),
+		db:           db,
+		cfg:          cfg,
+		log:          zap.L().Named("monitoringactivities.service"),
 	}
 }
 
@@ -36,6 +45,33 @@ func (s *service) LogActivity(ctx context.Context, cmd *monitoringactivities.Cre
 	})
 }
 
+func (s *service) Enqueue(cmd *monitoringactivities.CreateActivityLogCommand) bool {
+	return s.queue.enqueue(cmd)
+}
+
+func (s *service) QueueStats() *monitoringactivities.QueueStats {
+	return s.queue.stats()
+}
+
+// Close drains the queue first so the last checkpoint covers it
+func (s *service) Close(ctx context.Context) error {
+	err := s.queue.close(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.checkpointer.close(ctx)
+}
+
+func (s *service) VerifyChain(ctx context.Context) (*monitoringactivities.ChainVerification, error) {
+	var key ed25519.PublicKey
+	if s.cfg.ActivityLog.SigningKey != nil {
+		key = s.cfg.ActivityLog.SigningKey.Public().(ed25519.PublicKey)
+	}
+
+	return verifyChain(ctx, s.store, key)
+}
+
 func (s *service) SearchLogActivities(ctx context.Context, query *monitoringactivities.SearchLogActivityQuery) (*monitoringactivities.SearchLogActivityResult, error) {
 	if query.Page <= 0 {
 		query.Page = s.cfg.Pagination.Page
@@ -0,0 +1,175 @@
+package monitoringactivitiesimpl
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"task/config"
+	"task/internal/identity/monitoringactivities"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// batchTimeout bounds the INSERT of a single batch
+const batchTimeout = 10 * time.Second
+
+// queue buffers activities in memory and writes them in batches from a
+// single background goroutine, so requests do not wait for the database.
+type queue struct {
+	store   *store
+	cfg     config.ActivityLogConfig
+	log     *zap.Logger
+	entries chan *monitoringactivities.CreateActivityLogCommand
+
+	stop chan struct{} // Closed by close to ask the writer to drain and exit
+	done chan struct{} // Closed by the writer once everything is written
+
+	// Held for reading while an entry is sent, so none can be sent after the
+	// writer was told to drain
+	mu     sync.RWMutex
+	closed bool
+
+	enqueued atomic.Int64
+	dropped  atomic.Int64
+	written  atomic.Int64
+	failed   atomic.Int64
+	batches  atomic.Int64
+}
+
+func newQueue(store *store, cfg config.ActivityLogConfig) *queue {
+	q := &queue{
+		store:   store,
+		cfg:     cfg,
+		log:     zap.L().Named("monitoringactivities.queue"),
+		entries: make(chan *monitoringactivities.CreateActivityLogCommand, cfg.QueueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go q.run()
+
+	return q
+}
+
+// enqueue applies the full policy when there is no room left, it never
+// blocks longer than the configured timeout
+func (q *queue) enqueue(cmd *monitoringactivities.CreateActivityLogCommand) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case q.entries <- cmd:
+		q.enqueued.Add(1)
+		return true
+	default:
+	}
+
+	if q.cfg.FullPolicy == config.ActivityLogBlock {
+		timer := time.NewTimer(q.cfg.BlockTimeout)
+		defer timer.Stop()
+
+		select {
+		case q.entries <- cmd:
+			q.enqueued.Add(1)
+			return true
+		case <-timer.C:
+		}
+	}
+
+	q.dropped.Add(1)
+	return false
+}
+
+func (q *queue) run() {
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*monitoringactivities.CreateActivityLogCommand, 0, q.cfg.BatchSize)
+
+	for {
+		select {
+		case cmd := <-q.entries:
+			batch = append(batch, cmd)
+			if len(batch) >= q.cfg.BatchSize {
+				batch = q.flush(batch)
+			}
+		case <-ticker.C:
+			batch = q.flush(batch)
+		case <-q.stop:
+			// Nothing is added once closed is set, write what is left
+			for {
+				select {
+				case cmd := <-q.entries:
+					batch = append(batch, cmd)
+					if len(batch) >= q.cfg.BatchSize {
+						batch = q.flush(batch)
+					}
+				default:
+					q.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes the batch and returns it emptied for reuse, a failed batch
+// is logged and counted but not retried
+func (q *queue) flush(batch []*monitoringactivities.CreateActivityLogCommand) []*monitoringactivities.CreateActivityLogCommand {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), batchTimeout)
+	defer cancel()
+
+	err := q.store.createBatch(ctx, batch)
+	if err != nil {
+		q.failed.Add(int64(len(batch)))
+		q.log.Error("Failed to write activity batch", zap.Int("size", len(batch)), zap.Error(err))
+	} else {
+		q.written.Add(int64(len(batch)))
+	}
+	q.batches.Add(1)
+
+	clear(batch)
+	return batch[:0]
+}
+
+// close stops accepting activities and waits until the queued ones are
+// written or ctx is done
+func (q *queue) close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *queue) stats() *monitoringactivities.QueueStats {
+	return &monitoringactivities.QueueStats{
+		Depth:    len(q.entries),
+		Capacity: cap(q.entries),
+		Enqueued: q.enqueued.Load(),
+		Dropped:  q.dropped.Load(),
+		Written:  q.written.Load(),
+		Failed:   q.failed.Load(),
+		Batches:  q.batches.Load(),
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"task/internal/db"
 	"task/internal/identity/monitoringactivities"
 
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -26,43 +27,146 @@ func NewStore(db db.DB) *store {
 
 // create logs the activity into the activity_logs table
 func (s *store) create(ctx context.Context, cmd *monitoringactivities.CreateActivityLogCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
-		rawSQL := `
-			INSERT INTO activity_logs (
-				user_id,
-				activity,
-				action,
-				resource,
-				details,
-				created_at
-			)VALUES (
-				$1,
-				$2,
-				$3,
-				$4,
-				$5,
-				$6
-			) RETURNING id
-		`
-
-		var id int
-
-		err := tx.QueryRow(
-			ctx,
-			rawSQL,
-			cmd.UserID,
-			cmd.Activity,
-			cmd.Action,
-			cmd.Resource,
-			cmd.Details,
-			cmd.CreatedAt,
-		).Scan(&id)
-		if err != nil {
-			return err
-		}
+	return s.createBatch(ctx, []*monitoringactivities.CreateActivityLogCommand{cmd})
+}
+
+// createBatch inserts the activities with a single statement
+func (s *store) createBatch(ctx context.Context, cmds []*monitoringactivities.CreateActivityLogCommand) error {
+	var (
+		userIDs     = make([]string, len(cmds))
+		actorIDs    = make([]string, len(cmds))
+		activities  = make([]string, len(cmds))
+		actions     = make([]string, len(cmds))
+		resources   = make([]string, len(cmds))
+		details     = make([]string, len(cmds))
+		events      = make([]string, len(cmds))
+		targetTypes = make([]string, len(cmds))
+		targetIDs   = make([]string, len(cmds))
+		before      = make([]string, len(cmds))
+		after       = make([]string, len(cmds))
+		statuses    = make([]int64, len(cmds))
+		ips         = make([]string, len(cmds))
+		userAgents  = make([]string, len(cmds))
+		requestIDs  = make([]string, len(cmds))
+		createdAt   = make([]string, len(cmds))
+	)
+
+	for i, cmd := range cmds {
+		userIDs[i] = cmd.UserID
+		actorIDs[i] = cmd.ActorID
+		activities[i] = cmd.Activity
+		actions[i] = cmd.Action
+		resources[i] = cmd.Resource
+		details[i] = cmd.Details
+		events[i] = cmd.Event
+		targetTypes[i] = cmd.TargetType
+		targetIDs[i] = cmd.TargetID
+		before[i] = string(cmd.Before)
+		after[i] = string(cmd.After)
+		statuses[i] = int64(cmd.Status)
+		ips[i] = cmd.IP
+		userAgents[i] = cmd.UserAgent
+		requestIDs[i] = cmd.RequestID
+		createdAt[i] = cmd.CreatedAt
+	}
 
-		return nil
-	})
+	// Empty strings and a 0 status are stored as NULL
+	rawSQL := `
+		INSERT INTO activity_logs (
+			user_id,
+			actor_id,
+			activity,
+			action,
+			resource,
+			details,
+			event,
+			target_type,
+			target_id,
+			before,
+			after,
+			status,
+			ip,
+			user_agent,
+			request_id,
+			created_at
+		)
+		SELECT
+			user_id,
+			NULLIF(actor_id, ''),
+			activity,
+			action,
+			resource,
+			details,
+			COALESCE(NULLIF(event, ''), $17),
+			NULLIF(target_type, ''),
+			NULLIF(target_id, ''),
+			NULLIF(before, '')::jsonb,
+			NULLIF(after, '')::jsonb,
+			NULLIF(status, 0),
+			NULLIF(ip, ''),
+			NULLIF(user_agent, ''),
+			NULLIF(request_id, ''),
+			created_at::timestamp
+		FROM unnest(
+			$1::text[],
+			$2::text[],
+			$3::text[],
+			$4::text[],
+			$5::text[],
+			$6::text[],
+			$7::text[],
+			$8::text[],
+			$9::text[],
+			$10::text[],
+			$11::text[],
+			$12::int[],
+			$13::text[],
+			$14::text[],
+			$15::text[],
+			$16::text[]
+		) AS t(
+			user_id,
+			actor_id,
+			activity,
+			action,
+			resource,
+			details,
+			event,
+			target_type,
+			target_id,
+			before,
+			after,
+			status,
+			ip,
+			user_agent,
+			request_id,
+			created_at
+		)
+	`
+
+	_, err := s.db.Exec(
+		ctx,
+		rawSQL,
+		pq.Array(userIDs),
+		pq.Array(actorIDs),
+		pq.Array(activities),
+		pq.Array(actions),
+		pq.Array(resources),
+		pq.Array(details),
+		pq.Array(events),
+		pq.Array(targetTypes),
+		pq.Array(targetIDs),
+		pq.Array(before),
+		pq.Array(after),
+		pq.Array(statuses),
+		pq.Array(ips),
+		pq.Array(userAgents),
+		pq.Array(requestIDs),
+		pq.Array(createdAt),
+		monitoringactivities.EventRequest,
+	)
+
+	return err
 }
 
 func (s *store) search(ctx context.Context, query *monitoringactivities.SearchLogActivityQuery) (*monitoringactivities.SearchLogActivityResult, error) {
@@ -80,11 +184,24 @@ func (s *store) search(ctx context.Context, query *monitoringactivities.SearchLo
 		SELECT
 			id,
 			user_id,
+			actor_id,
 			activity,
 			action,
 			resource,
 			details,
-			created_at
+			event,
+			target_type,
+			target_id,
+			before,
+			after,
+			status,
+			ip,
+			user_agent,
+			request_id,
+			created_at,
+			seq,
+			prev_hash,
+			hash
 		FROM
 			activity_logs
 	`)
@@ -95,12 +212,42 @@ func (s *store) search(ctx context.Context, query *monitoringactivities.SearchLo
 		paramIndex++
 	}
 
+	if len(query.ActorID) > 0 {
+		whereCondition = append(whereCondition, "actor_id = $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, query.ActorID)
+		paramIndex++
+	}
+
 	if len(query.Activity) > 0 {
 		whereCondition = append(whereCondition, "activity = $"+strconv.Itoa(paramIndex))
 		whereParams = append(whereParams, query.Activity)
 		paramIndex++
 	}
 
+	if len(query.Event) > 0 {
+		whereCondition = append(whereCondition, "event = $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, query.Event)
+		paramIndex++
+	}
+
+	if len(query.TargetType) > 0 {
+		whereCondition = append(whereCondition, "target_type = $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, query.TargetType)
+		paramIndex++
+	}
+
+	if len(query.TargetID) > 0 {
+		whereCondition = append(whereCondition, "target_id = $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, query.TargetID)
+		paramIndex++
+	}
+
+	if len(query.RequestID) > 0 {
+		whereCondition = append(whereCondition, "request_id = $"+strconv.Itoa(paramIndex))
+		whereParams = append(whereParams, query.RequestID)
+		paramIndex++
+	}
+
 	if len(whereCondition) > 0 {
 		sql.WriteString(" WHERE " + strings.Join(whereCondition, " AND "))
 	}
@@ -128,6 +275,138 @@ func (s *store) search(ctx context.Context, query *monitoringactivities.SearchLo
 	return result, nil
 }
 
+// chainLink is an entry of the hash chain with the content its hash covers
+type chainLink struct {
+	ID       int    `db:"id"`
+	Seq      int64  `db:"seq"`
+	PrevHash string `db:"prev_hash"`
+	Hash     string `db:"hash"`
+	Payload  string `db:"payload"`
+}
+
+// getChainLinks returns up to limit entries after seq in chain order
+func (s *store) getChainLinks(ctx context.Context, afterSeq int64, limit int) ([]*chainLink, error) {
+	links := make([]*chainLink, 0)
+
+	rawSQL := `
+		SELECT
+			a.id,
+			a.seq,
+			a.prev_hash,
+			a.hash,
+			activity_log_payload(a) AS payload
+		FROM
+			activity_logs a
+		WHERE
+			a.seq > $1
+		ORDER BY
+			a.seq
+		LIMIT $2
+	`
+
+	err := s.db.Select(ctx, &links, rawSQL, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// getChainHead returns the last entry of the chain, nil when it is empty
+func (s *store) getChainHead(ctx context.Context) (*monitoringactivities.Checkpoint, error) {
+	heads := make([]*monitoringactivities.Checkpoint, 0, 1)
+
+	rawSQL := `
+		SELECT
+			seq,
+			hash
+		FROM
+			activity_logs
+		ORDER BY
+			seq DESC
+		LIMIT 1
+	`
+
+	err := s.db.Select(ctx, &heads, rawSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(heads) == 0 {
+		return nil, nil
+	}
+
+	return heads[0], nil
+}
+
+func (s *store) createCheckpoint(ctx context.Context, checkpoint *monitoringactivities.Checkpoint) error {
+	rawSQL := `
+		INSERT INTO activity_log_checkpoints (
+			seq,
+			hash,
+			signature,
+			key_id
+		) VALUES (
+			$1,
+			$2,
+			$3,
+			$4
+		)
+	`
+
+	_, err := s.db.Exec(
+		ctx,
+		rawSQL,
+		checkpoint.Seq,
+		checkpoint.Hash,
+		checkpoint.Signature,
+		checkpoint.KeyID,
+	)
+
+	return err
+}
+
+// getCheckpoints returns every checkpoint in chain order
+func (s *store) getCheckpoints(ctx context.Context) ([]*monitoringactivities.Checkpoint, error) {
+	checkpoints := make([]*monitoringactivities.Checkpoint, 0)
+
+	rawSQL := `
+		SELECT
+			id,
+			seq,
+			hash,
+			signature,
+			key_id,
+			created_at
+		FROM
+			activity_log_checkpoints
+		ORDER BY
+			seq,
+			id
+	`
+
+	err := s.db.Select(ctx, &checkpoints, rawSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoints, nil
+}
+
+// getLastCheckpointSeq returns 0 when there is no checkpoint yet
+func (s *store) getLastCheckpointSeq(ctx context.Context) (int64, error) {
+	var seq int64
+
+	rawSQL := "SELECT COALESCE(MAX(seq), 0) FROM activity_log_checkpoints"
+
+	err := s.db.Get(ctx, &seq, rawSQL)
+	if err != nil {
+		return 0, err
+	}
+
+	return seq, nil
+}
+
 func (s *store) getCount(ctx context.Context, sql bytes.Buffer, whereParams []interface{}) (int, error) {
 	var count int
 
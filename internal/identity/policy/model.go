@@ -0,0 +1,106 @@
+package policy
+
+import (
+	"slices"
+	"task/internal/api/errors"
+	"task/internal/identity/user"
+	"time"
+)
+
+var (
+	ErrForbidden        = errors.New("policy.forbidden", "You are not allowed to perform this action on this resource")
+	ErrResourceNotFound = errors.New("policy.resource-not-found", "Resource not found")
+)
+
+const (
+	ResourceUser       = "user"
+	ResourceTask       = "task"
+	ResourceDepartment = "department"
+)
+
+// Principal is the authenticated user a decision is made for
+type Principal struct {
+	UserID      int      `json:"user_id"`
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	ActorID     string   `json:"actor_id,omitempty"` // Superuser impersonating the principal
+	Timezone    string   `json:"timezone"`
+}
+
+// Location is the timezone dates are rendered in for the principal
+func (p *Principal) Location() *time.Location {
+	return user.LoadLocation(p.Timezone)
+}
+
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range p.Roles {
+		for _, wanted := range roles {
+			if role == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Resource is the target of an action. Handlers only fill Type and ID, the
+// service resolves the remaining attributes before the rules are evaluated.
+type Resource struct {
+	Type string
+	ID   int
+
+	OwnerID           int   // The user itself for users, the assignee for tasks, none for departments
+	DepartmentIDs     []int // Current departments of a user, the department of a task or of its assignee when it has none, the department itself for departments
+	DepartmentHeadIDs []int // Heads of the departments above
+
+	Changes []string // Guarded fields the request changes, set by the handler
+}
+
+// Changing reports whether the request changes the field
+func (r *Resource) Changing(field string) bool {
+	return slices.Contains(r.Changes, field)
+}
+
+func User(id int) *Resource {
+	return &Resource{Type: ResourceUser, ID: id}
+}
+
+func Task(id int) *Resource {
+	return &Resource{Type: ResourceTask, ID: id}
+}
+
+func Department(id int) *Resource {
+	return &Resource{Type: ResourceDepartment, ID: id}
+}
+
+// Subject holds the attributes of the principal that rules can look at
+type Subject struct {
+	*Principal
+	DepartmentIDs []int // Current departments of the principal
+}
+
+// InDepartment checks if the principal shares a department with the resource
+func (s *Subject) InDepartment(r *Resource) bool {
+	for _, id := range s.DepartmentIDs {
+		if slices.Contains(r.DepartmentIDs, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// HeadsDepartmentOf checks if the principal heads one of the departments of
+// the resource
+func (s *Subject) HeadsDepartmentOf(r *Resource) bool {
+	return slices.Contains(r.DepartmentHeadIDs, s.UserID)
+}
+
+// Rule grants an action on a resource type when Allow returns true. Actions
+// without rules are decided by the role permissions alone.
+type Rule struct {
+	Action      string
+	Resource    string
+	Description string
+	Allow       func(s *Subject, r *Resource) bool
+}
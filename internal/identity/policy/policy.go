@@ -0,0 +1,9 @@
+package policy
+
+import "context"
+
+type Service interface {
+	// Authorize returns ErrForbidden unless one of the rules for the action
+	// allows the principal to act on the resource.
+	Authorize(ctx context.Context, principal *Principal, action string, resource *Resource) error
+}
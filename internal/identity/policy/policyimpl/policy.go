@@ -0,0 +1,73 @@
+package policyimpl
+
+import (
+	"context"
+	"task/config"
+	"task/internal/db"
+	"task/internal/identity/policy"
+
+	"go.uber.org/zap"
+)
+
+type service struct {
+	store *store
+	cfg   *config.Config
+	log   *zap.Logger
+	rules map[string][]*policy.Rule // Keyed by resource type and action
+}
+
+func NewService(db db.DB, cfg *config.Config) *service {
+	byAction := make(map[string][]*policy.Rule)
+	for _, rule := range rules {
+		key := rule.Resource + "/" + rule.Action
+		byAction[key] = append(byAction[key], rule)
+	}
+
+	return &service{
+		store: NewStore(db),
+		cfg:   cfg,
+		log:   zap.L().Named("policy.service"),
+		rules: byAction,
+	}
+}
+
+func (s *service) Authorize(ctx context.Context, principal *policy.Principal, action string, resource *policy.Resource) error {
+	rules := s.rules[resource.Type+"/"+action]
+	if len(rules) == 0 {
+		return nil
+	}
+
+	found, err := s.store.resolve(ctx, resource)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return policy.ErrResourceNotFound
+	}
+
+	departmentIDs, err := s.store.getUserDepartments(ctx, principal.UserID)
+	if err != nil {
+		return err
+	}
+
+	subject := &policy.Subject{
+		Principal:     principal,
+		DepartmentIDs: departmentIDs,
+	}
+
+	for _, rule := range rules {
+		if rule.Allow(subject, resource) {
+			return nil
+		}
+	}
+
+	s.log.Info("Action denied by policy",
+		zap.String("email", principal.Email),
+		zap.String("action", action),
+		zap.String("resource", resource.Type),
+		zap.Int("resource_id", resource.ID),
+	)
+
+	return policy.ErrForbidden
+}
@@ -0,0 +1,201 @@
+package policyimpl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"task/internal/db"
+	"task/internal/identity/accesscontrol"
+	"task/internal/identity/policy"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type fakeTask struct {
+	ownerID      int
+	departmentID *int
+}
+
+// fakeDB answers the lookups of the store from an in-memory organisation
+type fakeDB struct {
+	users       map[int]bool
+	tasks       map[int]fakeTask
+	heads       map[int]int   // Head of each department, 0 for none
+	memberships map[int][]int // Current departments of each user
+}
+
+func (f *fakeDB) department(id int) departmentHead {
+	d := departmentHead{ID: id}
+	if head := f.heads[id]; head != 0 {
+		d.HeadID = sql.NullInt64{Int64: int64(head), Valid: true}
+	}
+	return d
+}
+
+func (f *fakeDB) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	id := args[0].(int)
+
+	switch dest := dest.(type) {
+	case *int:
+		if !f.users[id] {
+			return sql.ErrNoRows
+		}
+		*dest = id
+
+	case *taskOwner:
+		task, ok := f.tasks[id]
+		if !ok {
+			return sql.ErrNoRows
+		}
+		dest.OwnerID = task.ownerID
+		if task.departmentID != nil {
+			dest.DepartmentID = sql.NullInt64{Int64: int64(*task.departmentID), Valid: true}
+		}
+
+	case *sql.NullInt64:
+		if _, ok := f.heads[id]; !ok {
+			return sql.ErrNoRows
+		}
+		*dest = f.department(id).HeadID
+
+	default:
+		return errors.New("unexpected get")
+	}
+
+	return nil
+}
+
+func (f *fakeDB) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	switch dest := dest.(type) {
+	case *[]int:
+		*dest = f.memberships[args[0].(int)]
+
+	case *[]departmentHead:
+		if strings.Contains(query, "department_members") {
+			for _, id := range f.memberships[args[0].(int)] {
+				*dest = append(*dest, f.department(id))
+			}
+			return nil
+		}
+
+		id := int(args[0].(int64))
+		if _, ok := f.heads[id]; ok {
+			*dest = append(*dest, f.department(id))
+		}
+
+	default:
+		return errors.New("unexpected select")
+	}
+
+	return nil
+}
+
+func (f *fakeDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, errors.New("unexpected exec")
+}
+
+func (f *fakeDB) Queryx(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (db.Tx, error) {
+	return nil, errors.New("unexpected transaction")
+}
+
+func (f *fakeDB) WithTransaction(ctx context.Context, fn func(ctx context.Context, tx db.Tx) error) error {
+	return errors.New("unexpected transaction")
+}
+
+func TestAuthorizeTasks(t *testing.T) {
+	sales, support := 10, 20
+
+	// Users 1 and 2 manage sales and support, user 3 works in sales, user 4
+	// heads support and user 5 is in both
+	database := &fakeDB{
+		users: map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true},
+		heads: map[int]int{sales: 0, support: 4},
+		memberships: map[int][]int{
+			1: {sales},
+			2: {support},
+			3: {sales},
+			4: {support},
+			5: {sales, support},
+		},
+		tasks: map[int]fakeTask{
+			100: {ownerID: 3, departmentID: &sales},   // Sales task of a sales member
+			200: {ownerID: 3, departmentID: &support}, // Support task assigned to a sales member
+			300: {ownerID: 3},                         // No department, follows the assignee
+			400: {ownerID: 5, departmentID: &support},
+		},
+	}
+
+	s := NewService(database, nil)
+
+	manager := func(id int) *policy.Principal {
+		return &policy.Principal{UserID: id, Roles: []string{accesscontrol.RoleManager}}
+	}
+	member := func(id int) *policy.Principal {
+		return &policy.Principal{UserID: id, Roles: []string{accesscontrol.RoleUser}}
+	}
+
+	tests := []struct {
+		name      string
+		principal *policy.Principal
+		action    string
+		taskID    int
+		want      error
+	}{
+		{"manager of the task department", manager(1), accesscontrol.PermTasksUpdate, 100, nil},
+		{"manager of another department", manager(2), accesscontrol.PermTasksUpdate, 100, policy.ErrForbidden},
+		{"manager of the task department, not of the assignee", manager(2), accesscontrol.PermTasksUpdate, 200, nil},
+		{"manager of the assignee, not of the task department", manager(1), accesscontrol.PermTasksUpdate, 200, policy.ErrForbidden},
+		{"task without department, manager of the assignee", manager(1), accesscontrol.PermTasksUpdate, 300, nil},
+		{"task without department, other manager", manager(2), accesscontrol.PermTasksUpdate, 300, policy.ErrForbidden},
+		{"assignee", member(3), accesscontrol.PermTasksUpdate, 200, nil},
+		{"head of the task department", member(4), accesscontrol.PermTasksApprove, 200, nil},
+		{"head of the task department, member elsewhere", member(4), accesscontrol.PermTasksApprove, 400, nil},
+		{"head of another department", member(4), accesscontrol.PermTasksApprove, 100, policy.ErrForbidden},
+		{"missing task", manager(1), accesscontrol.PermTasksUpdate, 999, policy.ErrResourceNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Authorize(context.Background(), tt.principal, tt.action, policy.Task(tt.taskID))
+			if err != tt.want {
+				t.Errorf("Authorize() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeDepartmentDashboard(t *testing.T) {
+	database := &fakeDB{
+		users:       map[int]bool{1: true, 2: true, 3: true},
+		heads:       map[int]int{10: 2, 20: 0},
+		memberships: map[int][]int{1: {10}, 3: {20}},
+	}
+
+	s := NewService(database, nil)
+
+	tests := []struct {
+		name      string
+		principal *policy.Principal
+		want      error
+	}{
+		{"member", &policy.Principal{UserID: 1}, nil},
+		{"head outside the members", &policy.Principal{UserID: 2}, nil},
+		{"member of another department", &policy.Principal{UserID: 3}, policy.ErrForbidden},
+		{"admin", &policy.Principal{UserID: 3, Roles: []string{accesscontrol.RoleAdmin}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Authorize(context.Background(), tt.principal, accesscontrol.PermTasksRead, policy.Department(10))
+			if err != tt.want {
+				t.Errorf("Authorize() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
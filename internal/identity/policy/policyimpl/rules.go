@@ -0,0 +1,121 @@
+package policyimpl
+
+import (
+	"task/internal/identity/accesscontrol"
+	"task/internal/identity/policy"
+)
+
+var rules = []*policy.Rule{
+	{
+		Action:      accesscontrol.PermUsersUpdate,
+		Resource:    policy.ResourceUser,
+		Description: "Users may update their own profile, not their email",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.UserID == r.OwnerID && !r.Changing("email")
+		},
+	},
+	{
+		Action:      accesscontrol.PermUsersUpdate,
+		Resource:    policy.ResourceUser,
+		Description: "Superusers, admins and HR may update any profile",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HasRole(accesscontrol.RoleSuperUser, accesscontrol.RoleAdmin, accesscontrol.RoleHR)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksUpdate,
+		Resource:    policy.ResourceTask,
+		Description: "Users may edit the tasks assigned to them, not their status or assignee",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.UserID == r.OwnerID
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksUpdate,
+		Resource:    policy.ResourceTask,
+		Description: "Managers may update tasks in their department",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HasRole(accesscontrol.RoleManager) && s.InDepartment(r)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksUpdate,
+		Resource:    policy.ResourceTask,
+		Description: "Superusers and admins may update any task",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HasRole(accesscontrol.RoleSuperUser, accesscontrol.RoleAdmin)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksCreate,
+		Resource:    policy.ResourceUser,
+		Description: "Managers may assign new tasks to users in their department",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HasRole(accesscontrol.RoleManager) && s.InDepartment(r)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksCreate,
+		Resource:    policy.ResourceUser,
+		Description: "Superusers and admins may assign tasks to anyone",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HasRole(accesscontrol.RoleSuperUser, accesscontrol.RoleAdmin)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksSubmit,
+		Resource:    policy.ResourceTask,
+		Description: "Only the assignee may submit a task",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.UserID == r.OwnerID
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksApprove,
+		Resource:    policy.ResourceTask,
+		Description: "Managers may approve tasks in their department",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HasRole(accesscontrol.RoleManager) && s.InDepartment(r)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksApprove,
+		Resource:    policy.ResourceTask,
+		Description: "Department heads may approve tasks of the other members of their department",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HeadsDepartmentOf(r) && s.UserID != r.OwnerID
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksApprove,
+		Resource:    policy.ResourceTask,
+		Description: "Superusers and admins may approve any task",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HasRole(accesscontrol.RoleSuperUser, accesscontrol.RoleAdmin)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksRead,
+		Resource:    policy.ResourceDepartment,
+		Description: "Members may read the task figures of their department",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.InDepartment(r)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksRead,
+		Resource:    policy.ResourceDepartment,
+		Description: "Department heads may read the task figures of their department",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HeadsDepartmentOf(r)
+		},
+	},
+	{
+		Action:      accesscontrol.PermTasksRead,
+		Resource:    policy.ResourceDepartment,
+		Description: "Superusers and admins may read the task figures of any department",
+		Allow: func(s *policy.Subject, r *policy.Resource) bool {
+			return s.HasRole(accesscontrol.RoleSuperUser, accesscontrol.RoleAdmin)
+		},
+	},
+}
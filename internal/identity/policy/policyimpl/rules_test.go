@@ -0,0 +1,58 @@
+package policyimpl
+
+import (
+	"task/internal/identity/accesscontrol"
+	"task/internal/identity/policy"
+	"testing"
+)
+
+// allowed evaluates the rules the way Authorize does once the resource and
+// the subject are resolved
+func allowed(action string, s *policy.Subject, r *policy.Resource) bool {
+	for _, rule := range rules {
+		if rule.Resource == r.Type && rule.Action == action && rule.Allow(s, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func subject(id int, departmentIDs []int, roles ...string) *policy.Subject {
+	return &policy.Subject{
+		Principal:     &policy.Principal{UserID: id, Roles: roles},
+		DepartmentIDs: departmentIDs,
+	}
+}
+
+func TestUserUpdateRules(t *testing.T) {
+	self := func(changes ...string) *policy.Resource {
+		return &policy.Resource{Type: policy.ResourceUser, ID: 1, OwnerID: 1, Changes: changes}
+	}
+	other := func(changes ...string) *policy.Resource {
+		return &policy.Resource{Type: policy.ResourceUser, ID: 2, OwnerID: 2, Changes: changes}
+	}
+
+	tests := []struct {
+		name     string
+		subject  *policy.Subject
+		resource *policy.Resource
+		want     bool
+	}{
+		{"own profile", subject(1, nil, accesscontrol.RoleUser), self(), true},
+		{"own email", subject(1, nil, accesscontrol.RoleUser), self("email"), false},
+		{"own email as manager", subject(1, nil, accesscontrol.RoleManager), self("email"), false},
+		{"another profile", subject(1, nil, accesscontrol.RoleUser), other(), false},
+		{"another profile as manager", subject(1, nil, accesscontrol.RoleManager), other(), false},
+		{"another email as admin", subject(1, nil, accesscontrol.RoleAdmin), other("email"), true},
+		{"own email as hr", subject(1, nil, accesscontrol.RoleHR), self("email"), true},
+		{"own email as superuser", subject(1, nil, accesscontrol.RoleSuperUser), self("email"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowed(accesscontrol.PermUsersUpdate, tt.subject, tt.resource); got != tt.want {
+				t.Errorf("allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
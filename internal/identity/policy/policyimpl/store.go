@@ -0,0 +1,188 @@
+package policyimpl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"task/internal/db"
+	"task/internal/identity/policy"
+
+	"go.uber.org/zap"
+)
+
+type store struct {
+	db     db.DB
+	logger *zap.Logger
+}
+
+func NewStore(db db.DB) *store {
+	return &store{
+		db:     db,
+		logger: zap.L().Named("policy.store"),
+	}
+}
+
+func (s *store) getUserDepartments(ctx context.Context, userID int) ([]int, error) {
+	var departmentIDs []int
+
+	rawSQL := `
+		SELECT department_id
+		FROM department_members
+		WHERE
+			user_id = $1 AND
+			left_at IS NULL
+	`
+
+	err := s.db.Select(ctx, &departmentIDs, rawSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return departmentIDs, nil
+}
+
+// departmentHead is a department a resource belongs to and its head
+type departmentHead struct {
+	ID     int           `db:"id"`
+	HeadID sql.NullInt64 `db:"head_id"`
+}
+
+// taskOwner is the assignee of a task and the department it belongs to
+type taskOwner struct {
+	OwnerID      int           `db:"owner_id"`
+	DepartmentID sql.NullInt64 `db:"department_id"`
+}
+
+// resolve loads the owner and departments of a resource, it returns false if
+// the resource does not exist.
+func (s *store) resolve(ctx context.Context, resource *policy.Resource) (bool, error) {
+	switch resource.Type {
+	case policy.ResourceUser:
+		return s.resolveUser(ctx, resource)
+	case policy.ResourceTask:
+		return s.resolveTask(ctx, resource)
+	case policy.ResourceDepartment:
+		return s.resolveDepartment(ctx, resource)
+	}
+
+	return false, nil
+}
+
+// resolveUser uses the current departments of the user
+func (s *store) resolveUser(ctx context.Context, resource *policy.Resource) (bool, error) {
+	var ownerID int
+
+	err := s.db.Get(ctx, &ownerID, "SELECT id FROM users WHERE id = $1", resource.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	departments, err := s.getMemberDepartments(ctx, ownerID)
+	if err != nil {
+		return false, err
+	}
+
+	resource.OwnerID = ownerID
+	setDepartments(resource, departments)
+
+	return true, nil
+}
+
+// resolveTask uses the department the task belongs to, the departments of the
+// assignee only stand in for tasks without one
+func (s *store) resolveTask(ctx context.Context, resource *policy.Resource) (bool, error) {
+	var task taskOwner
+
+	rawSQL := `
+		SELECT
+			user_id AS owner_id,
+			department_id
+		FROM tasks
+		WHERE id = $1
+	`
+
+	err := s.db.Get(ctx, &task, rawSQL, resource.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var departments []departmentHead
+
+	if task.DepartmentID.Valid {
+		err = s.db.Select(ctx, &departments, "SELECT id, head_id FROM departments WHERE id = $1", task.DepartmentID.Int64)
+	} else {
+		departments, err = s.getMemberDepartments(ctx, task.OwnerID)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	resource.OwnerID = task.OwnerID
+	setDepartments(resource, departments)
+
+	return true, nil
+}
+
+// getMemberDepartments returns the current departments of a user
+func (s *store) getMemberDepartments(ctx context.Context, userID int) ([]departmentHead, error) {
+	var departments []departmentHead
+
+	rawSQL := `
+		SELECT
+			d.id,
+			d.head_id
+		FROM department_members m
+		JOIN departments d ON d.id = m.department_id
+		WHERE
+			m.user_id = $1 AND
+			m.left_at IS NULL
+	`
+
+	err := s.db.Select(ctx, &departments, rawSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return departments, nil
+}
+
+func setDepartments(resource *policy.Resource, departments []departmentHead) {
+	resource.DepartmentIDs = make([]int, 0, len(departments))
+	resource.DepartmentHeadIDs = make([]int, 0, len(departments))
+
+	for _, d := range departments {
+		resource.DepartmentIDs = append(resource.DepartmentIDs, d.ID)
+		if d.HeadID.Valid {
+			resource.DepartmentHeadIDs = append(resource.DepartmentHeadIDs, int(d.HeadID.Int64))
+		}
+	}
+}
+
+// resolveDepartment treats the department as its own single department, so
+// the same subject checks apply to its members and head
+func (s *store) resolveDepartment(ctx context.Context, resource *policy.Resource) (bool, error) {
+	var headID sql.NullInt64
+
+	err := s.db.Get(ctx, &headID, "SELECT head_id FROM departments WHERE id = $1", resource.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	resource.DepartmentIDs = []int{resource.ID}
+	resource.DepartmentHeadIDs = make([]int, 0, 1)
+
+	if headID.Valid {
+		resource.DepartmentHeadIDs = append(resource.DepartmentHeadIDs, int(headID.Int64))
+	}
+
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package rest
+
+import (
+	"task/internal/api/errors"
+	"task/internal/api/response"
+	"task/internal/identity/accesstoken"
+	"task/internal/identity/user"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type accessTokenHandler struct {
+	s accesstoken.Service
+}
+
+func NewAccessTokenHandler(s accesstoken.Service) *accessTokenHandler {
+	return &accessTokenHandler{
+		s: s,
+	}
+}
+
+func (h *accessTokenHandler) CreateToken(ctx *fiber.Ctx) error {
+	var cmd accesstoken.CreateAccessTokenCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	cmd.Email = ctx.Locals("userID").(string)
+
+	result, err := h.s.CreateToken(ctx.Context(), &cmd)
+	if err != nil {
+		return accessTokenError(err)
+	}
+
+	return response.Created(ctx, fiber.Map{
+		"token": result,
+	})
+}
+
+func (h *accessTokenHandler) ListTokens(ctx *fiber.Ctx) error {
+	result, err := h.s.ListTokens(ctx.Context(), ctx.Locals("userID").(string))
+	if err != nil {
+		return accessTokenError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"tokens": result,
+	})
+}
+
+func (h *accessTokenHandler) RevokeToken(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	if err := h.s.RevokeToken(ctx.Context(), ctx.Locals("userID").(string), id); err != nil {
+		return accessTokenError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "access token revoked successfully!",
+	})
+}
+
+func accessTokenError(err error) error {
+	switch err {
+	case accesstoken.ErrTokenNotFound, user.ErrUserNotFound:
+		return errors.ErrorNotFound(err)
+	case accesstoken.ErrTokenNameTaken:
+		return errors.ErrorWithCode(err, fiber.StatusConflict)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
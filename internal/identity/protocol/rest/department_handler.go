@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"encoding/json"
 	"strconv"
 	"task/internal/api/errors"
 	"task/internal/api/response"
@@ -31,7 +32,7 @@ func (h *departmentHandler) CreateDepartment(ctx *fiber.Ctx) error {
 	}
 
 	if err := h.s.CreateDepartment(ctx.Context(), &cmd); err != nil {
-		return errors.ErrorInternalServerError(err)
+		return hierarchyError(err)
 	}
 
 	return response.Created(ctx, fiber.Map{
@@ -46,12 +47,26 @@ func (h *departmentHandler) UpdateDepartment(ctx *fiber.Ctx) error {
 		return errors.ErrorBadRequest(err)
 	}
 
+	// A null parent_id moves the department to the top level, leaving it out
+	// keeps the current parent
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(ctx.Body(), &fields); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+	_, cmd.SetParent = fields["parent_id"]
+
 	if err := cmd.Validate(); err != nil {
 		return errors.ErrorBadRequest(err)
 	}
 
+	version, err := response.IfMatchVersion(ctx)
+	if err != nil {
+		return err
+	}
+	cmd.Version = version
+
 	if err := h.s.UpdateDepartment(ctx.Context(), &cmd); err != nil {
-		return errors.ErrorInternalServerError(err)
+		return hierarchyError(err)
 	}
 
 	return response.Ok(ctx, fiber.Map{
@@ -67,6 +82,34 @@ func (h *departmentHandler) GetDepartmentByID(ctx *fiber.Ctx) error {
 		return errors.ErrorInternalServerError(err)
 	}
 
+	response.SetETag(ctx, result.Version)
+
+	return response.Ok(ctx, fiber.Map{
+		"department": result,
+	})
+}
+
+// PatchDepartment applies a JSON Merge Patch, an If-Match header makes the
+// update fail with 412 when the department changed since it was read.
+func (h *departmentHandler) PatchDepartment(ctx *fiber.Ctx) error {
+	var cmd department.PatchDepartmentCommand
+
+	cmd.ID, _ = ctx.ParamsInt("id")
+	cmd.Patch = ctx.Body()
+
+	version, err := response.IfMatchVersion(ctx)
+	if err != nil {
+		return err
+	}
+	cmd.Version = version
+
+	result, err := h.s.PatchDepartment(ctx.Context(), &cmd)
+	if err != nil {
+		return patchError(err, department.ErrDepartmentNotFound, department.ErrVersionConflict, department.ErrDepartmentAlreadyExists)
+	}
+
+	response.SetETag(ctx, result.Version)
+
 	return response.Ok(ctx, fiber.Map{
 		"department": result,
 	})
@@ -89,18 +132,93 @@ func (h *departmentHandler) SearchDepartment(ctx *fiber.Ctx) error {
 	})
 }
 
+// DeleteDepartment refuses to delete a department with sub-departments
+// unless ?reparent=true, optionally with ?new_parent_id=, says where they go.
+// Members and open tasks block it too unless ?strategy=unassign or
+// ?strategy=move with ?target_id=, the 409 response lists the blockers. The
+// memberships of the department, past ones included, are deleted with it.
 func (h *departmentHandler) DeleteDepartment(ctx *fiber.Ctx) error {
-	id, _ := ctx.ParamsInt("id")
+	var cmd department.DeleteDepartmentCommand
+
+	if err := ctx.QueryParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
 
-	if err := h.s.DeleteDepartment(ctx.Context(), id); err != nil {
+	cmd.ID, _ = ctx.ParamsInt("id")
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	result, err := h.s.DeleteDepartment(ctx.Context(), &cmd)
+	if err != nil {
+		if err == department.ErrDepartmentInUse {
+			return errors.NewApiError(err, fiber.StatusConflict, err.Error(), fiber.Map{
+				"code":     department.ErrDepartmentInUse.Code,
+				"blockers": result.Blockers,
+			})
+		}
+		return hierarchyError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"department deleted successfully!": result,
+	})
+}
+
+func (h *departmentHandler) SetDepartmentHead(ctx *fiber.Ctx) error {
+	var cmd department.SetDepartmentHeadCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.DepartmentID, _ = ctx.ParamsInt("id")
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	result, err := h.s.SetDepartmentHead(ctx.Context(), &cmd)
+	if err != nil {
+		return hierarchyError(err)
+	}
+
+	response.SetETag(ctx, result.Version)
+
+	return response.Ok(ctx, fiber.Map{
+		"department": result,
+	})
+}
+
+func (h *departmentHandler) GetDepartmentTree(ctx *fiber.Ctx) error {
+	result, err := h.s.GetDepartmentTree(ctx.Context())
+	if err != nil {
 		return errors.ErrorInternalServerError(err)
 	}
 
 	return response.Ok(ctx, fiber.Map{
-		"department deleted successfully!": id,
+		"departments": result,
 	})
 }
 
+// hierarchyError maps the errors raised when departments are placed in or
+// removed from the tree
+func hierarchyError(err error) error {
+	switch err {
+	case department.ErrDepartmentNotFound:
+		return errors.ErrorWithCode(err, fiber.StatusNotFound)
+	case department.ErrParentNotFound, department.ErrDepartmentCycle, department.ErrHeadNotFound, department.ErrTargetNotFound:
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	case department.ErrDepartmentAlreadyExists:
+		return errors.ErrorWithCode(err, fiber.StatusConflict)
+	case department.ErrVersionConflict:
+		return errors.ErrorWithCode(err, fiber.StatusPreconditionFailed)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
+
 func (h *departmentHandler) AssignUserToDepartment(ctx *fiber.Ctx) error {
 	var cmd department.AssignUserToDepartmentCommand
 
@@ -108,14 +226,69 @@ func (h *departmentHandler) AssignUserToDepartment(ctx *fiber.Ctx) error {
 		return errors.ErrorBadRequest(err)
 	}
 
+	if err := cmd.Validate(); err != nil {
+		return membershipError(err)
+	}
+
 	if err := h.s.AssignUserToDepartment(ctx.Context(), &cmd); err != nil {
-		return errors.ErrorInternalServerError(err)
+		return membershipError(err)
 	}
 	return response.Ok(ctx, fiber.Map{
 		"department assigned to user successfully!": cmd,
 	})
 }
 
+// AssignUsersToDepartment assigns every user of the body or none, the error
+// data lists the users that were missing or already members
+func (h *departmentHandler) AssignUsersToDepartment(ctx *fiber.Ctx) error {
+	var cmd department.AssignUsersToDepartmentCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.DepartmentID, _ = ctx.ParamsInt("id")
+
+	if err := cmd.Validate(); err != nil {
+		return membershipError(err)
+	}
+
+	result, err := h.s.AssignUsersToDepartment(ctx.Context(), &cmd)
+	if err != nil {
+		switch err {
+		case department.ErrUserDepartmentNotFound:
+			return errors.NewApiError(err, fiber.StatusNotFound, err.Error(), fiber.Map{
+				"code":     department.ErrUserDepartmentNotFound.Code,
+				"user_ids": result.Missing,
+			})
+		case department.ErrUserAlreadyAssigned:
+			return errors.NewApiError(err, fiber.StatusConflict, err.Error(), fiber.Map{
+				"code":     department.ErrUserAlreadyAssigned.Code,
+				"user_ids": result.Duplicates,
+			})
+		}
+		return membershipError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"users assigned to department successfully!": result,
+	})
+}
+
+// membershipError maps the errors raised when users join a department
+func membershipError(err error) error {
+	switch err {
+	case department.ErrDepartmentNotFound, department.ErrUserDepartmentNotFound:
+		return errors.ErrorWithCode(err, fiber.StatusNotFound)
+	case department.ErrUserAlreadyAssigned:
+		return errors.ErrorWithCode(err, fiber.StatusConflict)
+	case department.ErrInvalidMembershipRole, department.ErrNoUsersToAssign, department.ErrTooManyUsersToAssign:
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
+
 func (h *departmentHandler) GetUsersByDepartment(ctx *fiber.Ctx) error {
 	id, _ := strconv.Atoi(ctx.Params("id"))
 
@@ -129,15 +302,65 @@ func (h *departmentHandler) GetUsersByDepartment(ctx *fiber.Ctx) error {
 	})
 }
 
+// RemoveUserFromDepartment takes the user out of every department, or only
+// out of ?department_id= when given
 func (h *departmentHandler) RemoveUserFromDepartment(ctx *fiber.Ctx) error {
-	userID, _ := strconv.Atoi(ctx.Params("id"))
+	var cmd department.RemoveUserFromDepartmentCommand
+
+	if err := ctx.QueryParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.UserID, _ = strconv.Atoi(ctx.Params("id"))
 
-	if err := h.s.RemoveUserFromDepartment(ctx.Context(), userID); err != nil {
+	if err := h.s.RemoveUserFromDepartment(ctx.Context(), &cmd); err != nil {
 		return errors.ErrorInternalServerError(err)
 	}
 
 	return response.Ok(ctx, fiber.Map{
-		"user removed from department successfully!": userID,
+		"user removed from department successfully!": cmd.UserID,
+	})
+}
+
+// GetUserMemberships lists the departments of the user, ?history=true adds
+// the memberships that ended
+func (h *departmentHandler) GetUserMemberships(ctx *fiber.Ctx) error {
+	var query department.SearchMembershipQuery
+
+	if err := ctx.QueryParser(&query); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	query.UserID, _ = ctx.ParamsInt("id")
+
+	result, err := h.s.GetUserMemberships(ctx.Context(), &query)
+	if err != nil {
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"memberships": result,
+	})
+}
+
+// GetDepartmentMembers lists the members of the department, ?history=true
+// adds the memberships that ended
+func (h *departmentHandler) GetDepartmentMembers(ctx *fiber.Ctx) error {
+	var query department.SearchMembershipQuery
+
+	if err := ctx.QueryParser(&query); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	query.DepartmentID, _ = ctx.ParamsInt("id")
+
+	result, err := h.s.GetDepartmentMembers(ctx.Context(), &query)
+	if err != nil {
+		return hierarchyError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"memberships": result,
 	})
 }
 
@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"task/internal/identity/department"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeDepartmentService records the updates that reach the service
+type fakeDepartmentService struct {
+	department.Service
+	updated *department.UpdateDepartmentCommand
+}
+
+func (f *fakeDepartmentService) UpdateDepartment(ctx context.Context, cmd *department.UpdateDepartmentCommand) error {
+	f.updated = cmd
+	return nil
+}
+
+func TestUpdateDepartmentParent(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantSetParent bool
+		wantParentID  int // 0 for none
+	}{
+		{"parent left out", `{"id":5,"name":"Sales","location":"Paris"}`, false, 0},
+		{"null parent", `{"id":5,"name":"Sales","location":"Paris","parent_id":null}`, true, 0},
+		{"new parent", `{"id":5,"name":"Sales","location":"Paris","parent_id":2}`, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeDepartmentService{}
+			handler := NewDepartmentHandler(service)
+
+			app := newTestApp()
+			app.Put("/departments", handler.UpdateDepartment)
+
+			req := httptest.NewRequest(fiber.MethodPut, "/departments", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+			}
+
+			got := service.updated
+			if got == nil || got.SetParent != tt.wantSetParent {
+				t.Fatalf("updated = %+v, want SetParent %v", got, tt.wantSetParent)
+			}
+
+			if (got.ParentID == nil) != (tt.wantParentID == 0) || (got.ParentID != nil && *got.ParentID != tt.wantParentID) {
+				t.Fatalf("parent_id = %v, want %d", got.ParentID, tt.wantParentID)
+			}
+		})
+	}
+}
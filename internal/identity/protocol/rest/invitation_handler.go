@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"task/internal/api/errors"
+	"task/internal/api/response"
+	"task/internal/identity/invitation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type invitationHandler struct {
+	s invitation.Service
+}
+
+func NewInvitationHandler(s invitation.Service) *invitationHandler {
+	return &invitationHandler{
+		s: s,
+	}
+}
+
+func (h *invitationHandler) InviteUser(ctx *fiber.Ctx) error {
+	var cmd invitation.InviteUserCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.InvitedBy, _ = ctx.Locals("userID").(string)
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	result, err := h.s.InviteUser(ctx.Context(), &cmd)
+	if err != nil {
+		return invitationError(err)
+	}
+
+	return response.Created(ctx, fiber.Map{
+		"invitation": result,
+	})
+}
+
+func (h *invitationHandler) SearchInvitations(ctx *fiber.Ctx) error {
+	var query invitation.SearchInvitationQuery
+
+	if err := ctx.QueryParser(&query); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	result, err := h.s.SearchInvitations(ctx.Context(), &query)
+	if err != nil {
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"invitations": result,
+	})
+}
+
+func (h *invitationHandler) ResendInvitation(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	result, err := h.s.ResendInvitation(ctx.Context(), id)
+	if err != nil {
+		return invitationError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"invitation": result,
+	})
+}
+
+func (h *invitationHandler) RevokeInvitation(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	if err := h.s.RevokeInvitation(ctx.Context(), id); err != nil {
+		return invitationError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "invitation revoked successfully!",
+	})
+}
+
+func (h *invitationHandler) AcceptInvitation(ctx *fiber.Ctx) error {
+	var cmd invitation.AcceptInvitationCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	// The link carries the token in the query string
+	if cmd.Token == "" {
+		cmd.Token = ctx.Query("token")
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	if err := h.s.AcceptInvitation(ctx.Context(), &cmd); err != nil {
+		return invitationError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "invitation accepted successfully!",
+	})
+}
+
+func invitationError(err error) error {
+	switch err {
+	case invitation.ErrInvitationNotFound, invitation.ErrDepartmentNotFound:
+		return errors.ErrorWithCode(err, fiber.StatusNotFound)
+	case invitation.ErrUserAlreadyExists, invitation.ErrInvitationNotPending:
+		return errors.ErrorWithCode(err, fiber.StatusConflict)
+	case invitation.ErrInvalidInvitationToken:
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
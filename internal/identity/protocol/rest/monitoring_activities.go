@@ -54,3 +54,23 @@ func (h *monitorinActivitiesHandler) MonitoringLogs(ctx *fiber.Ctx) error {
 		"result": result,
 	})
 }
+
+// QueueStats reports the depth and counters of the activity log queue
+func (h *monitorinActivitiesHandler) QueueStats(ctx *fiber.Ctx) error {
+	return response.Ok(ctx, fiber.Map{
+		"queue": h.s.QueueStats(),
+	})
+}
+
+// VerifyChain walks the hash chain of activity_logs, the result is not valid
+// when an entry was edited or deleted since it was written
+func (h *monitorinActivitiesHandler) VerifyChain(ctx *fiber.Ctx) error {
+	result, err := h.s.VerifyChain(ctx.Context())
+	if err != nil {
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"result": result,
+	})
+}
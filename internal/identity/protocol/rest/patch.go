@@ -0,0 +1,26 @@
+package rest
+
+import (
+	"task/internal/api/errors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// patchError maps the errors of a PATCH endpoint, any other domain error is
+// a validation failure of the patched document.
+func patchError(err, notFound, conflict, duplicate error) error {
+	switch err {
+	case notFound:
+		return errors.ErrorWithCode(err, fiber.StatusNotFound)
+	case conflict:
+		return errors.ErrorWithCode(err, fiber.StatusPreconditionFailed)
+	case duplicate:
+		return errors.ErrorWithCode(err, fiber.StatusConflict)
+	}
+
+	if status, ok := err.(errors.ErrorStatus); ok {
+		return errors.ErrorWithCode(status, fiber.StatusBadRequest)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
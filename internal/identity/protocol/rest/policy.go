@@ -0,0 +1,28 @@
+package rest
+
+import (
+	"task/internal/api/errors"
+	"task/internal/identity/policy"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// principal returns the authenticated user set by the JWTProtected middleware
+func principal(ctx *fiber.Ctx) *policy.Principal {
+	result, _ := ctx.Locals("principal").(*policy.Principal)
+	if result == nil {
+		return &policy.Principal{}
+	}
+	return result
+}
+
+func policyError(err error) error {
+	switch err {
+	case policy.ErrForbidden:
+		return errors.ErrorWithCode(err, fiber.StatusForbidden)
+	case policy.ErrResourceNotFound:
+		return errors.ErrorWithCode(err, fiber.StatusNotFound)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
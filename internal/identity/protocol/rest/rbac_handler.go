@@ -0,0 +1,233 @@
+package rest
+
+import (
+	"slices"
+	"task/internal/api/errors"
+	"task/internal/api/response"
+	"task/internal/identity/accesstoken"
+	"task/internal/identity/rbac"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type rbacHandler struct {
+	s rbac.Service
+}
+
+func NewRBACHandler(s rbac.Service) *rbacHandler {
+	return &rbacHandler{
+		s: s,
+	}
+}
+
+func (h *rbacHandler) CreateRole(ctx *fiber.Ctx) error {
+	var cmd rbac.CreateRoleCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	if err := h.s.CreateRole(ctx.Context(), &cmd); err != nil {
+		return rbacError(err)
+	}
+
+	return response.Created(ctx, fiber.Map{
+		"role created successfully!": cmd,
+	})
+}
+
+func (h *rbacHandler) UpdateRole(ctx *fiber.Ctx) error {
+	var cmd rbac.UpdateRoleCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.ID, _ = ctx.ParamsInt("id")
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	if err := h.s.UpdateRole(ctx.Context(), &cmd); err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"role updated successfully!": cmd,
+	})
+}
+
+func (h *rbacHandler) GetRoleByID(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	result, err := h.s.GetRoleByID(ctx.Context(), id)
+	if err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"role": result,
+	})
+}
+
+func (h *rbacHandler) ListRoles(ctx *fiber.Ctx) error {
+	result, err := h.s.ListRoles(ctx.Context())
+	if err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"roles": result,
+	})
+}
+
+func (h *rbacHandler) DeleteRole(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	if err := h.s.DeleteRole(ctx.Context(), id); err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "role deleted successfully!",
+	})
+}
+
+func (h *rbacHandler) SetRolePermissions(ctx *fiber.Ctx) error {
+	var cmd rbac.SetRolePermissionsCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.RoleID, _ = ctx.ParamsInt("id")
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	if err := h.s.SetRolePermissions(ctx.Context(), &cmd); err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"role permissions updated successfully!": cmd,
+	})
+}
+
+func (h *rbacHandler) CreatePermission(ctx *fiber.Ctx) error {
+	var cmd rbac.CreatePermissionCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	if err := h.s.CreatePermission(ctx.Context(), &cmd); err != nil {
+		return rbacError(err)
+	}
+
+	return response.Created(ctx, fiber.Map{
+		"permission created successfully!": cmd,
+	})
+}
+
+func (h *rbacHandler) ListPermissions(ctx *fiber.Ctx) error {
+	result, err := h.s.ListPermissions(ctx.Context())
+	if err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"permissions": result,
+	})
+}
+
+func (h *rbacHandler) DeletePermission(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	if err := h.s.DeletePermission(ctx.Context(), id); err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "permission deleted successfully!",
+	})
+}
+
+func (h *rbacHandler) GetUserRoles(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	result, err := h.s.GetUserRoles(ctx.Context(), id)
+	if err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"roles": result,
+	})
+}
+
+func (h *rbacHandler) SetUserRoles(ctx *fiber.Ctx) error {
+	var cmd rbac.SetUserRolesCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.UserID, _ = ctx.ParamsInt("id")
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	if err := h.s.SetUserRoles(ctx.Context(), &cmd); err != nil {
+		return rbacError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"user roles updated successfully!": cmd,
+	})
+}
+
+// MyPermissions lists what the caller can do, personal access tokens are
+// limited to the permissions covered by their scopes.
+func (h *rbacHandler) MyPermissions(ctx *fiber.Ctx) error {
+	caller := principal(ctx)
+	permissions := caller.Permissions
+
+	scopes, limited := ctx.Locals("scopes").([]string)
+	if limited {
+		permissions = make([]string, 0, len(caller.Permissions))
+		for _, permission := range caller.Permissions {
+			if slices.Contains(scopes, accesstoken.ScopeForPermission(permission)) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"roles":       caller.Roles,
+		"permissions": permissions,
+		"scopes":      scopes,
+	})
+}
+
+func rbacError(err error) error {
+	switch err {
+	case rbac.ErrRoleNotFound, rbac.ErrPermissionNotFound, rbac.ErrUserNotFound:
+		return errors.ErrorWithCode(err, fiber.StatusNotFound)
+	case rbac.ErrRoleAlreadyExists, rbac.ErrPermissionAlreadyExists, rbac.ErrRoleInUse:
+		return errors.ErrorWithCode(err, fiber.StatusConflict)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
@@ -0,0 +1,99 @@
+package rest
+
+import (
+	"strings"
+	"task/internal/api/errors"
+	"task/internal/api/response"
+	"task/internal/identity/sso"
+	"task/internal/identity/user"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ssoHandler struct {
+	s sso.Service
+}
+
+func NewSSOHandler(s sso.Service) *ssoHandler {
+	return &ssoHandler{
+		s: s,
+	}
+}
+
+// ssoStateCookie keeps the state of a login in the browser that started it,
+// the callback only goes on when the state it receives matches
+const ssoStateCookie = "oidc_state"
+
+func (h *ssoHandler) Login(ctx *fiber.Ctx) error {
+	auth, err := h.s.AuthorizationURL(ctx.Context(), ctx.Params("provider"))
+	if err != nil {
+		return ssoError(err)
+	}
+
+	ctx.Cookie(&fiber.Cookie{
+		Name:     ssoStateCookie,
+		Value:    auth.State,
+		Path:     strings.TrimSuffix(ctx.Path(), "/login"),
+		Expires:  auth.ExpiresAt,
+		HTTPOnly: true,
+		Secure:   ctx.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return ctx.Redirect(auth.URL, fiber.StatusFound)
+}
+
+func (h *ssoHandler) Callback(ctx *fiber.Ctx) error {
+	var cmd sso.CallbackCommand
+
+	if err := ctx.QueryParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.Provider = ctx.Params("provider")
+	cmd.BrowserState = ctx.Cookies(ssoStateCookie)
+
+	// The cookie is good for one callback, whatever its outcome
+	ctx.Cookie(&fiber.Cookie{
+		Name:     ssoStateCookie,
+		Path:     strings.TrimSuffix(ctx.Path(), "/callback"),
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		Secure:   ctx.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusUnauthorized)
+	}
+
+	result, err := h.s.Callback(ctx.Context(), &cmd)
+	if err != nil {
+		return ssoError(err)
+	}
+
+	// A second factor is still needed before a session is issued
+	if result.Token == "" {
+		return response.Ok(ctx, fiber.Map{
+			"mfa": result,
+		})
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"login user": result.Token,
+	})
+}
+
+func ssoError(err error) error {
+	switch err {
+	case sso.ErrProviderNotFound:
+		return errors.ErrorNotFound(err)
+	case sso.ErrInvalidState, sso.ErrExchangeFailed, sso.ErrInvalidIDToken, sso.ErrEmailNotVerified, sso.ErrAccessDenied:
+		return errors.ErrorWithCode(err, fiber.StatusUnauthorized)
+	case sso.ErrAccountInactive, user.ErrAccountInactive:
+		return errors.ErrorWithCode(err, fiber.StatusForbidden)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
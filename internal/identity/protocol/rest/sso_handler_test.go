@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"task/internal/identity/sso"
+	"task/internal/identity/user"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeSSOService starts every login with the same state and records the
+// callbacks that get past the handler
+type fakeSSOService struct {
+	callbacks []*sso.CallbackCommand
+}
+
+func (f *fakeSSOService) AuthorizationURL(ctx context.Context, provider string) (*sso.Authorization, error) {
+	return &sso.Authorization{
+		URL:       "https://idp.example.com/authorize?state=login-state",
+		State:     "login-state",
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+	}, nil
+}
+
+func (f *fakeSSOService) Callback(ctx context.Context, cmd *sso.CallbackCommand) (*user.LoginResult, error) {
+	f.callbacks = append(f.callbacks, cmd)
+	return &user.LoginResult{Token: "session"}, nil
+}
+
+func newSSOTestApp(service sso.Service) *fiber.App {
+	handler := NewSSOHandler(service)
+
+	app := newTestApp()
+	app.Get("/api/auth/oidc/:provider/login", handler.Login)
+	app.Get("/api/auth/oidc/:provider/callback", handler.Callback)
+
+	return app
+}
+
+func stateCookie(t *testing.T, resp *http.Response) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == ssoStateCookie {
+			return cookie
+		}
+	}
+
+	t.Fatal("no state cookie set")
+	return nil
+}
+
+func TestSSOLoginSetsStateCookie(t *testing.T) {
+	app := newSSOTestApp(&fakeSSOService{})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/api/auth/oidc/corp/login", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusFound)
+	}
+
+	cookie := stateCookie(t, resp)
+	if cookie.Value != "login-state" || !cookie.HttpOnly || cookie.Path != "/api/auth/oidc/corp" || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("state cookie = %+v", cookie)
+	}
+}
+
+func TestSSOCallbackChecksStateCookie(t *testing.T) {
+	tests := []struct {
+		name       string
+		cookie     string
+		wantStatus int
+	}{
+		{"cookie of the login", "login-state", fiber.StatusOK},
+		{"no cookie", "", fiber.StatusUnauthorized},
+		{"cookie of another login", "other-state", fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeSSOService{}
+			app := newSSOTestApp(service)
+
+			req := httptest.NewRequest(fiber.MethodGet, "/api/auth/oidc/corp/callback?code=abc&state=login-state", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: ssoStateCookie, Value: tt.cookie})
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			// The cookie is cleared whatever the outcome
+			if cookie := stateCookie(t, resp); cookie.Value != "" || cookie.Expires.After(time.Now()) {
+				t.Fatalf("state cookie not cleared: %+v", cookie)
+			}
+
+			if tt.wantStatus != fiber.StatusOK {
+				if len(service.callbacks) != 0 {
+					t.Fatal("a callback without the browser state reached the service")
+				}
+				return
+			}
+
+			if len(service.callbacks) != 1 || service.callbacks[0].Provider != "corp" {
+				t.Fatalf("callbacks = %+v", service.callbacks)
+			}
+		})
+	}
+}
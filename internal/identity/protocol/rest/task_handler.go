@@ -1,20 +1,25 @@
 package rest
 
 import (
+	"encoding/json"
 	"task/internal/api/errors"
 	"task/internal/api/response"
+	"task/internal/identity/accesscontrol"
+	"task/internal/identity/policy"
 	"task/internal/identity/task"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type taskHandler struct {
-	s task.Service
+	s      task.Service
+	policy policy.Service
 }
 
-func NewTaskHandler(s task.Service) *taskHandler {
+func NewTaskHandler(s task.Service, policy policy.Service) *taskHandler {
 	return &taskHandler{
-		s: s,
+		s:      s,
+		policy: policy,
 	}
 }
 
@@ -29,7 +34,14 @@ func (h *taskHandler) CreateTask(ctx *fiber.Ctx) error {
 		return errors.ErrorBadRequest(err)
 	}
 
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermTasksCreate, policy.User(cmd.UserID)); err != nil {
+		return policyError(err)
+	}
+
 	if err := h.s.CreateTask(ctx.Context(), &cmd); err != nil {
+		if err == task.ErrDepartmentNotFound {
+			return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+		}
 		return errors.ErrorInternalServerError(err)
 	}
 
@@ -45,11 +57,33 @@ func (h *taskHandler) UpdateTask(ctx *fiber.Ctx) error {
 		return errors.ErrorBadRequest(err)
 	}
 
+	cmd.ID, _ = ctx.ParamsInt("id")
+
 	if err := cmd.Validate(); err != nil {
 		return errors.ErrorBadRequest(err)
 	}
 
+	version, err := response.IfMatchVersion(ctx)
+	if err != nil {
+		return err
+	}
+	cmd.Version = version
+
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermTasksUpdate, policy.Task(cmd.ID)); err != nil {
+		return policyError(err)
+	}
+
+	if err := h.authorizeReassign(ctx, cmd.ID, cmd.UserID); err != nil {
+		return err
+	}
+
 	if err := h.s.UpdateTask(ctx.Context(), &cmd); err != nil {
+		switch err {
+		case task.ErrVersionConflict:
+			return errors.ErrorWithCode(err, fiber.StatusPreconditionFailed)
+		case task.ErrDepartmentNotFound:
+			return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+		}
 		return errors.ErrorInternalServerError(err)
 	}
 
@@ -58,6 +92,29 @@ func (h *taskHandler) UpdateTask(ctx *fiber.Ctx) error {
 	})
 }
 
+// authorizeReassign lets the update through when the assignee stays the same,
+// otherwise the principal must be allowed to assign tasks to the new one.
+// Updating a task does not imply that, assignees may only edit their tasks.
+func (h *taskHandler) authorizeReassign(ctx *fiber.Ctx, taskID, userID int) error {
+	existing, err := h.s.GetTaskByID(ctx.Context(), taskID)
+	if err != nil {
+		if err == task.ErrTaskNotFound {
+			return errors.ErrorWithCode(err, fiber.StatusNotFound)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	if existing.UserID == userID {
+		return nil
+	}
+
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermTasksCreate, policy.User(userID)); err != nil {
+		return policyError(err)
+	}
+
+	return nil
+}
+
 func (h *taskHandler) GetTaskByID(ctx *fiber.Ctx) error {
 	id, _ := ctx.ParamsInt("id")
 
@@ -66,6 +123,52 @@ func (h *taskHandler) GetTaskByID(ctx *fiber.Ctx) error {
 		return errors.ErrorInternalServerError(err)
 	}
 
+	result.In(principal(ctx).Location())
+
+	response.SetETag(ctx, result.Version)
+
+	return response.Ok(ctx, fiber.Map{
+		"task": result,
+	})
+}
+
+// PatchTask applies a JSON Merge Patch, an If-Match header makes the update
+// fail with 412 when the task changed since it was read.
+func (h *taskHandler) PatchTask(ctx *fiber.Ctx) error {
+	var cmd task.PatchTaskCommand
+
+	cmd.ID, _ = ctx.ParamsInt("id")
+	cmd.Patch = ctx.Body()
+
+	version, err := response.IfMatchVersion(ctx)
+	if err != nil {
+		return err
+	}
+	cmd.Version = version
+
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermTasksUpdate, policy.Task(cmd.ID)); err != nil {
+		return policyError(err)
+	}
+
+	// A merge patch only changes the assignee when it sets user_id
+	var fields struct {
+		UserID *int `json:"user_id"`
+	}
+	if json.Unmarshal(cmd.Patch, &fields) == nil && fields.UserID != nil {
+		if err := h.authorizeReassign(ctx, cmd.ID, *fields.UserID); err != nil {
+			return err
+		}
+	}
+
+	result, err := h.s.PatchTask(ctx.Context(), &cmd)
+	if err != nil {
+		return patchError(err, task.ErrTaskNotFound, task.ErrVersionConflict, task.ErrTaskAlreadyExists)
+	}
+
+	result.In(principal(ctx).Location())
+
+	response.SetETag(ctx, result.Version)
+
 	return response.Ok(ctx, fiber.Map{
 		"task": result,
 	})
@@ -95,16 +198,53 @@ func (h *taskHandler) SearchTask(ctx *fiber.Ctx) error {
 		return errors.ErrorInternalServerError(err)
 	}
 
+	location := principal(ctx).Location()
+	for _, t := range result.Tasks {
+		t.In(location)
+	}
+
 	return response.Ok(ctx, fiber.Map{
 		"tasks": result,
 	})
 }
 
+// GetDepartmentDashboard returns the task figures of a department, ?weeks=
+// sets how far back the throughput goes
+func (h *taskHandler) GetDepartmentDashboard(ctx *fiber.Ctx) error {
+	var query task.DepartmentDashboardQuery
+
+	if err := ctx.QueryParser(&query); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	query.DepartmentID, _ = ctx.ParamsInt("id")
+	query.Location = principal(ctx).Location()
+
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermTasksRead, policy.Department(query.DepartmentID)); err != nil {
+		return policyError(err)
+	}
+
+	result, err := h.s.GetDepartmentDashboard(ctx.Context(), &query)
+	if err != nil {
+		if err == task.ErrDepartmentNotFound {
+			return errors.ErrorWithCode(err, fiber.StatusNotFound)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"dashboard": result,
+	})
+}
+
 func (h *taskHandler) SubmitTask(ctx *fiber.Ctx) error {
 	var cmd task.SubmitTaskCommand
 
-	if err := ctx.BodyParser(&cmd); err != nil {
-		return errors.ErrorBadRequest(err)
+	cmd.TaskID, _ = ctx.ParamsInt("id")
+	cmd.UserID = principal(ctx).UserID
+
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermTasksSubmit, policy.Task(cmd.TaskID)); err != nil {
+		return policyError(err)
 	}
 
 	if err := h.s.SubmitTask(ctx.Context(), &cmd); err != nil {
@@ -120,8 +260,11 @@ func (h *taskHandler) SubmitTask(ctx *fiber.Ctx) error {
 func (h *taskHandler) ApprovedTask(ctx *fiber.Ctx) error {
 	var cmd task.ApproveTaskCommand
 
-	if err := ctx.BodyParser(&cmd); err != nil {
-		return errors.ErrorBadRequest(err)
+	cmd.TaskID, _ = ctx.ParamsInt("id")
+	cmd.UserID = principal(ctx).UserID
+
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermTasksApprove, policy.Task(cmd.TaskID)); err != nil {
+		return policyError(err)
 	}
 
 	err := h.s.ApprovedTask(ctx.Context(), &cmd)
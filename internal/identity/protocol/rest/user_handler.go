@@ -1,49 +1,306 @@
 package rest
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
 	"task/internal/api/errors"
 	"task/internal/api/response"
+	"task/internal/identity/accesscontrol"
+	"task/internal/identity/policy"
 	"task/internal/identity/user"
+	"task/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
 )
 
 type userHandler struct {
-	s user.Service
+	s      user.Service
+	policy policy.Service
 }
 
-func NewUserHandler(s user.Service) *userHandler {
+func NewUserHandler(s user.Service, policy policy.Service) *userHandler {
 	return &userHandler{
-		s: s,
+		s:      s,
+		policy: policy,
 	}
 }
 
-func (h *userHandler) CreateUser(ctx *fiber.Ctx) error {
-	var cmd user.CreateUserCommand
+func (h *userHandler) GetUserByID(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	result, err := h.s.GetUserByID(ctx.Context(), id)
+	if err != nil {
+		return errors.ErrorInternalServerError(err)
+	}
+
+	if result != nil {
+		response.SetETag(ctx, result.Version)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"user": result,
+	})
+}
+
+func (h *userHandler) UpdateUser(ctx *fiber.Ctx) error {
+	var cmd user.UpdateUserCommand
 
 	if err := ctx.BodyParser(&cmd); err != nil {
 		return errors.ErrorBadRequest(err)
 	}
 
+	cmd.ID, _ = ctx.ParamsInt("id")
+
+	// PUT replaces the whole profile, a missing field is not left unchanged
 	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	version, err := response.IfMatchVersion(ctx)
+	if err != nil {
+		return err
+	}
+	cmd.Version = version
+
+	resource := policy.User(cmd.ID)
+	resource.Changes = ownEmailChange(principal(ctx), cmd.ID, &cmd.Email)
+
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermUsersUpdate, resource); err != nil {
+		return policyError(err)
+	}
+
+	err = h.s.UpdateUser(ctx.Context(), &cmd)
+	if err != nil {
+		switch err {
+		case user.ErrVersionConflict:
+			return errors.ErrorWithCode(err, fiber.StatusPreconditionFailed)
+		case user.ErrUserNotFound:
+			return errors.ErrorNotFound(err)
+		case user.ErrUserAlreadyExists:
+			return errors.ErrorWithCode(err, fiber.StatusConflict)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"user updated": cmd,
+	})
+}
+
+// PatchUser applies a JSON Merge Patch, an If-Match header makes the update
+// fail with 412 when the user changed since it was read.
+func (h *userHandler) PatchUser(ctx *fiber.Ctx) error {
+	var cmd user.PatchUserCommand
+
+	cmd.ID, _ = ctx.ParamsInt("id")
+	cmd.Patch = ctx.Body()
+
+	version, err := response.IfMatchVersion(ctx)
+	if err != nil {
+		return err
+	}
+	cmd.Version = version
+
+	// A malformed patch is rejected by the service, it changes nothing here
+	var fields struct {
+		Email *string `json:"email"`
+	}
+	_ = json.Unmarshal(cmd.Patch, &fields)
+
+	resource := policy.User(cmd.ID)
+	resource.Changes = ownEmailChange(principal(ctx), cmd.ID, fields.Email)
+
+	if err := h.policy.Authorize(ctx.Context(), principal(ctx), accesscontrol.PermUsersUpdate, resource); err != nil {
+		return policyError(err)
+	}
+
+	result, err := h.s.PatchUser(ctx.Context(), &cmd)
+	if err != nil {
+		return patchError(err, user.ErrUserNotFound, user.ErrVersionConflict, user.ErrUserAlreadyExists)
+	}
+
+	response.SetETag(ctx, result.Version)
+
+	return response.Ok(ctx, fiber.Map{
+		"user": result,
+	})
+}
+
+// ownEmailChange guards the email of callers updating themselves, a new one
+// must go through verification. The principal holds the stored email, so only
+// the caller's own change is detected, which is the case the rules restrict.
+func ownEmailChange(p *policy.Principal, id int, email *string) []string {
+	if email == nil || id != p.UserID || strings.EqualFold(*email, p.Email) {
+		return nil
+	}
+
+	return []string{"email"}
+}
+
+func (h *userHandler) SearchUser(ctx *fiber.Ctx) error {
+	var query user.SearchUserQuery
+
+	if err := ctx.QueryParser(&query); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	result, err := h.s.SearchUser(ctx.Context(), &query)
+	if err != nil {
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"users": result,
+	})
+}
+
+// ImportUsers invites users from a CSV or XLSX file sent as the "file" form
+// field. With ?dry_run=true the rows are only validated. Rows are not created
+// as active users: each one is validated as an invitation that also requires
+// address, phone number and date of birth, and becomes a pending user who
+// sets a password from the invitation email. "created" counts the invited
+// users and "unsent" lists those whose email could not be sent.
+func (h *userHandler) ImportUsers(ctx *fiber.Ctx) error {
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		return errors.ErrorWithCode(user.ErrInvalidImportFile, fiber.StatusBadRequest)
+	}
+
+	if file.Size > user.MaxImportUploadSize {
+		return errors.ErrorWithCode(user.ErrImportTooLarge, fiber.StatusRequestEntityTooLarge)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, user.MaxImportUploadSize+1))
+	if err != nil {
 		return errors.ErrorBadRequest(err)
 	}
 
-	if err := h.s.CreateUser(ctx.Context(), &cmd); err != nil {
+	invitedBy, _ := ctx.Locals("userID").(string)
+
+	result, err := h.s.ImportUsers(ctx.Context(), &user.ImportUsersCommand{
+		Filename:  file.Filename,
+		Data:      data,
+		DryRun:    ctx.QueryBool("dry_run"),
+		InvitedBy: invitedBy,
+	})
+	if err != nil {
+		switch {
+		case err == user.ErrImportRejected:
+			// The report tells which rows to fix before uploading again
+			return errors.NewApiError(err, fiber.StatusUnprocessableEntity, err.Error(), result)
+		case err == user.ErrImportTooLarge:
+			return errors.ErrorWithCode(err, fiber.StatusRequestEntityTooLarge)
+		}
+		var status errors.ErrorStatus
+		if stderrors.As(err, &status) {
+			return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+		}
 		return errors.ErrorInternalServerError(err)
 	}
 
+	if result.DryRun {
+		return response.Ok(ctx, fiber.Map{
+			"import": result,
+		})
+	}
+
 	return response.Created(ctx, fiber.Map{
-		"user": cmd,
+		"import": result,
 	})
 }
 
-func (h *userHandler) GetUserByID(ctx *fiber.Ctx) error {
+// ExportUsers streams the users matching the SearchUser filters as CSV
+func (h *userHandler) ExportUsers(ctx *fiber.Ctx) error {
+	var query user.SearchUserQuery
+
+	if err := ctx.QueryParser(&query); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="users.csv"`)
+
+	// The body is written after the handler returns, so the request context
+	// can no longer be used and a failure can only cut the file short
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		out := csv.NewWriter(w)
+
+		err := out.Write(user.ExportColumns)
+		if err == nil {
+			err = h.s.ExportUsers(context.Background(), &query, func(u *user.User) error {
+				out.Write([]string{
+					strconv.Itoa(u.ID),
+					u.UUID,
+					u.FirstName,
+					u.LastName,
+					u.Email,
+					u.Address,
+					u.PhoneNumber,
+					u.DateOfBirth.DateOnly(),
+					u.Role,
+					strconv.Itoa(int(u.Status)),
+				})
+				out.Flush()
+				return out.Error()
+			})
+		}
+
+		out.Flush()
+
+		if err != nil {
+			zap.L().Named("user.export").Error("Failed to export users", zap.Error(err))
+		}
+	})
+
+	return nil
+}
+
+func (h *userHandler) DeactivateUser(ctx *fiber.Ctx) error {
+	var cmd user.DeactivateUserCommand
+
+	// The body is optional when the user has no open tasks
+	if err := ctx.BodyParser(&cmd); err != nil && err != fiber.ErrUnprocessableEntity {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.ID, _ = ctx.ParamsInt("id")
+	cmd.ActorEmail, _ = ctx.Locals("userID").(string)
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	result, err := h.s.DeactivateUser(ctx.Context(), &cmd)
+	if err != nil {
+		return lifecycleError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"deactivation": result,
+	})
+}
+
+func (h *userHandler) ReactivateUser(ctx *fiber.Ctx) error {
 	id, _ := ctx.ParamsInt("id")
+	actorEmail, _ := ctx.Locals("userID").(string)
 
-	result, err := h.s.GetUserByID(ctx.Context(), id)
+	result, err := h.s.ReactivateUser(ctx.Context(), id, actorEmail)
 	if err != nil {
-		return errors.ErrorInternalServerError(err)
+		return lifecycleError(err)
 	}
 
 	return response.Ok(ctx, fiber.Map{
@@ -51,37 +308,73 @@ func (h *userHandler) GetUserByID(ctx *fiber.Ctx) error {
 	})
 }
 
-func (h *userHandler) UpdateUser(ctx *fiber.Ctx) error {
-	var cmd user.UpdateUserCommand
+func lifecycleError(err error) error {
+	switch err {
+	case user.ErrUserNotFound:
+		return errors.ErrorWithCode(err, fiber.StatusNotFound)
+	case user.ErrInvalidReassignee:
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	case user.ErrCannotDeactivateSelf, user.ErrCannotDeactivateSuperuser:
+		return errors.ErrorWithCode(err, fiber.StatusForbidden)
+	case user.ErrUserAlreadyInactive, user.ErrUserNotInactive, user.ErrReassignmentRequired:
+		return errors.ErrorWithCode(err, fiber.StatusConflict)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
+
+func (h *userHandler) SetManager(ctx *fiber.Ctx) error {
+	var cmd user.SetManagerCommand
 
 	if err := ctx.BodyParser(&cmd); err != nil {
 		return errors.ErrorBadRequest(err)
 	}
 
-	err := h.s.UpdateUser(ctx.Context(), &cmd)
+	cmd.UserID, _ = ctx.ParamsInt("id")
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	result, err := h.s.SetManager(ctx.Context(), &cmd)
 	if err != nil {
+		switch err {
+		case user.ErrUserNotFound:
+			return errors.ErrorWithCode(err, fiber.StatusNotFound)
+		case user.ErrManagerNotFound, user.ErrManagerCycle:
+			return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+		}
 		return errors.ErrorInternalServerError(err)
 	}
 
+	response.SetETag(ctx, result.Version)
+
 	return response.Ok(ctx, fiber.Map{
-		"user updated": cmd,
+		"user": result,
 	})
 }
 
-func (h *userHandler) SearchUser(ctx *fiber.Ctx) error {
-	var query user.SearchUserQuery
+// GetReports lists the direct reports of a user, ?indirect=true walks down
+// the whole reporting line
+func (h *userHandler) GetReports(ctx *fiber.Ctx) error {
+	var query user.ReportsQuery
 
 	if err := ctx.QueryParser(&query); err != nil {
 		return errors.ErrorBadRequest(err)
 	}
 
-	result, err := h.s.SearchUser(ctx.Context(), &query)
+	query.UserID, _ = ctx.ParamsInt("id")
+
+	result, err := h.s.GetReports(ctx.Context(), &query)
 	if err != nil {
+		if err == user.ErrUserNotFound {
+			return errors.ErrorWithCode(err, fiber.StatusNotFound)
+		}
 		return errors.ErrorInternalServerError(err)
 	}
 
 	return response.Ok(ctx, fiber.Map{
-		"users": result,
+		"reports": result,
 	})
 }
 
@@ -97,6 +390,192 @@ func (h *userHandler) DeleteUser(ctx *fiber.Ctx) error {
 	})
 }
 
+func (h *userHandler) UnlockUser(ctx *fiber.Ctx) error {
+	var cmd user.UnlockUserCommand
+
+	// The body is optional, it only names an address to clear as well
+	if err := ctx.BodyParser(&cmd); err != nil && err != fiber.ErrUnprocessableEntity {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.ID, _ = ctx.ParamsInt("id")
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	if err := h.s.UnlockUser(ctx.Context(), &cmd); err != nil {
+		if err == user.ErrUserNotFound {
+			return errors.ErrorNotFound(err)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "user unlocked successfully!",
+	})
+}
+
+func (h *userHandler) Impersonate(ctx *fiber.Ctx) error {
+	var cmd user.ImpersonateCommand
+
+	// The reason is optional, so an empty body is accepted
+	if len(ctx.Body()) > 0 {
+		if err := ctx.BodyParser(&cmd); err != nil {
+			return errors.ErrorBadRequest(err)
+		}
+	}
+
+	cmd.UserID, _ = ctx.ParamsInt("userID")
+	cmd.ActorEmail = ctx.Locals("userID").(string)
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	result, err := h.s.Impersonate(ctx.Context(), &cmd)
+	if err != nil {
+		switch err {
+		case user.ErrUserNotFound:
+			return errors.ErrorNotFound(err)
+		case user.ErrCannotImpersonateSelf, user.ErrCannotImpersonateSuperuser, user.ErrCannotImpersonateInactive:
+			return errors.ErrorWithCode(err, fiber.StatusForbidden)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Created(ctx, fiber.Map{
+		"impersonation": result,
+	})
+}
+
+func (h *userHandler) GetProfile(ctx *fiber.Ctx) error {
+	result, err := h.s.GetProfile(ctx.Context(), ctx.Locals("userID").(string))
+	if err != nil {
+		if err == user.ErrUserNotFound {
+			return errors.ErrorNotFound(err)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"user": result,
+	})
+}
+
+func (h *userHandler) UpdateProfile(ctx *fiber.Ctx) error {
+	var cmd user.UpdateProfileCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+	}
+
+	cmd.Email = ctx.Locals("userID").(string)
+
+	result, err := h.s.UpdateProfile(ctx.Context(), &cmd)
+	if err != nil {
+		if err == user.ErrUserNotFound {
+			return errors.ErrorNotFound(err)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"user": result,
+	})
+}
+
+func (h *userHandler) GetProfileDepartment(ctx *fiber.Ctx) error {
+	result, err := h.s.GetProfileDepartment(ctx.Context(), ctx.Locals("userID").(string))
+	if err != nil {
+		if err == user.ErrNoDepartment {
+			return errors.ErrorWithCode(err, fiber.StatusNotFound)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"department": result,
+	})
+}
+
+func (h *userHandler) UploadAvatar(ctx *fiber.Ctx) error {
+	file, err := ctx.FormFile("avatar")
+	if err != nil {
+		return errors.ErrorWithCode(user.ErrInvalidAvatar, fiber.StatusBadRequest)
+	}
+
+	if file.Size > user.MaxAvatarUploadSize {
+		return errors.ErrorWithCode(user.ErrAvatarTooLarge, fiber.StatusRequestEntityTooLarge)
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, user.MaxAvatarUploadSize+1))
+	if err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	result, err := h.s.UploadAvatar(ctx.Context(), &user.UploadAvatarCommand{
+		Email: ctx.Locals("userID").(string),
+		Data:  data,
+	})
+	if err != nil {
+		switch err {
+		case user.ErrInvalidAvatar:
+			return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+		case user.ErrAvatarTooLarge:
+			return errors.ErrorWithCode(err, fiber.StatusRequestEntityTooLarge)
+		case user.ErrUserNotFound:
+			return errors.ErrorNotFound(err)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"user": result,
+	})
+}
+
+func (h *userHandler) DeleteAvatar(ctx *fiber.Ctx) error {
+	if err := h.s.DeleteAvatar(ctx.Context(), ctx.Locals("userID").(string)); err != nil {
+		if err == user.ErrNoAvatar || err == user.ErrUserNotFound {
+			return errors.ErrorWithCode(err, fiber.StatusNotFound)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "avatar removed successfully!",
+	})
+}
+
+func (h *userHandler) GetAvatar(ctx *fiber.Ctx) error {
+	id, _ := ctx.ParamsInt("id")
+
+	result, err := h.s.GetAvatar(ctx.Context(), id)
+	if err != nil {
+		if err == user.ErrNoAvatar || err == user.ErrUserNotFound || err == storage.ErrNotFound {
+			return errors.ErrorWithCode(user.ErrNoAvatar, fiber.StatusNotFound)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	ctx.Set(fiber.HeaderContentType, result.ContentType)
+	ctx.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	ctx.Set(fiber.HeaderLastModified, result.UpdatedAt.UTC().Format(http.TimeFormat))
+
+	return ctx.Send(result.Data)
+}
+
 func (h *userHandler) LoginUser(ctx *fiber.Ctx) error {
 	var cmd user.LoginUserCommand
 
@@ -107,19 +586,175 @@ func (h *userHandler) LoginUser(ctx *fiber.Ctx) error {
 	if err := cmd.Validate(); err != nil {
 		return errors.ErrorBadRequest(err)
 	}
+
+	cmd.IPAddress = ctx.IP()
+
 	result, err := h.s.GetUserByEmail(ctx.Context(), &cmd)
 	if err != nil {
+		var throttled *user.LoginThrottledError
+		if stderrors.As(err, &throttled) {
+			return mfaError(ctx, err)
+		}
 		if err == user.ErrUserNotFound || err == user.ErrInvalidPassword {
 			return errors.ErrorUnauthorized(err, "Invalid email or password")
 		}
+		if err == user.ErrEmailNotVerified || err == user.ErrAccountInactive {
+			return errors.ErrorWithCode(err, fiber.StatusForbidden)
+		}
 		return errors.ErrorInternalServerError(err)
 	}
 
+	// A second factor is still needed before a session is issued
+	if result.Token == "" {
+		return response.Ok(ctx, fiber.Map{
+			"mfa": result,
+		})
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"login user": result.Token,
+	})
+}
+
+func (h *userHandler) VerifyMFA(ctx *fiber.Ctx) error {
+	var cmd user.VerifyMFACommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.IPAddress = ctx.IP()
+
+	result, err := h.s.VerifyMFA(ctx.Context(), &cmd)
+	if err != nil {
+		return mfaError(ctx, err)
+	}
+
 	return response.Ok(ctx, fiber.Map{
 		"login user": result,
 	})
 }
 
+func (h *userHandler) EnrollMFA(ctx *fiber.Ctx) error {
+	var cmd user.EnrollMFACommand
+
+	if err := ctx.BodyParser(&cmd); err != nil && err != fiber.ErrUnprocessableEntity {
+		return errors.ErrorBadRequest(err)
+	}
+
+	// Logged in users enroll themselves, forced enrollments carry a token
+	cmd.Email, _ = ctx.Locals("userID").(string)
+	if cmd.Email == "" && cmd.EnrollmentToken == "" {
+		return errors.ErrorBadRequest(user.ErrInvalidMFAToken)
+	}
+
+	result, err := h.s.EnrollMFA(ctx.Context(), &cmd)
+	if err != nil {
+		return mfaError(ctx, err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"mfa": result,
+	})
+}
+
+func (h *userHandler) ConfirmMFA(ctx *fiber.Ctx) error {
+	var cmd user.ConfirmMFACommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.Email, _ = ctx.Locals("userID").(string)
+	if cmd.Email == "" && cmd.EnrollmentToken == "" {
+		return errors.ErrorBadRequest(user.ErrInvalidMFAToken)
+	}
+
+	result, err := h.s.ConfirmMFA(ctx.Context(), &cmd)
+	if err != nil {
+		return mfaError(ctx, err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"mfa": result,
+	})
+}
+
+func (h *userHandler) DisableMFA(ctx *fiber.Ctx) error {
+	var cmd user.MFACodeCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.Email = ctx.Locals("userID").(string)
+
+	if err := h.s.DisableMFA(ctx.Context(), &cmd); err != nil {
+		return mfaError(ctx, err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "two-factor authentication disabled successfully!",
+	})
+}
+
+func (h *userHandler) RegenerateRecoveryCodes(ctx *fiber.Ctx) error {
+	var cmd user.MFACodeCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	cmd.Email = ctx.Locals("userID").(string)
+
+	result, err := h.s.RegenerateRecoveryCodes(ctx.Context(), &cmd)
+	if err != nil {
+		return mfaError(ctx, err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"recovery_codes": result,
+	})
+}
+
+// mfaError maps two-factor failures to responses that carry their error code
+func mfaError(ctx *fiber.Ctx, err error) error {
+	var throttled *user.LoginThrottledError
+	if stderrors.As(err, &throttled) {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(throttled.RetryAfter.Seconds())+1))
+		return errors.ErrorWithCode(throttled.Reason, fiber.StatusTooManyRequests)
+	}
+
+	switch err {
+	case user.ErrInvalidMFACode, user.ErrInvalidMFAToken:
+		return errors.ErrorWithCode(err, fiber.StatusUnauthorized)
+	case user.ErrMFAAlreadyEnabled, user.ErrMFANotEnrolled, user.ErrMFARequired:
+		return errors.ErrorWithCode(err, fiber.StatusConflict)
+	case user.ErrAccountInactive:
+		return errors.ErrorWithCode(err, fiber.StatusForbidden)
+	case user.ErrUserNotFound:
+		return errors.ErrorNotFound(err)
+	}
+
+	return errors.ErrorInternalServerError(err)
+}
+
 func (h *userHandler) RegisterUser(ctx *fiber.Ctx) error {
 	var cmd user.RegisterUserCommand
 
@@ -140,6 +775,49 @@ func (h *userHandler) RegisterUser(ctx *fiber.Ctx) error {
 	})
 }
 
+func (h *userHandler) VerifyEmail(ctx *fiber.Ctx) error {
+	token := ctx.Query("token")
+	if token == "" {
+		return errors.ErrorBadRequest(user.ErrInvalidVerificationToken)
+	}
+
+	err := h.s.VerifyEmail(ctx.Context(), token)
+	if err != nil {
+		if err == user.ErrInvalidVerificationToken {
+			return errors.ErrorWithCode(err, fiber.StatusBadRequest)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "email verified successfully!",
+	})
+}
+
+func (h *userHandler) ResendVerification(ctx *fiber.Ctx) error {
+	var cmd user.ResendVerificationCommand
+
+	if err := ctx.BodyParser(&cmd); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		return errors.ErrorBadRequest(err)
+	}
+
+	err := h.s.ResendVerification(ctx.Context(), &cmd)
+	if err != nil {
+		if err == user.ErrVerificationResendLimited {
+			return errors.ErrorTooManyRequests(err)
+		}
+		return errors.ErrorInternalServerError(err)
+	}
+
+	return response.Ok(ctx, fiber.Map{
+		"message": "if the account exists and is not verified, a verification email has been sent",
+	})
+}
+
 func (h *userHandler) LogoutUser(ctx *fiber.Ctx) error {
 	token := ctx.Get("Authorization")
 	if token == "" {
@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"task/internal/api/errors"
+	"task/internal/identity/policy"
+	"task/internal/identity/user"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeUserService records the commands that reach the service, the methods a
+// test does not override panic through the nil embedded interface
+type fakeUserService struct {
+	user.Service
+	updated *user.UpdateUserCommand
+}
+
+func (f *fakeUserService) UpdateUser(ctx context.Context, cmd *user.UpdateUserCommand) error {
+	f.updated = cmd
+	return nil
+}
+
+// allowAll lets every principal act on every resource
+type allowAll struct{}
+
+func (allowAll) Authorize(ctx context.Context, principal *policy.Principal, action string, resource *policy.Resource) error {
+	return nil
+}
+
+func newTestApp() *fiber.App {
+	return fiber.New(fiber.Config{
+		ErrorHandler: errors.DefaultErrorHandler,
+	})
+}
+
+func TestUpdateUserValidatesEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "complete profile",
+			body:       `{"first_name":"Jane","last_name":"Doe","email":"jane@example.com","address":"1 Main St","phone_number":"0123456789","date_of_birth":"1990-01-01"}`,
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "email left out",
+			body:       `{"first_name":"Jane","last_name":"Doe","address":"1 Main St","phone_number":"0123456789","date_of_birth":"1990-01-01"}`,
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name:       "null email",
+			body:       `{"first_name":"Jane","last_name":"Doe","email":null,"address":"1 Main St","phone_number":"0123456789","date_of_birth":"1990-01-01"}`,
+			wantStatus: fiber.StatusBadRequest,
+		},
+		{
+			name:       "invalid email",
+			body:       `{"first_name":"Jane","last_name":"Doe","email":"jane","address":"1 Main St","phone_number":"0123456789","date_of_birth":"1990-01-01"}`,
+			wantStatus: fiber.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeUserService{}
+			handler := NewUserHandler(service, allowAll{})
+
+			app := newTestApp()
+			app.Put("/users/:id", handler.UpdateUser)
+
+			req := httptest.NewRequest(fiber.MethodPut, "/users/7", strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			if tt.wantStatus != fiber.StatusOK {
+				if service.updated != nil {
+					t.Fatal("an invalid profile reached the service")
+				}
+				return
+			}
+
+			if service.updated == nil || service.updated.ID != 7 || service.updated.Email != "jane@example.com" {
+				t.Fatalf("updated = %+v", service.updated)
+			}
+		})
+	}
+}
+
+func TestOwnEmailChange(t *testing.T) {
+	caller := &policy.Principal{UserID: 1, Email: "jane@example.com"}
+	email := func(v string) *string { return &v }
+
+	tests := []struct {
+		name  string
+		id    int
+		email *string
+		want  bool
+	}{
+		{"same email", 1, email("jane@example.com"), false},
+		{"same email in another case", 1, email("Jane@Example.com"), false},
+		{"new email", 1, email("jane@example.org"), true},
+		{"email left out of a patch", 1, nil, false},
+		{"another user", 2, email("john@example.org"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := ownEmailChange(caller, tt.id, tt.email)
+			if got := len(changes) == 1 && changes[0] == "email"; got != tt.want {
+				t.Errorf("ownEmailChange() = %v, want email changed %v", changes, tt.want)
+			}
+		})
+	}
+}
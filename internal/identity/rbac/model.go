@@ -0,0 +1,164 @@
+package rbac
+
+import (
+	"strings"
+	"task/internal/api/errors"
+	"time"
+)
+
+var (
+	ErrRoleNotFound            = errors.New("rbac.role-not-found", "Role not found")
+	ErrRoleAlreadyExists       = errors.New("rbac.role-already-exists", "Role already exists")
+	ErrRoleInUse               = errors.New("rbac.role-in-use", "Role is still the primary role of some users")
+	ErrInvalidRoleName         = errors.New("rbac.invalid-role-name", "Invalid role name")
+	ErrPermissionNotFound      = errors.New("rbac.permission-not-found", "Permission not found")
+	ErrPermissionAlreadyExists = errors.New("rbac.permission-already-exists", "Permission already exists")
+	ErrInvalidPermissionName   = errors.New("rbac.invalid-permission-name", "Invalid permission name")
+	ErrUserNotFound            = errors.New("rbac.user-not-found", "User not found")
+	ErrNoRoles                 = errors.New("rbac.no-roles", "A user needs at least one role")
+)
+
+type Role struct {
+	ID          int       `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	Permissions []string  `db:"-" json:"permissions"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type Permission struct {
+	ID          int       `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// UserAccess is the effective set of roles and permissions of a user
+type UserAccess struct {
+	UserID      int      `json:"user_id"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"` // Primary role stored on the user
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	Timezone    string   `json:"timezone"`
+
+	Active            bool       `json:"-"` // Inactive, pending and deleted accounts cannot authenticate
+	SessionsRevokedAt *time.Time `json:"-"` // Session tokens issued before this are no longer valid
+}
+
+// SessionRevoked reports whether a session token issued at issuedAt was
+// revoked. Token times have a one second resolution, so a token issued in the
+// same second as the revocation is treated as revoked.
+func (a *UserAccess) SessionRevoked(issuedAt time.Time) bool {
+	if a.SessionsRevokedAt == nil {
+		return false
+	}
+	return !issuedAt.After(a.SessionsRevokedAt.Truncate(time.Second))
+}
+
+// HasRole reports whether any of the user's roles is one of roles
+func (a *UserAccess) HasRole(roles ...string) bool {
+	for _, assigned := range a.Roles {
+		for _, role := range roles {
+			if assigned == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether one of the user's roles grants permission
+func (a *UserAccess) HasPermission(permission string) bool {
+	for _, granted := range a.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateRoleCommand struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type UpdateRoleCommand struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type SetRolePermissionsCommand struct {
+	RoleID      int      `json:"-"`
+	Permissions []string `json:"permissions"`
+}
+
+type CreatePermissionCommand struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SetUserRolesCommand replaces the roles of a user. The first role becomes
+// the primary role stored on users.role, the rest are kept in user_roles.
+type SetUserRolesCommand struct {
+	UserID int      `json:"-"`
+	Roles  []string `json:"roles"`
+}
+
+func validName(name string) bool {
+	return len(name) > 0 && len(name) <= 255 && strings.TrimSpace(name) == name && !strings.Contains(name, " ")
+}
+
+// validPermissionName checks the resource:action format, e.g. tasks:approve
+func validPermissionName(name string) bool {
+	resource, action, found := strings.Cut(name, ":")
+	return validName(name) && found && resource != "" && action != "" && !strings.Contains(action, ":")
+}
+
+func (cmd *CreateRoleCommand) Validate() error {
+	if !validName(cmd.Name) {
+		return ErrInvalidRoleName
+	}
+	return nil
+}
+
+func (cmd *UpdateRoleCommand) Validate() error {
+	if cmd.ID <= 0 {
+		return ErrRoleNotFound
+	}
+	if !validName(cmd.Name) {
+		return ErrInvalidRoleName
+	}
+	return nil
+}
+
+func (cmd *SetRolePermissionsCommand) Validate() error {
+	for _, permission := range cmd.Permissions {
+		if !validPermissionName(permission) {
+			return ErrInvalidPermissionName
+		}
+	}
+	return nil
+}
+
+func (cmd *CreatePermissionCommand) Validate() error {
+	if !validPermissionName(cmd.Name) {
+		return ErrInvalidPermissionName
+	}
+	return nil
+}
+
+func (cmd *SetUserRolesCommand) Validate() error {
+	if len(cmd.Roles) == 0 {
+		return ErrNoRoles
+	}
+	for _, role := range cmd.Roles {
+		if !validName(role) {
+			return ErrInvalidRoleName
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package rbac
+
+import "context"
+
+type Service interface {
+	// Roles
+	CreateRole(ctx context.Context, cmd *CreateRoleCommand) error
+	UpdateRole(ctx context.Context, cmd *UpdateRoleCommand) error
+	GetRoleByID(ctx context.Context, id int) (*Role, error)
+	ListRoles(ctx context.Context) ([]*Role, error)
+	DeleteRole(ctx context.Context, id int) error
+	SetRolePermissions(ctx context.Context, cmd *SetRolePermissionsCommand) error
+
+	// Permissions
+	CreatePermission(ctx context.Context, cmd *CreatePermissionCommand) error
+	ListPermissions(ctx context.Context) ([]*Permission, error)
+	DeletePermission(ctx context.Context, id int) error
+
+	// User assignments
+	GetUserRoles(ctx context.Context, userID int) ([]string, error)
+	SetUserRoles(ctx context.Context, cmd *SetUserRolesCommand) error
+
+	// GetUserAccess resolves the effective roles and permissions of a user,
+	// it is served from a cache that role and permission changes invalidate.
+	GetUserAccess(ctx context.Context, email string) (*UserAccess, error)
+
+	// InvalidateUser drops the cached access of a user whose account changed
+	InvalidateUser(userID int)
+}
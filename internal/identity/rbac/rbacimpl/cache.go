@@ -0,0 +1,83 @@
+package rbacimpl
+
+import (
+	"sync"
+	"task/internal/identity/rbac"
+	"time"
+)
+
+// accessCacheTTL bounds how long other instances can serve stale access after
+// a change, changes made through this instance invalidate immediately.
+const accessCacheTTL = time.Minute
+
+type cachedAccess struct {
+	access  *rbac.UserAccess
+	expires time.Time
+}
+
+type accessCache struct {
+	mu      sync.RWMutex
+	entries map[string]*cachedAccess // Keyed by email
+}
+
+func newAccessCache() *accessCache {
+	return &accessCache{
+		entries: make(map[string]*cachedAccess),
+	}
+}
+
+// get evicts an expired entry on read, so users who stop making requests do
+// not keep theirs in memory
+func (c *accessCache) get(email string) (*rbac.UserAccess, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[email]
+	c.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expires) {
+		c.mu.Lock()
+		// Another request may have refreshed the entry in the meantime
+		if c.entries[email] == entry {
+			delete(c.entries, email)
+		}
+		c.mu.Unlock()
+
+		return nil, false
+	}
+
+	return entry.access, true
+}
+
+func (c *accessCache) set(email string, access *rbac.UserAccess) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[email] = &cachedAccess{
+		access:  access,
+		expires: time.Now().Add(accessCacheTTL),
+	}
+}
+
+// invalidateUser drops the entry of a single user
+func (c *accessCache) invalidateUser(userID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for email, entry := range c.entries {
+		if entry.access.UserID == userID {
+			delete(c.entries, email)
+		}
+	}
+}
+
+// invalidateAll is used when roles or permissions change, since any user may
+// be affected.
+func (c *accessCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*cachedAccess)
+}
@@ -0,0 +1,44 @@
+package rbacimpl
+
+import (
+	"task/internal/identity/rbac"
+	"testing"
+	"time"
+)
+
+func TestAccessCacheEvictsExpiredEntries(t *testing.T) {
+	c := newAccessCache()
+	c.set("jane@example.com", &rbac.UserAccess{UserID: 1})
+	c.set("john@example.com", &rbac.UserAccess{UserID: 2})
+
+	c.entries["jane@example.com"].expires = time.Now().Add(-time.Second)
+
+	if _, ok := c.get("jane@example.com"); ok {
+		t.Fatal("expired entry served")
+	}
+
+	if _, ok := c.entries["jane@example.com"]; ok {
+		t.Fatal("expired entry kept after the read")
+	}
+
+	if access, ok := c.get("john@example.com"); !ok || access.UserID != 2 {
+		t.Fatalf("get() = %v, %v, want the fresh entry", access, ok)
+	}
+}
+
+func TestAccessCacheInvalidateUser(t *testing.T) {
+	c := newAccessCache()
+	c.set("jane@example.com", &rbac.UserAccess{UserID: 1})
+	c.set("jane.doe@example.com", &rbac.UserAccess{UserID: 1})
+	c.set("john@example.com", &rbac.UserAccess{UserID: 2})
+
+	c.invalidateUser(1)
+
+	if len(c.entries) != 1 {
+		t.Fatalf("%d entries left, want 1", len(c.entries))
+	}
+
+	if _, ok := c.get("john@example.com"); !ok {
+		t.Fatal("entry of another user dropped")
+	}
+}
@@ -0,0 +1,287 @@
+package rbacimpl
+
+import (
+	"context"
+	"task/config"
+	"task/internal/db"
+	"task/internal/identity/monitoringactivities"
+	"task/internal/identity/rbac"
+
+	"go.uber.org/zap"
+)
+
+type service struct {
+	store *store
+	cache *accessCache
+	cfg   *config.Config
+	log   *zap.Logger
+	db    db.DB
+}
+
+func NewService(db db.DB, cfg *config.Config) *service {
+	return &service{
+		store: NewStore(db),
+		cache: newAccessCache(),
+		cfg:   cfg,
+		db:    db,
+		log:   zap.L().Named("rbac.service"),
+	}
+}
+
+func (s *service) CreateRole(ctx context.Context, cmd *rbac.CreateRoleCommand) error {
+	result, err := s.store.roleTaken(ctx, 0, cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(result) > 0 {
+		return rbac.ErrRoleAlreadyExists
+	}
+
+	return s.store.createRole(ctx, cmd)
+}
+
+func (s *service) UpdateRole(ctx context.Context, cmd *rbac.UpdateRoleCommand) error {
+	result, err := s.store.roleTaken(ctx, cmd.ID, cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	var existing *rbac.Role
+	for _, role := range result {
+		if role.ID == cmd.ID {
+			existing = role
+		} else {
+			return rbac.ErrRoleAlreadyExists
+		}
+	}
+
+	if existing == nil {
+		return rbac.ErrRoleNotFound
+	}
+
+	err = s.store.updateRole(ctx, cmd, existing.Name)
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidateAll()
+
+	return nil
+}
+
+func (s *service) GetRoleByID(ctx context.Context, id int) (*rbac.Role, error) {
+	result, err := s.store.getRoleByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, rbac.ErrRoleNotFound
+	}
+
+	permissions, err := s.store.rolePermissions(ctx, []int{id})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Permissions = withDefault(permissions[id])
+
+	return result, nil
+}
+
+func (s *service) ListRoles(ctx context.Context) ([]*rbac.Role, error) {
+	result, err := s.store.listRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(result))
+	for _, role := range result {
+		ids = append(ids, role.ID)
+	}
+
+	permissions, err := s.store.rolePermissions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range result {
+		role.Permissions = withDefault(permissions[role.ID])
+	}
+
+	return result, nil
+}
+
+func (s *service) DeleteRole(ctx context.Context, id int) error {
+	result, err := s.store.getRoleByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return rbac.ErrRoleNotFound
+	}
+
+	// users.role is a plain string, deleting the role would leave it dangling
+	count, err := s.store.countUsersWithRole(ctx, result.Name)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return rbac.ErrRoleInUse
+	}
+
+	err = s.store.deleteRole(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidateAll()
+
+	return nil
+}
+
+func (s *service) SetRolePermissions(ctx context.Context, cmd *rbac.SetRolePermissionsCommand) error {
+	result, err := s.store.getRoleByID(ctx, cmd.RoleID)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return rbac.ErrRoleNotFound
+	}
+
+	err = s.store.setRolePermissions(ctx, cmd.RoleID, unique(cmd.Permissions))
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidateAll()
+
+	return nil
+}
+
+func (s *service) CreatePermission(ctx context.Context, cmd *rbac.CreatePermissionCommand) error {
+	taken, err := s.store.permissionTaken(ctx, cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	if taken {
+		return rbac.ErrPermissionAlreadyExists
+	}
+
+	return s.store.createPermission(ctx, cmd)
+}
+
+func (s *service) ListPermissions(ctx context.Context) ([]*rbac.Permission, error) {
+	return s.store.listPermissions(ctx)
+}
+
+func (s *service) DeletePermission(ctx context.Context, id int) error {
+	deleted, err := s.store.deletePermission(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !deleted {
+		return rbac.ErrPermissionNotFound
+	}
+
+	s.cache.invalidateAll()
+
+	return nil
+}
+
+func (s *service) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	exists, err := s.store.userExists(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, rbac.ErrUserNotFound
+	}
+
+	return s.store.getUserRoles(ctx, userID)
+}
+
+func (s *service) SetUserRoles(ctx context.Context, cmd *rbac.SetUserRolesCommand) error {
+	exists, err := s.store.userExists(ctx, cmd.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return rbac.ErrUserNotFound
+	}
+
+	before, err := s.store.getUserRoles(ctx, cmd.UserID)
+	if err != nil {
+		return err
+	}
+
+	roles := unique(cmd.Roles)
+
+	err = s.store.setUserRoles(ctx, cmd.UserID, roles)
+	if err != nil {
+		return err
+	}
+
+	s.cache.invalidateUser(cmd.UserID)
+
+	monitoringactivities.Record(ctx, monitoringactivities.EventUserRoleChanged, monitoringactivities.TargetUser, cmd.UserID,
+		map[string]interface{}{"roles": before},
+		map[string]interface{}{"roles": roles},
+	)
+
+	return nil
+}
+
+func (s *service) GetUserAccess(ctx context.Context, email string) (*rbac.UserAccess, error) {
+	if access, ok := s.cache.get(email); ok {
+		return access, nil
+	}
+
+	access, err := s.store.getUserAccess(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if access == nil {
+		return nil, rbac.ErrUserNotFound
+	}
+
+	s.cache.set(email, access)
+
+	return access, nil
+}
+
+func (s *service) InvalidateUser(userID int) {
+	s.cache.invalidateUser(userID)
+}
+
+// unique drops duplicates while keeping the order, the first role given to
+// SetUserRoles is the primary one.
+func unique(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+func withDefault(permissions []string) []string {
+	if permissions == nil {
+		return make([]string, 0)
+	}
+	return permissions
+}
@@ -0,0 +1,441 @@
+package rbacimpl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"task/internal/db"
+	"task/internal/identity/rbac"
+	"task/internal/identity/user"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+type store struct {
+	db     db.DB
+	logger *zap.Logger
+}
+
+func NewStore(db db.DB) *store {
+	return &store{
+		db:     db,
+		logger: zap.L().Named("rbac.store"),
+	}
+}
+
+func (s *store) createRole(ctx context.Context, cmd *rbac.CreateRoleCommand) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			INSERT INTO roles (
+				name,
+				description
+			) VALUES (
+				$1, $2
+			)
+		`
+
+		_, err := tx.Exec(ctx, rawSQL, cmd.Name, cmd.Description)
+		return err
+	})
+}
+
+// updateRole renames a role and the users.role values that point at it
+func (s *store) updateRole(ctx context.Context, cmd *rbac.UpdateRoleCommand, oldName string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE roles
+			SET
+				name = $1,
+				description = $2,
+				updated_at = NOW()
+			WHERE
+				id = $3
+		`
+
+		_, err := tx.Exec(ctx, rawSQL, cmd.Name, cmd.Description, cmd.ID)
+		if err != nil {
+			return err
+		}
+
+		if oldName == cmd.Name {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE users SET role = $1 WHERE role = $2", cmd.Name, oldName)
+		return err
+	})
+}
+
+func (s *store) roleTaken(ctx context.Context, id int, name string) ([]*rbac.Role, error) {
+	var result []*rbac.Role
+
+	rawSQL := `
+		SELECT
+			id,
+			name,
+			COALESCE(description, '') AS description,
+			created_at,
+			updated_at
+		FROM
+			roles
+		WHERE
+			id = $1 OR
+			name = $2
+	`
+
+	err := s.db.Select(ctx, &result, rawSQL, id, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *store) getRoleByID(ctx context.Context, id int) (*rbac.Role, error) {
+	var role rbac.Role
+
+	rawSQL := `
+		SELECT
+			id,
+			name,
+			COALESCE(description, '') AS description,
+			created_at,
+			updated_at
+		FROM
+			roles
+		WHERE
+			id = $1
+	`
+
+	err := s.db.Get(ctx, &role, rawSQL, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (s *store) listRoles(ctx context.Context) ([]*rbac.Role, error) {
+	result := make([]*rbac.Role, 0)
+
+	rawSQL := `
+		SELECT
+			id,
+			name,
+			COALESCE(description, '') AS description,
+			created_at,
+			updated_at
+		FROM
+			roles
+		ORDER BY name
+	`
+
+	err := s.db.Select(ctx, &result, rawSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// rolePermissions returns the permission names of each role keyed by role id
+func (s *store) rolePermissions(ctx context.Context, roleIDs []int) (map[int][]string, error) {
+	var rows []struct {
+		RoleID int    `db:"role_id"`
+		Name   string `db:"name"`
+	}
+
+	rawSQL := `
+		SELECT
+			rp.role_id,
+			p.name
+		FROM
+			role_permissions rp
+		JOIN
+			permissions p
+		ON rp.permission_id = p.id
+		WHERE
+			rp.role_id = ANY($1)
+		ORDER BY p.name
+	`
+
+	err := s.db.Select(ctx, &rows, rawSQL, pq.Array(roleIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int][]string)
+	for _, row := range rows {
+		result[row.RoleID] = append(result[row.RoleID], row.Name)
+	}
+
+	return result, nil
+}
+
+func (s *store) countUsersWithRole(ctx context.Context, name string) (int, error) {
+	var count int
+
+	err := s.db.Get(ctx, &count, "SELECT COUNT(*) FROM users WHERE role = $1", name)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *store) deleteRole(ctx context.Context, id int) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM roles WHERE id = $1", id)
+		return err
+	})
+}
+
+// setRolePermissions replaces the permissions of a role. Unknown permission
+// names fail the whole change.
+func (s *store) setRolePermissions(ctx context.Context, roleID int, permissions []string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		_, err := tx.Exec(ctx, "DELETE FROM role_permissions WHERE role_id = $1", roleID)
+		if err != nil {
+			return err
+		}
+
+		rawSQL := `
+			INSERT INTO role_permissions (
+				role_id,
+				permission_id
+			)
+			SELECT $1, id
+			FROM permissions
+			WHERE name = ANY($2)
+		`
+
+		result, err := tx.Exec(ctx, rawSQL, roleID, pq.Array(permissions))
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if int(affected) != len(permissions) {
+			return rbac.ErrPermissionNotFound
+		}
+
+		return nil
+	})
+}
+
+func (s *store) createPermission(ctx context.Context, cmd *rbac.CreatePermissionCommand) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			INSERT INTO permissions (
+				name,
+				description
+			) VALUES (
+				$1, $2
+			)
+		`
+
+		_, err := tx.Exec(ctx, rawSQL, cmd.Name, cmd.Description)
+		return err
+	})
+}
+
+func (s *store) permissionTaken(ctx context.Context, name string) (bool, error) {
+	var count int
+
+	err := s.db.Get(ctx, &count, "SELECT COUNT(*) FROM permissions WHERE name = $1", name)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (s *store) listPermissions(ctx context.Context) ([]*rbac.Permission, error) {
+	result := make([]*rbac.Permission, 0)
+
+	rawSQL := `
+		SELECT
+			id,
+			name,
+			COALESCE(description, '') AS description,
+			created_at,
+			updated_at
+		FROM
+			permissions
+		ORDER BY name
+	`
+
+	err := s.db.Select(ctx, &result, rawSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *store) deletePermission(ctx context.Context, id int) (bool, error) {
+	result, err := s.db.Exec(ctx, "DELETE FROM permissions WHERE id = $1", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (s *store) userExists(ctx context.Context, userID int) (bool, error) {
+	var count int
+
+	err := s.db.Get(ctx, &count, "SELECT COUNT(*) FROM users WHERE id = $1", userID)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// getUserRoles returns the primary role stored on users.role followed by the
+// additional roles in user_roles.
+func (s *store) getUserRoles(ctx context.Context, userID int) ([]string, error) {
+	result := make([]string, 0)
+
+	rawSQL := `
+		SELECT name
+		FROM (
+			SELECT u.role AS name, 0 AS position
+			FROM users u
+			WHERE u.id = $1 AND u.role IS NOT NULL
+			UNION
+			SELECT r.name, 1 AS position
+			FROM roles r
+			JOIN user_roles ur ON ur.role_id = r.id
+			WHERE ur.user_id = $1
+		) AS assigned
+		GROUP BY name
+		ORDER BY MIN(position), name
+	`
+
+	err := s.db.Select(ctx, &result, rawSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// setUserRoles stores the first role as the primary role on users.role and
+// the rest as additional roles.
+func (s *store) setUserRoles(ctx context.Context, userID int, roles []string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		var known int
+
+		err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM roles WHERE name = ANY($1)", pq.Array(roles)).Scan(&known)
+		if err != nil {
+			return err
+		}
+
+		if known != len(roles) {
+			return rbac.ErrRoleNotFound
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE users SET role = $1, updated_at = NOW() WHERE id = $2", roles[0], userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, "DELETE FROM user_roles WHERE user_id = $1", userID)
+		if err != nil {
+			return err
+		}
+
+		rawSQL := `
+			INSERT INTO user_roles (
+				user_id,
+				role_id
+			)
+			SELECT $1, id
+			FROM roles
+			WHERE name = ANY($2)
+		`
+
+		_, err = tx.Exec(ctx, rawSQL, userID, pq.Array(roles[1:]))
+		return err
+	})
+}
+
+func (s *store) getUserAccess(ctx context.Context, email string) (*rbac.UserAccess, error) {
+	var principal struct {
+		ID                int            `db:"id"`
+		Role              sql.NullString `db:"role"`
+		Timezone          string         `db:"timezone"`
+		Active            bool           `db:"active"`
+		SessionsRevokedAt *time.Time     `db:"sessions_revoked_at"`
+	}
+
+	rawSQL := `
+		SELECT
+			id,
+			role,
+			timezone,
+			status = $2 AS active,
+			sessions_revoked_at
+		FROM
+			users
+		WHERE
+			email = $1
+	`
+
+	err := s.db.Get(ctx, &principal, rawSQL, email, user.Active)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	roles, err := s.getUserRoles(ctx, principal.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := make([]string, 0)
+
+	rawSQL = `
+		SELECT DISTINCT p.name
+		FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		JOIN roles r ON r.id = rp.role_id
+		WHERE r.name = ANY($1)
+		ORDER BY p.name
+	`
+
+	err = s.db.Select(ctx, &permissions, rawSQL, pq.Array(roles))
+	if err != nil {
+		return nil, err
+	}
+
+	return &rbac.UserAccess{
+		UserID:      principal.ID,
+		Email:       email,
+		Role:        principal.Role.String,
+		Timezone:    principal.Timezone,
+		Roles:       roles,
+		Permissions: permissions,
+
+		Active:            principal.Active,
+		SessionsRevokedAt: principal.SessionsRevokedAt,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package sso
+
+import (
+	"crypto/subtle"
+	"task/internal/api/errors"
+	"time"
+)
+
+var (
+	ErrProviderNotFound = errors.New("sso.provider-not-found", "Unknown identity provider")
+	ErrInvalidState     = errors.New("sso.invalid-state", "Invalid or expired login state")
+	ErrExchangeFailed   = errors.New("sso.exchange-failed", "Could not exchange the authorization code")
+	ErrInvalidIDToken   = errors.New("sso.invalid-id-token", "Identity provider returned an invalid ID token")
+	ErrEmailNotVerified = errors.New("sso.email-not-verified", "Identity provider did not verify the email address")
+	ErrAccessDenied     = errors.New("sso.access-denied", "Identity provider denied the login")
+	ErrAccountInactive  = errors.New("sso.account-inactive", "Account has been deactivated")
+)
+
+// Identity links a user to an account at an identity provider
+type Identity struct {
+	ID          int        `db:"id" json:"id"`
+	UserID      int        `db:"user_id" json:"user_id"`
+	Provider    string     `db:"provider" json:"provider"`
+	Subject     string     `db:"subject" json:"subject"`
+	Email       string     `db:"email" json:"email"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	LastLoginAt *time.Time `db:"last_login_at" json:"last_login_at"`
+}
+
+// Authorization is where the browser is sent to log in. State has to come
+// back to the callback from the same browser, the handler keeps it in a cookie.
+type Authorization struct {
+	URL       string
+	State     string
+	ExpiresAt time.Time
+}
+
+// LoginState is kept between the redirect to the provider and the callback
+type LoginState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+}
+
+// ExternalUser is what the provider tells us about the user
+type ExternalUser struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Groups        []string
+}
+
+type CallbackCommand struct {
+	Provider         string `query:"-"`
+	Code             string `query:"code"`
+	State            string `query:"state"`
+	Error            string `query:"error"`
+	ErrorDescription string `query:"error_description"`
+	BrowserState     string `query:"-"` // State kept by the browser that started the login
+}
+
+// Validate also ties the callback to the browser that started the login, so
+// a code obtained by someone else cannot log the browser into their account
+func (cmd *CallbackCommand) Validate() error {
+	if len(cmd.Error) > 0 {
+		return ErrAccessDenied
+	}
+
+	if len(cmd.Code) == 0 || len(cmd.State) == 0 {
+		return ErrInvalidState
+	}
+
+	if subtle.ConstantTimeCompare([]byte(cmd.State), []byte(cmd.BrowserState)) != 1 {
+		return ErrInvalidState
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package sso
+
+import "testing"
+
+func TestCallbackCommandValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  CallbackCommand
+		want error
+	}{
+		{"state kept by the browser", CallbackCommand{Code: "code", State: "state", BrowserState: "state"}, nil},
+		{"no state cookie", CallbackCommand{Code: "code", State: "state"}, ErrInvalidState},
+		{"state of another login", CallbackCommand{Code: "code", State: "state", BrowserState: "other"}, ErrInvalidState},
+		{"no state", CallbackCommand{Code: "code", BrowserState: "state"}, ErrInvalidState},
+		{"no code", CallbackCommand{State: "state", BrowserState: "state"}, ErrInvalidState},
+		{"denied by the provider", CallbackCommand{Error: "access_denied", State: "state", BrowserState: "state"}, ErrAccessDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cmd.Validate(); err != tt.want {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package sso
+
+import (
+	"context"
+	"task/internal/identity/user"
+)
+
+type Service interface {
+	// AuthorizationURL starts an authorization code + PKCE login
+	AuthorizationURL(ctx context.Context, provider string) (*Authorization, error)
+	// Callback finishes the login and returns a session token, or the token
+	// for the two-factor step the user still has to pass
+	Callback(ctx context.Context, cmd *CallbackCommand) (*user.LoginResult, error)
+}
@@ -0,0 +1,352 @@
+package ssoimpl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"task/config"
+	"task/internal/db"
+	"task/internal/identity/sso"
+	"task/internal/identity/user"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"golang.org/x/oauth2"
+)
+
+const (
+	loginStateTTL    = 10 * time.Minute
+	discoveryTimeout = 10 * time.Second
+)
+
+type service struct {
+	store       *store
+	cfg         *config.Config
+	log         *zap.Logger
+	db          db.DB
+	redisClient *redis.Client
+	users       user.Service
+
+	mu        sync.Mutex
+	providers map[string]*oidc.Provider
+}
+
+func NewService(db db.DB, cfg *config.Config, users user.Service) *service {
+	return &service{
+		store:       NewStore(db),
+		cfg:         cfg,
+		db:          db,
+		redisClient: cfg.RedisClient,
+		users:       users,
+		log:         zap.L().Named("sso.service"),
+		providers:   make(map[string]*oidc.Provider),
+	}
+}
+
+// provider discovers the issuer on first use so an unreachable identity
+// provider does not keep the server from starting.
+func (s *service) provider(name string) (*config.OIDCProviderConfig, *oidc.Provider, error) {
+	providerCfg, ok := s.cfg.OIDCProviders[name]
+	if !ok {
+		return nil, nil, sso.ErrProviderNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if provider, ok := s.providers[name]; ok {
+		return &providerCfg, provider, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	defer cancel()
+
+	provider, err := oidc.NewProvider(ctx, providerCfg.IssuerURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.providers[name] = provider
+
+	return &providerCfg, provider, nil
+}
+
+func oauth2Config(providerCfg *config.OIDCProviderConfig, provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     providerCfg.ClientID,
+		ClientSecret: providerCfg.ClientSecret,
+		RedirectURL:  providerCfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       providerCfg.Scopes,
+	}
+}
+
+func (s *service) AuthorizationURL(ctx context.Context, name string) (*sso.Authorization, error) {
+	providerCfg, provider, err := s.provider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	loginState := &sso.LoginState{
+		Provider: name,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+	}
+
+	payload, err := json.Marshal(loginState)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.redisClient.Set(ctx, stateKey(state), payload, loginStateTTL).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	url := oauth2Config(providerCfg, provider).AuthCodeURL(
+		state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(loginState.Verifier),
+	)
+
+	return &sso.Authorization{
+		URL:       url,
+		State:     state,
+		ExpiresAt: time.Now().Add(loginStateTTL),
+	}, nil
+}
+
+func (s *service) Callback(ctx context.Context, cmd *sso.CallbackCommand) (*user.LoginResult, error) {
+	providerCfg, provider, err := s.provider(cmd.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	loginState, err := s.consumeState(ctx, cmd.State)
+	if err != nil {
+		return nil, err
+	}
+
+	if loginState.Provider != cmd.Provider {
+		return nil, sso.ErrInvalidState
+	}
+
+	token, err := oauth2Config(providerCfg, provider).Exchange(ctx, cmd.Code, oauth2.VerifierOption(loginState.Verifier))
+	if err != nil {
+		s.log.Warn("Authorization code exchange failed", zap.String("provider", cmd.Provider), zap.Error(err))
+		return nil, sso.ErrExchangeFailed
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, sso.ErrInvalidIDToken
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: providerCfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		s.log.Warn("ID token verification failed", zap.String("provider", cmd.Provider), zap.Error(err))
+		return nil, sso.ErrInvalidIDToken
+	}
+
+	if idToken.Nonce != loginState.Nonce {
+		return nil, sso.ErrInvalidIDToken
+	}
+
+	ext, err := externalUser(providerCfg, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.resolveUser(ctx, providerCfg, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Status != user.Active {
+		return nil, sso.ErrAccountInactive
+	}
+
+	// The identity provider replaces the password, not the second factor
+	return s.users.CompleteLogin(ctx, result.ID)
+}
+
+// resolveUser finds the user linked to the external account, links an
+// existing user with the same email, or provisions a new one.
+func (s *service) resolveUser(ctx context.Context, providerCfg *config.OIDCProviderConfig, ext *sso.ExternalUser) (*user.User, error) {
+	identity, err := s.store.getIdentity(ctx, ext.Provider, ext.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity != nil {
+		err = s.store.touchIdentity(ctx, identity.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.store.getUserByID(ctx, identity.UserID)
+	}
+
+	// Linking by email is only safe when the provider vouches for it
+	if !ext.EmailVerified {
+		return nil, sso.ErrEmailNotVerified
+	}
+
+	existing, err := s.store.getUserByEmail(ctx, ext.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		err = s.store.linkIdentity(ctx, existing.ID, ext)
+		if err != nil {
+			return nil, err
+		}
+
+		s.log.Info("Linked SSO identity to existing user", zap.String("provider", ext.Provider), zap.Int("user_id", existing.ID))
+		return existing, nil
+	}
+
+	role := mapRole(providerCfg, ext.Groups)
+
+	id, err := s.store.provisionUser(ctx, ext, role)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Provisioned user from SSO login", zap.String("provider", ext.Provider), zap.Int("user_id", id), zap.String("role", role))
+
+	return s.store.getUserByID(ctx, id)
+}
+
+func (s *service) consumeState(ctx context.Context, state string) (*sso.LoginState, error) {
+	// A state can only be used once, reading and deleting it in one command
+	// keeps two concurrent callbacks from both using it
+	payload, err := s.redisClient.GetDel(ctx, stateKey(state)).Bytes()
+	if err == redis.Nil {
+		return nil, sso.ErrInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var loginState sso.LoginState
+	err = json.Unmarshal(payload, &loginState)
+	if err != nil {
+		return nil, sso.ErrInvalidState
+	}
+
+	return &loginState, nil
+}
+
+func externalUser(providerCfg *config.OIDCProviderConfig, idToken *oidc.IDToken) (*sso.ExternalUser, error) {
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+		Name          string `json:"name"`
+	}
+
+	err := idToken.Claims(&claims)
+	if err != nil {
+		return nil, sso.ErrInvalidIDToken
+	}
+
+	var rawClaims map[string]interface{}
+	err = idToken.Claims(&rawClaims)
+	if err != nil {
+		return nil, sso.ErrInvalidIDToken
+	}
+
+	if claims.Email == "" {
+		return nil, sso.ErrInvalidIDToken
+	}
+
+	ext := &sso.ExternalUser{
+		Provider:      providerCfg.Name,
+		Subject:       idToken.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: claims.EmailVerified != nil && *claims.EmailVerified,
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+		Groups:        stringList(rawClaims[providerCfg.GroupsClaim]),
+	}
+
+	if ext.FirstName == "" && ext.LastName == "" {
+		ext.FirstName, ext.LastName, _ = strings.Cut(claims.Name, " ")
+	}
+
+	if ext.FirstName == "" {
+		ext.FirstName, _, _ = strings.Cut(ext.Email, "@")
+	}
+
+	return ext, nil
+}
+
+// mapRole returns the role of the first configured mapping the user's groups
+// match, falling back to the provider's default role.
+func mapRole(providerCfg *config.OIDCProviderConfig, groups []string) string {
+	member := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		member[group] = true
+	}
+
+	for _, mapping := range providerCfg.RoleMapping {
+		if member[mapping.Group] && user.IsValidRole(mapping.Role) {
+			return mapping.Role
+		}
+	}
+
+	if user.IsValidRole(providerCfg.DefaultRole) {
+		return providerCfg.DefaultRole
+	}
+
+	return user.RoleUser
+}
+
+// stringList accepts a claim holding either a single string or a list
+func stringList(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+
+	return nil
+}
+
+func stateKey(state string) string {
+	return "oidc:state:" + state
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,498 @@
+package ssoimpl
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"task/config"
+	"task/internal/db"
+	"task/internal/identity/sso"
+	"task/internal/identity/user"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	testProvider = "corp"
+	testClientID = "task-app"
+)
+
+// stubIdP is an OpenID provider that logs in a single account. It checks the
+// PKCE verifier and puts the nonce of the authorization request in the ID token.
+type stubIdP struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	subject string
+	email   string
+
+	mu     sync.Mutex
+	logins map[string]url.Values // Authorization requests by code
+}
+
+func newStubIdP(t *testing.T, subject, email string) *stubIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &stubIdP{key: key, subject: subject, email: email, logins: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/keys", idp.keys)
+	mux.HandleFunc("/token", idp.token)
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+func (idp *stubIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                idp.URL,
+		"authorization_endpoint":                idp.URL + "/authorize",
+		"token_endpoint":                        idp.URL + "/token",
+		"jwks_uri":                              idp.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (idp *stubIdP) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize plays the user logging in at the provider, it returns the code
+// the browser brings back to the callback
+func (idp *stubIdP) authorize(t *testing.T, authURL string) string {
+	t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	code := "code-" + strconv.Itoa(len(idp.logins))
+	idp.logins[code] = query
+
+	return code
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	idp.mu.Lock()
+	login, ok := idp.logins[r.PostForm.Get("code")]
+	delete(idp.logins, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != login.Get("code_challenge") {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            idp.URL,
+		"aud":            testClientID,
+		"sub":            idp.subject,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          login.Get("nonce"),
+		"email":          idp.email,
+		"email_verified": true,
+		"name":           "Jane Doe",
+	})
+	idToken.Header["kid"] = "test"
+
+	signed, err := idToken.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// fakeRedis speaks enough RESP for the login state, GET and DEL are left out
+// so a state can only be read by consuming it
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newFakeRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &fakeRedis{values: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+
+	client := redis.NewClient(&redis.Options{Addr: listener.Addr().String()})
+	t.Cleanup(func() {
+		client.Close()
+		listener.Close()
+	})
+
+	return client
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		r.mu.Lock()
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "SET":
+			r.values[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case "GETDEL":
+			value, ok := r.values[args[1]]
+			delete(r.values, args[1])
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		r.mu.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, err
+		}
+		args[i] = string(value[:size])
+	}
+
+	return args, nil
+}
+
+// fakeDB holds local users and linked identities, it compares emails the way
+// the queries of the store ask Postgres to
+type fakeDB struct {
+	users      []user.User
+	identities []sso.Identity
+}
+
+func (f *fakeDB) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	switch dest := dest.(type) {
+	case *sso.Identity:
+		for _, identity := range f.identities {
+			if identity.Provider == args[0] && identity.Subject == args[1] {
+				*dest = identity
+				return nil
+			}
+		}
+
+	case *user.User:
+		for _, u := range f.users {
+			switch {
+			case strings.Contains(query, "LOWER(email) = $1") && strings.ToLower(u.Email) == args[0]:
+			case strings.Contains(query, "id = $1") && u.ID == args[0]:
+			case strings.Contains(query, "email = $1") && u.Email == args[0]:
+			default:
+				continue
+			}
+			*dest = u
+			return nil
+		}
+
+	default:
+		return errors.New("unexpected get")
+	}
+
+	return sql.ErrNoRows
+}
+
+func (f *fakeDB) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return errors.New("unexpected select")
+}
+
+func (f *fakeDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (f *fakeDB) Queryx(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (db.Tx, error) {
+	return nil, errors.New("unexpected transaction")
+}
+
+func (f *fakeDB) WithTransaction(ctx context.Context, fn func(ctx context.Context, tx db.Tx) error) error {
+	return fn(ctx, &fakeTx{db: f})
+}
+
+// fakeTx links identities, provisioning is out of reach as it scans a row
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (t *fakeTx) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if !strings.Contains(query, "INSERT INTO user_identities") {
+		return nil, errors.New("unexpected exec")
+	}
+
+	t.db.identities = append(t.db.identities, sso.Identity{
+		ID:       len(t.db.identities) + 1,
+		UserID:   args[0].(int),
+		Provider: args[1].(string),
+		Subject:  args[2].(string),
+		Email:    args[3].(string),
+	})
+
+	return nil, nil
+}
+
+func (t *fakeTx) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (t *fakeTx) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (t *fakeTx) Commit() error   { return nil }
+func (t *fakeTx) Rollback() error { return nil }
+
+// fakeUserService issues a session token naming the user
+type fakeUserService struct {
+	user.Service
+}
+
+func (f *fakeUserService) CompleteLogin(ctx context.Context, id int) (*user.LoginResult, error) {
+	return &user.LoginResult{Token: "session-" + strconv.Itoa(id)}, nil
+}
+
+func newTestService(t *testing.T, idp *stubIdP, database *fakeDB) *service {
+	t.Helper()
+
+	cfg := &config.Config{
+		RedisClient: newFakeRedis(t),
+		OIDCProviders: map[string]config.OIDCProviderConfig{
+			testProvider: {
+				Name:         testProvider,
+				IssuerURL:    idp.URL,
+				ClientID:     testClientID,
+				ClientSecret: "secret",
+				RedirectURL:  "http://localhost:8080/api/auth/oidc/corp/callback",
+				Scopes:       []string{"openid", "email", "profile"},
+				DefaultRole:  user.RoleUser,
+			},
+		},
+	}
+
+	return NewService(database, cfg, &fakeUserService{})
+}
+
+// login runs a login up to the callback, returning the command the browser
+// brings back
+func login(t *testing.T, s *service, idp *stubIdP) *sso.CallbackCommand {
+	t.Helper()
+
+	auth, err := s.AuthorizationURL(context.Background(), testProvider)
+	if err != nil {
+		t.Fatalf("AuthorizationURL: %v", err)
+	}
+
+	if !strings.Contains(auth.URL, "state="+url.QueryEscape(auth.State)) {
+		t.Fatalf("authorization URL %s does not carry the state", auth.URL)
+	}
+
+	return &sso.CallbackCommand{
+		Provider:     testProvider,
+		Code:         idp.authorize(t, auth.URL),
+		State:        auth.State,
+		BrowserState: auth.State,
+	}
+}
+
+func TestCallbackLinksExistingUser(t *testing.T) {
+	idp := newStubIdP(t, "subject-1", "jane.doe@example.com")
+	database := &fakeDB{
+		users: []user.User{{ID: 7, Email: "Jane.Doe@Example.com", Status: user.Active}},
+	}
+	s := newTestService(t, idp, database)
+
+	result, err := s.Callback(context.Background(), login(t, s, idp))
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+
+	if result.Token != "session-7" {
+		t.Fatalf("token = %q, want a session for the local user", result.Token)
+	}
+
+	if len(database.identities) != 1 || database.identities[0].UserID != 7 || database.identities[0].Subject != "subject-1" {
+		t.Fatalf("identities = %+v", database.identities)
+	}
+
+	// The next login goes through the linked identity
+	result, err = s.Callback(context.Background(), login(t, s, idp))
+	if err != nil {
+		t.Fatalf("second Callback: %v", err)
+	}
+
+	if result.Token != "session-7" || len(database.identities) != 1 {
+		t.Fatalf("second login: token %q, %d identities", result.Token, len(database.identities))
+	}
+}
+
+func TestCallbackRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, s *service, cmd *sso.CallbackCommand)
+		want   error
+	}{
+		{
+			name: "replayed state",
+			change: func(t *testing.T, s *service, cmd *sso.CallbackCommand) {
+				if _, err := s.consumeState(context.Background(), cmd.State); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: sso.ErrInvalidState,
+		},
+		{
+			name: "unknown state",
+			change: func(t *testing.T, s *service, cmd *sso.CallbackCommand) {
+				cmd.State = "forged"
+			},
+			want: sso.ErrInvalidState,
+		},
+		{
+			name: "code of another login",
+			change: func(t *testing.T, s *service, cmd *sso.CallbackCommand) {
+				cmd.Code = "code-from-elsewhere"
+			},
+			want: sso.ErrExchangeFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newStubIdP(t, "subject-1", "jane.doe@example.com")
+			database := &fakeDB{
+				users: []user.User{{ID: 7, Email: "jane.doe@example.com", Status: user.Active}},
+			}
+			s := newTestService(t, idp, database)
+
+			cmd := login(t, s, idp)
+			tt.change(t, s, cmd)
+
+			if _, err := s.Callback(context.Background(), cmd); err != tt.want {
+				t.Fatalf("Callback() error = %v, want %v", err, tt.want)
+			}
+
+			if len(database.identities) != 0 {
+				t.Fatalf("a rejected login linked %+v", database.identities)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package ssoimpl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"task/internal/db"
+	"task/internal/identity/sso"
+	"task/internal/identity/user"
+
+	"go.uber.org/zap"
+)
+
+type store struct {
+	db     db.DB
+	logger *zap.Logger
+}
+
+func NewStore(db db.DB) *store {
+	return &store{
+		db:     db,
+		logger: zap.L().Named("sso.store"),
+	}
+}
+
+func (s *store) getIdentity(ctx context.Context, provider, subject string) (*sso.Identity, error) {
+	var identity sso.Identity
+
+	rawSQL := `
+		SELECT
+			id,
+			user_id,
+			provider,
+			subject,
+			COALESCE(email, '') AS email,
+			created_at,
+			last_login_at
+		FROM
+			user_identities
+		WHERE
+			provider = $1 AND
+			subject = $2
+	`
+
+	err := s.db.Get(ctx, &identity, rawSQL, provider, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+func (s *store) getUser(ctx context.Context, column string, value interface{}) (*user.User, error) {
+	var result user.User
+
+	rawSQL := `
+		SELECT
+			id,
+			email,
+			role,
+			status,
+			email_verified_at
+		FROM
+			users
+		WHERE
+			` + column + ` = $1
+	`
+
+	err := s.db.Get(ctx, &result, rawSQL, value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *store) getUserByID(ctx context.Context, id int) (*user.User, error) {
+	return s.getUser(ctx, "id", id)
+}
+
+// getUserByEmail ignores case, local accounts may have been created with
+// capitals the provider does not use
+func (s *store) getUserByEmail(ctx context.Context, email string) (*user.User, error) {
+	return s.getUser(ctx, "LOWER(email)", strings.ToLower(email))
+}
+
+// linkIdentity attaches the external account to an existing user
+func (s *store) linkIdentity(ctx context.Context, userID int, ext *sso.ExternalUser) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		return insertIdentity(ctx, tx, userID, ext)
+	})
+}
+
+// provisionUser creates a verified, active user for the external account and
+// links the two in one transaction.
+func (s *store) provisionUser(ctx context.Context, ext *sso.ExternalUser, role string) (int, error) {
+	var id int
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		// SSO users have no local password, an empty hash never matches
+		rawSQL := `
+			INSERT INTO users (
+				first_name,
+				last_name,
+				email,
+				password_hash,
+				address,
+				phone_number,
+				role,
+				status,
+				email_verified_at
+			) VALUES (
+				$1, $2, $3, '', '', '', $4, $5, NOW()
+			) RETURNING id
+		`
+
+		err := tx.QueryRow(
+			ctx,
+			rawSQL,
+			ext.FirstName,
+			ext.LastName,
+			ext.Email,
+			role,
+			user.Active,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		return insertIdentity(ctx, tx, id, ext)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (s *store) touchIdentity(ctx context.Context, id int) error {
+	rawSQL := `
+		UPDATE user_identities
+		SET last_login_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := s.db.Exec(ctx, rawSQL, id)
+	return err
+}
+
+func insertIdentity(ctx context.Context, tx db.Tx, userID int, ext *sso.ExternalUser) error {
+	rawSQL := `
+		INSERT INTO user_identities (
+			user_id,
+			provider,
+			subject,
+			email,
+			last_login_at
+		) VALUES (
+			$1, $2, $3, $4, NOW()
+		)
+	`
+
+	_, err := tx.Exec(ctx, rawSQL, userID, ext.Provider, ext.Subject, ext.Email)
+	return err
+}
@@ -2,6 +2,7 @@ package task
 
 import (
 	"task/internal/api/errors"
+	"time"
 )
 
 var (
@@ -12,11 +13,13 @@ var (
 	ErrInvalidUserID                    = errors.New("task.invalid-user-id", "Invalid user id")
 	ErrInvalidTaskPriority              = errors.New("task.invalid-priority", "Invalid task priority")
 	ErrInvalidTaskDifficulty            = errors.New("task.invalid-difficulty", "Invalid task difficulty")
-	ErrOnlySuperuserCanApproveTheTask   = errors.New("task.only-superuser-can-approve-the-task", "Only superuser can approve the task")
 	TaskIsNotReadyForApproval           = errors.New("task.is-not-ready-for-approval", "Task is not ready for approval")
 	ErrOnlyAssignedUserCanSubmitTheTask = errors.New("task.only-assigned-user-can-submit-the-task", "Only assigned user can submit the task")
 	TaskIsNotReadyForSubmission         = errors.New("task.is-not-ready-for-submission", "Task is not ready for submission")
 	TaskIsNotPending                    = errors.New("task.is-not-pending", "Task is not pending")
+	ErrInvalidPatch                     = errors.New("task.invalid-patch", "Invalid JSON merge patch")
+	ErrVersionConflict                  = errors.New("task.version-conflict", "Task was modified by someone else, reload it and try again")
+	ErrDepartmentNotFound               = errors.New("task.department-not-found", "Department not found")
 )
 
 type TaskStatus int
@@ -27,6 +30,26 @@ const (
 	TaskDone
 )
 
+// Names of the statuses in the department dashboard
+var statusNames = map[TaskStatus]string{
+	TaskPending:   "pending",
+	TaskReviewing: "reviewing",
+	TaskDone:      "done",
+}
+
+func (s TaskStatus) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+const (
+	DefaultThroughputWeeks = 8
+	MaxThroughputWeeks     = 52
+	MaxOverdueItems        = 50 // Overdue tasks listed in the dashboard, the count covers all
+)
+
 var validPriorities = map[string]bool{
 	"low":    true,
 	"medium": true,
@@ -40,45 +63,78 @@ var validDifficulties = map[string]bool{
 }
 
 type Task struct {
-	ID          int        `db:"id" json:"id"`
-	Title       string     `db:"title" json:"title"`
-	Description string     `db:"description" json:"description"`
-	Status      TaskStatus `db:"status" json:"status"`
-	Priority    string     `db:"priority" json:"priority"`
-	Difficulty  string     `db:"difficulty" json:"difficulty"`
-	UserID      int        `db:"user_id" json:"user_id"`
-	CreatedAt   string     `db:"created_at" json:"created_at"`
-	UpdatedAt   string     `db:"updated_at" json:"updated_at"`
+	ID           int        `db:"id" json:"id"`
+	Title        string     `db:"title" json:"title"`
+	Description  string     `db:"description" json:"description"`
+	Status       TaskStatus `db:"status" json:"status"`
+	Priority     string     `db:"priority" json:"priority"`
+	Difficulty   string     `db:"difficulty" json:"difficulty"`
+	UserID       int        `db:"user_id" json:"user_id"`
+	DepartmentID *int       `db:"department_id" json:"department_id"`
+	DueAt        *time.Time `db:"due_at" json:"due_at"`
+	CompletedAt  *time.Time `db:"completed_at" json:"completed_at"` // Set when the task is done
+	CreatedAt    string     `db:"created_at" json:"created_at"`
+	UpdatedAt    string     `db:"updated_at" json:"updated_at"`
+	Version      int        `db:"version" json:"version"` // Incremented on every update, used as ETag
+}
+
+// In renders the due and completion dates in loc
+func (t *Task) In(loc *time.Location) {
+	if t.DueAt != nil {
+		dueAt := t.DueAt.In(loc)
+		t.DueAt = &dueAt
+	}
+
+	if t.CompletedAt != nil {
+		completedAt := t.CompletedAt.In(loc)
+		t.CompletedAt = &completedAt
+	}
 }
 
+// CreateTaskCommand creates a task, without DepartmentID it goes to the main
+// department of the assignee
 type CreateTaskCommand struct {
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Status      TaskStatus `json:"status"`
-	Priority    string     `json:"priority"`
-	Difficulty  string     `json:"difficulty"`
-	UserID      int        `json:"user_id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Status       TaskStatus `json:"status"`
+	Priority     string     `json:"priority"`
+	Difficulty   string     `json:"difficulty"`
+	UserID       int        `json:"user_id"`
+	DepartmentID *int       `json:"department_id"`
+	DueAt        *time.Time `json:"due_at"`
 }
 
+// UpdateTaskCommand changes the task but not its status, which only moves
+// through submit and approve. Changing UserID reassigns the task.
 type UpdateTaskCommand struct {
-	ID          int        `json:"id"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Priority    string     `json:"priority"`
-	Difficulty  string     `json:"difficulty"`
-	Status      TaskStatus `json:"status"`
-	UserID      int        `json:"user_id"`
+	ID           int        `json:"id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Priority     string     `json:"priority"`
+	Difficulty   string     `json:"difficulty"`
+	UserID       int        `json:"user_id"`
+	DepartmentID *int       `json:"department_id"`
+	DueAt        *time.Time `json:"due_at"`
+	Version      int        `json:"-"` // Expected version from If-Match, 0 skips the check
+}
+
+// PatchTaskCommand applies a JSON Merge Patch to the fields of UpdateTaskCommand
+type PatchTaskCommand struct {
+	ID      int
+	Patch   []byte
+	Version int // Expected version from If-Match, 0 skips the check
 }
 
 type SearchTaskQuery struct {
-	Title       string `query:"title"`
-	Description string `query:"description"`
-	Status      string `query:"status"`
-	Priority    string `query:"priority"`
-	Difficulty  string `query:"difficulty"`
-	UserID      int    `query:"user_id"`
-	Page        int    `query:"page"`
-	PerPage     int    `query:"per_page"`
+	Title        string `query:"title"`
+	Description  string `query:"description"`
+	Status       string `query:"status"`
+	Priority     string `query:"priority"`
+	Difficulty   string `query:"difficulty"`
+	UserID       int    `query:"user_id"`
+	DepartmentID int    `query:"department_id"`
+	Page         int    `query:"page"`
+	PerPage      int    `query:"per_page"`
 }
 
 type SearchTaskResult struct {
@@ -88,6 +144,31 @@ type SearchTaskResult struct {
 	PerPage    int     `json:"per_page"`
 }
 
+// DepartmentDashboardQuery selects the department and how many weeks of
+// throughput, the current one included, the dashboard covers
+type DepartmentDashboardQuery struct {
+	DepartmentID int            `query:"-"`
+	Weeks        int            `query:"weeks"`
+	Location     *time.Location `query:"-"` // Weeks start on Monday in this timezone, UTC when nil
+}
+
+// Throughput is the number of tasks done during the week starting at Week
+type Throughput struct {
+	Week      time.Time `db:"week" json:"week"`
+	Completed int       `db:"completed" json:"completed"`
+}
+
+type DepartmentDashboard struct {
+	DepartmentID int            `json:"department_id"`
+	Total        int            `json:"total"`
+	ByStatus     map[string]int `json:"by_status"`
+	ByPriority   map[string]int `json:"by_priority"`
+	ByDifficulty map[string]int `json:"by_difficulty"`
+	OverdueCount int            `json:"overdue_count"`
+	Overdue      []*Task        `json:"overdue"` // Oldest due first, at most MaxOverdueItems
+	Throughput   []*Throughput  `json:"throughput"`
+}
+
 type SubmitTaskCommand struct {
 	TaskID int `json:"task_id"`
 	UserID int `json:"user_id"`
@@ -119,6 +200,10 @@ func (cmd *CreateTaskCommand) Validate() error {
 		return ErrInvalidTaskDifficulty
 	}
 
+	if cmd.DepartmentID != nil && *cmd.DepartmentID <= 0 {
+		return ErrDepartmentNotFound
+	}
+
 	return nil
 }
 
@@ -147,5 +232,9 @@ func (cmd *UpdateTaskCommand) Validate() error {
 		return ErrInvalidTaskDifficulty
 	}
 
+	if cmd.DepartmentID != nil && *cmd.DepartmentID <= 0 {
+		return ErrDepartmentNotFound
+	}
+
 	return nil
 }
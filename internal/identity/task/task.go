@@ -5,10 +5,14 @@ import "context"
 type Service interface {
 	CreateTask(ctx context.Context, cmd *CreateTaskCommand) error
 	UpdateTask(ctx context.Context, cmd *UpdateTaskCommand) error
+	PatchTask(ctx context.Context, cmd *PatchTaskCommand) (*Task, error)
 	GetTaskByID(ctx context.Context, id int) (*Task, error)
 	DeleteTask(ctx context.Context, id int) error
 	SearchTask(ctx context.Context, query *SearchTaskQuery) (*SearchTaskResult, error)
 
+	// Counts, overdue tasks and weekly throughput of a department
+	GetDepartmentDashboard(ctx context.Context, query *DepartmentDashboardQuery) (*DepartmentDashboard, error)
+
 	SubmitTask(ctx context.Context, cmd *SubmitTaskCommand) error
 	ApprovedTask(ctx context.Context, cmd *ApproveTaskCommand) error
 }
@@ -25,8 +25,10 @@ func NewStore(db db.DB) *store {
 	}
 }
 
-func (s *store) create(ctx context.Context, cmd *task.CreateTaskCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+func (s *store) create(ctx context.Context, cmd *task.CreateTaskCommand) (int, error) {
+	var id int
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
 		rawSQL := `
 			INSERT INTO tasks (
 				title,
@@ -34,19 +36,29 @@ func (s *store) create(ctx context.Context, cmd *task.CreateTaskCommand) error {
 				status,
 				priority,
 				difficulty,
-				user_id
+				user_id,
+				department_id,
+				due_at
 			)VALUES (
 				$1,
 				$2,
 				$3,
 				$4,
 				$5,
-				$6
+				$6,
+				COALESCE($7, (
+					SELECT department_id
+					FROM department_members
+					WHERE
+						user_id = $6 AND
+						left_at IS NULL
+					ORDER BY role = 'lead' DESC, joined_at, id
+					LIMIT 1
+				)),
+				$8
 			) RETURNING id
 		`
 
-		var id int
-
 		err := tx.QueryRow(
 			ctx,
 			rawSQL,
@@ -56,6 +68,8 @@ func (s *store) create(ctx context.Context, cmd *task.CreateTaskCommand) error {
 			cmd.Priority,
 			cmd.Difficulty,
 			cmd.UserID,
+			cmd.DepartmentID,
+			cmd.DueAt,
 		).Scan(&id)
 		if err != nil {
 			return err
@@ -63,39 +77,52 @@ func (s *store) create(ctx context.Context, cmd *task.CreateTaskCommand) error {
 
 		return nil
 	})
+
+	return id, err
 }
 
-func (s *store) update(ctx context.Context, cmd *task.UpdateTaskCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
-		rawSQL := `
-			UPDATE tasks
-			SET
-				title = $1,
-				description = $2,
-				status = $3,
-				priority = $4,
-				difficulty = $5,
-				user_id = $6
-			WHERE id = $7
-		`
+// update returns false when cmd.Version no longer matches the stored version
+func (s *store) update(ctx context.Context, cmd *task.UpdateTaskCommand) (bool, error) {
+	rawSQL := `
+		UPDATE tasks
+		SET
+			title = $1,
+			description = $2,
+			priority = $3,
+			difficulty = $4,
+			user_id = $5,
+			department_id = $8,
+			due_at = $9,
+			version = version + 1,
+			updated_at = NOW()
+		WHERE
+			id = $6 AND
+			($7 = 0 OR version = $7)
+	`
 
-		_, err := tx.Exec(
-			ctx,
-			rawSQL,
-			cmd.Title,
-			cmd.Description,
-			cmd.Status,
-			cmd.Priority,
-			cmd.Difficulty,
-			cmd.UserID,
-			cmd.ID,
-		)
-		if err != nil {
-			return err
-		}
+	result, err := s.db.Exec(
+		ctx,
+		rawSQL,
+		cmd.Title,
+		cmd.Description,
+		cmd.Priority,
+		cmd.Difficulty,
+		cmd.UserID,
+		cmd.ID,
+		cmd.Version,
+		cmd.DepartmentID,
+		cmd.DueAt,
+	)
+	if err != nil {
+		return false, err
+	}
 
-		return nil
-	})
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
 }
 
 func (s *store) delete(ctx context.Context, id int) error {
@@ -126,8 +153,12 @@ func (s *store) getTaskByID(ctx context.Context, id int) (*task.Task, error) {
 			priority,
 			difficulty,
 			user_id,
+			department_id,
+			due_at,
+			completed_at,
 			created_at,
-			updated_at
+			updated_at,
+			version
 		FROM
 			tasks
 		WHERE
@@ -158,8 +189,12 @@ func (s *store) taskTaken(ctx context.Context, id int, title string) ([]*task.Ta
 			priority,
 			difficulty,
 			user_id,
+			department_id,
+			due_at,
+			completed_at,
 			created_at,
-			updated_at
+			updated_at,
+			version
 		FROM
 			tasks
 		WHERE
@@ -195,6 +230,9 @@ func (s *store) search(ctx context.Context, query *task.SearchTaskQuery) (*task.
 			priority,
 			difficulty,
 			user_id,
+			department_id,
+			due_at,
+			completed_at,
 			created_at,
 			updated_at
 		FROM
@@ -231,6 +269,12 @@ func (s *store) search(ctx context.Context, query *task.SearchTaskQuery) (*task.
 		paramIndex++
 	}
 
+	if query.DepartmentID > 0 {
+		whereCondition = append(whereCondition, fmt.Sprintf("department_id = $%d", paramIndex))
+		whereParams = append(whereParams, query.DepartmentID)
+		paramIndex++
+	}
+
 	if len(whereCondition) > 0 {
 		sql.WriteString(" WHERE " + strings.Join(whereCondition, " AND "))
 	}
@@ -278,31 +322,144 @@ func (s *store) updateStatus(ctx context.Context, taskID, status int) error {
 				tasks
 			SET
 				status = $1,
+				completed_at = CASE WHEN $1 = $3 THEN NOW() END,
 				updated_at = now()
 			WHERE
 				id = $2
 		`
 
-		_, err := tx.Exec(ctx, rawSQL, status, taskID)
+		_, err := tx.Exec(ctx, rawSQL, status, taskID, task.TaskDone)
 		return err
 	})
 }
 
-func (s *store) isSuperuserOrDefaultUser(ctx context.Context, userID int) (bool, error) {
-	var role string
+func (s *store) departmentExists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+
+	err := s.db.Get(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM departments WHERE id = $1)", id)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// getDepartmentDashboard aggregates the tasks of the department, weeks is the
+// number of weeks of throughput ending with the current one
+// getDepartmentDashboard buckets the throughput by week in the timezone named
+// by location
+func (s *store) getDepartmentDashboard(ctx context.Context, departmentID, weeks int, location string) (*task.DepartmentDashboard, error) {
+	result := &task.DepartmentDashboard{
+		DepartmentID: departmentID,
+		ByStatus:     make(map[string]int),
+		ByPriority:   make(map[string]int),
+		ByDifficulty: make(map[string]int),
+		Overdue:      make([]*task.Task, 0),
+		Throughput:   make([]*task.Throughput, 0),
+	}
+
+	var counts []struct {
+		Status     task.TaskStatus `db:"status"`
+		Priority   string          `db:"priority"`
+		Difficulty string          `db:"difficulty"`
+		Count      int             `db:"count"`
+	}
 
 	rawSQL := `
 		SELECT
-			role
+			status,
+			priority,
+			difficulty,
+			COUNT(*) AS count
 		FROM
-			users
+			tasks
 		WHERE
-			id = $1
+			department_id = $1
+		GROUP BY
+			status,
+			priority,
+			difficulty
 	`
-	err := s.db.Get(ctx, &role, rawSQL, userID)
+
+	err := s.db.Select(ctx, &counts, rawSQL, departmentID)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	for _, c := range counts {
+		result.Total += c.Count
+		result.ByStatus[c.Status.String()] += c.Count
+		result.ByPriority[c.Priority] += c.Count
+		result.ByDifficulty[c.Difficulty] += c.Count
+	}
+
+	rawSQL = `
+		SELECT COUNT(*)
+		FROM tasks
+		WHERE
+			department_id = $1 AND
+			status <> $2 AND
+			due_at < NOW()
+	`
+
+	err = s.db.Get(ctx, &result.OverdueCount, rawSQL, departmentID, task.TaskDone)
+	if err != nil {
+		return nil, err
+	}
+
+	rawSQL = `
+		SELECT
+			id,
+			title,
+			description,
+			status,
+			priority,
+			difficulty,
+			user_id,
+			department_id,
+			due_at,
+			completed_at,
+			created_at,
+			updated_at,
+			version
+		FROM
+			tasks
+		WHERE
+			department_id = $1 AND
+			status <> $2 AND
+			due_at < NOW()
+		ORDER BY due_at, id
+		LIMIT $3
+	`
+
+	err = s.db.Select(ctx, &result.Overdue, rawSQL, departmentID, task.TaskDone, task.MaxOverdueItems)
+	if err != nil {
+		return nil, err
 	}
 
-	return role == "superuser" || role == "user", nil
+	// Weeks without completed tasks are reported with 0. The series runs on
+	// local times so every week starts at midnight in $3, DST included.
+	rawSQL = `
+		SELECT
+			w.week AT TIME ZONE $3 AS week,
+			COUNT(t.id) AS completed
+		FROM generate_series(
+			date_trunc('week', NOW() AT TIME ZONE $3) - ($2::int - 1) * INTERVAL '1 week',
+			date_trunc('week', NOW() AT TIME ZONE $3),
+			INTERVAL '1 week'
+		) AS w(week)
+		LEFT JOIN tasks t ON
+			t.department_id = $1 AND
+			t.completed_at >= w.week AT TIME ZONE $3 AND
+			t.completed_at < (w.week + INTERVAL '1 week') AT TIME ZONE $3
+		GROUP BY w.week
+		ORDER BY w.week
+	`
+
+	err = s.db.Select(ctx, &result.Throughput, rawSQL, departmentID, weeks, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
 }
@@ -2,9 +2,13 @@ package taskimpl
 
 import (
 	"context"
+	"encoding/json"
 	"task/config"
 	"task/internal/db"
+	"task/internal/identity/monitoringactivities"
 	"task/internal/identity/task"
+	"task/pkg/util/mergepatch"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -36,11 +40,17 @@ func (s *service) CreateTask(ctx context.Context, cmd *task.CreateTaskCommand) e
 			return task.ErrTaskAlreadyExists
 		}
 
-		err = s.store.create(ctx, cmd)
+		if err := s.checkDepartment(ctx, cmd.DepartmentID); err != nil {
+			return err
+		}
+
+		id, err := s.store.create(ctx, cmd)
 		if err != nil {
 			return err
 		}
 
+		monitoringactivities.Record(ctx, monitoringactivities.EventTaskCreated, monitoringactivities.TargetTask, id, nil, cmd)
+
 		return nil
 	})
 }
@@ -60,15 +70,89 @@ func (s *service) UpdateTask(ctx context.Context, cmd *task.UpdateTaskCommand) e
 			return task.ErrTaskAlreadyExists
 		}
 
-		err = s.store.update(ctx, cmd)
+		if err := s.checkDepartment(ctx, cmd.DepartmentID); err != nil {
+			return err
+		}
+
+		before, err := s.store.getTaskByID(ctx, cmd.ID)
+		if err != nil {
+			return err
+		}
+
+		updated, err := s.store.update(ctx, cmd)
 		if err != nil {
 			return err
 		}
 
+		if !updated {
+			return task.ErrVersionConflict
+		}
+
+		after, err := s.store.getTaskByID(ctx, cmd.ID)
+		if err != nil {
+			return err
+		}
+
+		monitoringactivities.Record(ctx, monitoringactivities.EventTaskUpdated, monitoringactivities.TargetTask, cmd.ID, before, after)
+
 		return nil
 	})
 }
 
+func (s *service) PatchTask(ctx context.Context, cmd *task.PatchTaskCommand) (*task.Task, error) {
+	existing, err := s.store.getTaskByID(ctx, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, task.ErrTaskNotFound
+	}
+
+	if cmd.Version != 0 && cmd.Version != existing.Version {
+		return nil, task.ErrVersionConflict
+	}
+
+	current, err := json.Marshal(&task.UpdateTaskCommand{
+		ID:           existing.ID,
+		Title:        existing.Title,
+		Description:  existing.Description,
+		Priority:     existing.Priority,
+		Difficulty:   existing.Difficulty,
+		UserID:       existing.UserID,
+		DepartmentID: existing.DepartmentID,
+		DueAt:        existing.DueAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := mergepatch.Apply(current, cmd.Patch)
+	if err != nil {
+		return nil, task.ErrInvalidPatch
+	}
+
+	var update task.UpdateTaskCommand
+	if err := json.Unmarshal(patched, &update); err != nil {
+		return nil, task.ErrInvalidPatch
+	}
+
+	// The patch cannot move the update to another task, and the version read
+	// above guards against changes made in between.
+	update.ID = existing.ID
+	update.Version = existing.Version
+
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.UpdateTask(ctx, &update); err != nil {
+		return nil, err
+	}
+
+	return s.GetTaskByID(ctx, existing.ID)
+}
+
 func (s *service) GetTaskByID(ctx context.Context, id int) (*task.Task, error) {
 	result, err := s.store.getTaskByID(ctx, id)
 	if err != nil {
@@ -98,6 +182,8 @@ func (s *service) DeleteTask(ctx context.Context, id int) error {
 			return err
 		}
 
+		monitoringactivities.Record(ctx, monitoringactivities.EventTaskDeleted, monitoringactivities.TargetTask, id, result, nil)
+
 		return nil
 	})
 }
@@ -122,17 +208,65 @@ func (s *service) SearchTask(ctx context.Context, query *task.SearchTaskQuery) (
 	return result, nil
 }
 
+// GetDepartmentDashboard summarises the tasks of a department
+func (s *service) GetDepartmentDashboard(ctx context.Context, query *task.DepartmentDashboardQuery) (*task.DepartmentDashboard, error) {
+	if query.Weeks <= 0 {
+		query.Weeks = task.DefaultThroughputWeeks
+	}
+
+	if query.Weeks > task.MaxThroughputWeeks {
+		query.Weeks = task.MaxThroughputWeeks
+	}
+
+	if query.Location == nil {
+		query.Location = time.UTC
+	}
+
+	if err := s.checkDepartment(ctx, &query.DepartmentID); err != nil {
+		return nil, err
+	}
+
+	result, err := s.store.getDepartmentDashboard(ctx, query.DepartmentID, query.Weeks, query.Location.String())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, overdue := range result.Overdue {
+		overdue.In(query.Location)
+	}
+
+	for _, throughput := range result.Throughput {
+		throughput.Week = throughput.Week.In(query.Location)
+	}
+
+	return result, nil
+}
+
+// checkDepartment returns ErrDepartmentNotFound when a department is given
+// but does not exist
+func (s *service) checkDepartment(ctx context.Context, departmentID *int) error {
+	if departmentID == nil {
+		return nil
+	}
+
+	exists, err := s.store.departmentExists(ctx, *departmentID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return task.ErrDepartmentNotFound
+	}
+
+	return nil
+}
+
 func (s *service) ApprovedTask(ctx context.Context, cmd *task.ApproveTaskCommand) error {
 	taskData, err := s.store.getTaskByID(ctx, cmd.TaskID)
 	if err != nil || taskData == nil {
 		return task.ErrTaskNotFound
 	}
 
-	isSuperuser, err := s.store.isSuperuserOrDefaultUser(ctx, taskData.UserID)
-	if err != nil || !isSuperuser {
-		return task.ErrOnlySuperuserCanApproveTheTask
-	}
-
 	if taskData.Status != task.TaskReviewing {
 		return task.TaskIsNotReadyForApproval
 	}
@@ -143,6 +277,11 @@ func (s *service) ApprovedTask(ctx context.Context, cmd *task.ApproveTaskCommand
 		return err
 	}
 
+	monitoringactivities.Record(ctx, monitoringactivities.EventTaskApproved, monitoringactivities.TargetTask, cmd.TaskID,
+		map[string]interface{}{"status": task.TaskReviewing},
+		map[string]interface{}{"status": task.TaskDone, "approved_by": cmd.UserID},
+	)
+
 	return nil
 }
 
@@ -166,5 +305,10 @@ func (s *service) SubmitTask(ctx context.Context, cmd *task.SubmitTaskCommand) e
 		return err
 	}
 
+	monitoringactivities.Record(ctx, monitoringactivities.EventTaskSubmitted, monitoringactivities.TargetTask, cmd.TaskID,
+		map[string]interface{}{"status": task.TaskPending},
+		map[string]interface{}{"status": task.TaskReviewing},
+	)
+
 	return nil
 }
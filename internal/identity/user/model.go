@@ -1,6 +1,9 @@
 package user
 
 import (
+	"fmt"
+	"net"
+	"regexp"
 	"strings"
 	"task/internal/api/errors"
 	util "task/pkg/util/password"
@@ -22,14 +25,74 @@ var (
 	ErrEmailAlreadyExists = errors.New("user.email-already-exists", "Email already exists")
 	ErrorInvalidRole      = errors.New("user.invalid-role", "Invalid role")
 	ErrInvalidStatus      = errors.New("user.invalid-status", "Invalid status")
+
+	ErrEmailNotVerified          = errors.New("user.email-not-verified", "Email address has not been verified")
+	ErrInvalidVerificationToken  = errors.New("user.invalid-verification-token", "Invalid or expired verification token")
+	ErrVerificationResendLimited = errors.New("user.verification-resend-limited", "Too many verification emails requested, try again later")
+
+	ErrAccountLocked        = errors.New("user.account-locked", "Account is temporarily locked after too many failed login attempts")
+	ErrTooManyLoginAttempts = errors.New("user.too-many-login-attempts", "Too many failed login attempts from this address")
+	ErrLoginThrottled       = errors.New("user.login-throttled", "Please wait before trying to log in again")
+
+	ErrMFAAlreadyEnabled = errors.New("user.mfa-already-enabled", "Two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("user.mfa-not-enrolled", "Two-factor authentication has not been set up")
+	ErrMFARequired       = errors.New("user.mfa-required", "Two-factor authentication is required for this role")
+	ErrInvalidMFACode    = errors.New("user.invalid-mfa-code", "Invalid two-factor authentication code")
+	ErrInvalidMFAToken   = errors.New("user.invalid-mfa-token", "Invalid or expired two-factor authentication token")
+
+	ErrCannotImpersonateSelf      = errors.New("user.cannot-impersonate-self", "You cannot impersonate yourself")
+	ErrCannotImpersonateSuperuser = errors.New("user.cannot-impersonate-superuser", "Superusers cannot be impersonated")
+	ErrCannotImpersonateInactive  = errors.New("user.cannot-impersonate-inactive", "Only active users can be impersonated")
+	ErrInvalidPatch               = errors.New("user.invalid-patch", "Invalid JSON merge patch")
+	ErrFieldNotPatchable          = errors.New("user.field-not-patchable", "Role and status cannot be changed by a patch")
+	ErrInvalidJobTitle            = errors.New("user.invalid-job-title", "Job title must be at most 255 characters")
+	ErrInvalidTimezone            = errors.New("user.invalid-timezone", "Invalid IANA timezone")
+	ErrInvalidLocale              = errors.New("user.invalid-locale", "Invalid locale, expected a tag such as en-US")
+	ErrInvalidAvatar              = errors.New("user.invalid-avatar", "Avatar must be a JPEG, PNG or GIF image")
+	ErrAvatarTooLarge             = errors.New("user.avatar-too-large", "Avatar must be smaller than 4 MB")
+	ErrNoAvatar                   = errors.New("user.no-avatar", "User has no avatar")
+	ErrVersionConflict            = errors.New("user.version-conflict", "User was modified by someone else, reload it and try again")
+	ErrNoDepartment               = errors.New("user.no-department", "You are not assigned to a department")
+	ErrInvalidImpersonationReason = errors.New("user.invalid-impersonation-reason", "Reason must be at most 255 characters")
+	ErrInvalidImportFile          = errors.New("user.invalid-import-file", "Import file must be a CSV or XLSX spreadsheet with a header row")
+	ErrImportTooLarge             = errors.New("user.import-too-large", "Import file must be smaller than 5 MB and contain at most 1000 users")
+	ErrImportMissingColumn        = errors.New("user.import-missing-column", "Import file is missing a required column")
+	ErrImportDuplicateEmail       = errors.New("user.import-duplicate-email", "Email appears more than once in the import file")
+	ErrImportRejected             = errors.New("user.import-rejected", "Import has invalid rows, no users were created")
+	ErrAccountInactive            = errors.New("user.account-inactive", "Account has been deactivated")
+	ErrCannotDeactivateSelf       = errors.New("user.cannot-deactivate-self", "You cannot deactivate your own account")
+	ErrCannotDeactivateSuperuser  = errors.New("user.cannot-deactivate-superuser", "Only superusers can deactivate superusers")
+	ErrUserAlreadyInactive        = errors.New("user.already-inactive", "User is already inactive")
+	ErrUserNotInactive            = errors.New("user.not-inactive", "Only inactive users can be reactivated")
+	ErrReassignmentRequired       = errors.New("user.reassignment-required", "User has open tasks, choose who takes them over with reassign_to")
+	ErrManagerNotFound            = errors.New("user.manager-not-found", "Manager must be an existing active user")
+	ErrManagerCycle               = errors.New("user.manager-cycle", "A user cannot report to themselves or to one of their reports")
+	ErrInvalidReassignee          = errors.New("user.invalid-reassignee", "Tasks can only be reassigned to another active user")
+	ErrInvalidIPAddress           = errors.New("user.invalid-ip-address", "Invalid IP address")
 )
 
+// LoginThrottledError is returned when a login attempt is refused before the
+// password is checked.
+type LoginThrottledError struct {
+	Reason     errors.ErrorStatus
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return e.Reason.Error()
+}
+
+func (e *LoginThrottledError) Unwrap() error {
+	return e.Reason
+}
+
 type Status int
 
 const (
 	Active Status = iota + 1
 	Inactive
 	Deleted
+	Pending // Invited, waiting for the invitee to set a password
 )
 
 const (
@@ -37,6 +100,7 @@ const (
 	RoleSuperUser = "superuser"
 	RoleHR        = "hr"
 	RoleManager   = "manager"
+	RoleAdmin     = "admin"
 )
 
 var validRoles = map[string]bool{
@@ -44,6 +108,7 @@ var validRoles = map[string]bool{
 	RoleSuperUser: true,
 	RoleHR:        true,
 	RoleManager:   true,
+	RoleAdmin:     true,
 }
 
 // IsValidRole checks if a role is valid.
@@ -51,6 +116,36 @@ func IsValidRole(role string) bool {
 	return validRoles[role]
 }
 
+// Date scans a nullable DATE column, NULL becomes an empty string
+type Date string
+
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = ""
+	case time.Time:
+		*d = Date(v.Format(time.RFC3339Nano))
+	case []byte:
+		*d = Date(v)
+	case string:
+		*d = Date(v)
+	default:
+		return fmt.Errorf("user: cannot scan %T into Date", src)
+	}
+	return nil
+}
+
+// DateOnly formats the date as YYYY-MM-DD, the format accepted by commands
+func (d Date) DateOnly() string {
+	if len(d) > len(time.DateOnly) {
+		return string(d[:len(time.DateOnly)])
+	}
+	return string(d)
+}
+
+// localePattern accepts BCP 47 tags made of a language and an optional region
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
 type User struct {
 	ID           int       `db:"id" json:"id"`
 	UUID         string    `db:"uuid" json:"uuid"` // UUID for global uniqueness
@@ -60,11 +155,157 @@ type User struct {
 	PasswordHash string    `db:"password_hash" json:"-"` // Exclude from JSON output
 	Address      string    `db:"address" json:"address"`
 	PhoneNumber  string    `db:"phone_number" json:"phone_number"`
-	DateOfBirth  string    `db:"date_of_birth" json:"date_of_birth"`
+	DateOfBirth  Date      `db:"date_of_birth" json:"date_of_birth"`
 	Role         string    `db:"role" json:"role"`
 	Status       Status    `db:"status" json:"status"`
 	CreatedAt    time.Time `db:"created_at" json:"created_at"` // Timestamp for creation
 	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"` // Timestamp for updates
+	Version      int       `db:"version" json:"version"`       // Incremented on every update, used as ETag
+
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"email_verified_at"` // Nil until the email is verified
+	MFASecret       *string    `db:"mfa_secret" json:"-"`                        // Pending or active TOTP secret
+	MFAEnabled      bool       `db:"mfa_enabled" json:"mfa_enabled"`
+
+	JobTitle        string     `db:"job_title" json:"job_title"`
+	Timezone        string     `db:"timezone" json:"timezone"` // IANA name used to render dates for the user
+	Locale          string     `db:"locale" json:"locale"`
+	AvatarKey       *string    `db:"avatar_key" json:"-"`
+	AvatarUpdatedAt *time.Time `db:"avatar_updated_at" json:"-"`
+	AvatarURL       string     `db:"-" json:"avatar_url,omitempty"`
+
+	DeactivatedAt *time.Time `db:"deactivated_at" json:"deactivated_at,omitempty"`
+	ManagerID     *int       `db:"manager_id" json:"manager_id"` // User this user reports to
+}
+
+// LoadLocation resolves an IANA timezone name and falls back to UTC
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// MaxAvatarUploadSize bounds the size of uploaded pictures before resizing
+const MaxAvatarUploadSize = 4 << 20
+
+// Avatar is a stored avatar image
+type Avatar struct {
+	Data        []byte
+	ContentType string
+	UpdatedAt   time.Time
+}
+
+// UploadAvatarCommand replaces the avatar of the logged in user
+type UploadAvatarCommand struct {
+	Email string
+	Data  []byte
+}
+
+const (
+	MaxImportUploadSize = 5 << 20 // Bounds CSV and XLSX uploads
+	MaxImportRows       = 1000    // Bounds the users created in one transaction
+)
+
+// ImportColumns are the header names of an import file, all required. Users
+// are invited, so they pick their password and are pending until they accept.
+var ImportColumns = []string{
+	"first_name",
+	"last_name",
+	"email",
+	"address",
+	"phone_number",
+	"date_of_birth",
+	"role",
+}
+
+// ExportColumns are the header names of an export file
+var ExportColumns = []string{
+	"id",
+	"uuid",
+	"first_name",
+	"last_name",
+	"email",
+	"address",
+	"phone_number",
+	"date_of_birth",
+	"role",
+	"status",
+}
+
+// ImportUsersCommand invites users from a CSV or XLSX upload
+type ImportUsersCommand struct {
+	Filename  string
+	Data      []byte
+	DryRun    bool
+	InvitedBy string
+}
+
+// ImportRowError reports why a row of an import file was rejected. Row is
+// the line number in the file, the header being row 1.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Email   string `json:"email,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ImportUsersResult struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`   // Rows read from the file
+	Created int               `json:"created"` // Users invited, 0 on dry runs and rejections
+	Errors  []*ImportRowError `json:"errors"`
+	Unsent  []string          `json:"unsent"` // Invited but not emailed, to be resent
+}
+
+// DeactivateUserCommand disables an account. Open tasks of the user must be
+// handed over to ReassignTo when there are any.
+type DeactivateUserCommand struct {
+	ID         int    `json:"-"`
+	ActorEmail string `json:"-"`
+	ReassignTo *int   `json:"reassign_to"`
+}
+
+// UnlockUserCommand clears the lockout of an account. Addresses are shared by
+// every account tried from them, so one is only cleared when IPAddress names it.
+type UnlockUserCommand struct {
+	ID        int    `json:"-"`
+	IPAddress string `json:"ip_address"`
+}
+
+type DeactivationResult struct {
+	User            *User `json:"user"`
+	ReassignedTasks int   `json:"reassigned_tasks"`
+	RevokedTokens   int   `json:"revoked_tokens"`
+}
+
+// SetManagerCommand sets who a user reports to, a nil ManagerID removes the
+// manager
+type SetManagerCommand struct {
+	UserID    int  `json:"-"`
+	ManagerID *int `json:"manager_id"`
+}
+
+// ReportsQuery lists the users reporting to UserID, with Indirect the reports
+// of their reports are included too
+type ReportsQuery struct {
+	UserID   int  `query:"-"`
+	Indirect bool `query:"indirect"`
+}
+
+// Report is a user in the reporting line of a manager, Depth is 1 for direct
+// reports
+type Report struct {
+	ID        int    `db:"id" json:"id"`
+	FirstName string `db:"first_name" json:"first_name"`
+	LastName  string `db:"last_name" json:"last_name"`
+	Email     string `db:"email" json:"email"`
+	JobTitle  string `db:"job_title" json:"job_title"`
+	ManagerID int    `db:"manager_id" json:"manager_id"`
+	Depth     int    `db:"depth" json:"depth"`
 }
 
 type UserDepartmentDTO struct {
@@ -76,28 +317,21 @@ type UserDepartmentDTO struct {
 	PasswordHash string    `db:"password_hash" json:"-"`
 	Address      string    `db:"address" json:"address"`
 	PhoneNumber  string    `db:"phone_number" json:"phone_number"`
-	DateOfBirth  string    `db:"date_of_birth" json:"date_of_birth"`
+	DateOfBirth  Date      `db:"date_of_birth" json:"date_of_birth"`
 	Role         string    `db:"role" json:"role"`
 	Status       Status    `db:"status" json:"status"`
 	CreatedAt    time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
 
-	DepartmentID   *int    `db:"department_id" json:"department_id"`
-	DepartmentName *string `db:"department_name" json:"department_name"`
-}
-
-type CreateUserCommand struct {
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	Email       string `json:"email"`
-	Password    string `json:"password"`
-	Address     string `json:"address"`
-	PhoneNumber string `json:"phone_number"`
-	DateOfBirth string `json:"date_of_birth"`
-	Role        string `json:"role"`
-	Status      Status `json:"status"`
+	DepartmentID   *int       `db:"department_id" json:"department_id"`
+	DepartmentName *string    `db:"department_name" json:"department_name"`
+	MembershipRole *string    `db:"membership_role" json:"membership_role"` // member or lead
+	JoinedAt       *time.Time `db:"joined_at" json:"joined_at"`
 }
 
+// UpdateUserCommand changes the profile of a user. The role is set through
+// PUT /users/:id/roles and the status through deactivate and reactivate, so
+// both are left out here.
 type UpdateUserCommand struct {
 	ID          int    `json:"id"`
 	FirstName   string `json:"first_name"`
@@ -106,8 +340,38 @@ type UpdateUserCommand struct {
 	Address     string `json:"address"`
 	PhoneNumber string `json:"phone_number"`
 	DateOfBirth string `json:"date_of_birth"`
-	Role        string `json:"role"`
-	Status      Status `json:"status"`
+	Version     int    `json:"-"` // Expected version from If-Match, 0 skips the check
+}
+
+// PatchUserCommand applies a JSON Merge Patch to the fields of UpdateUserCommand
+type PatchUserCommand struct {
+	ID      int
+	Patch   []byte
+	Version int // Expected version from If-Match, 0 skips the check
+}
+
+// UpdateProfileCommand changes the safe fields of the logged in user, fields
+// left out of the request are kept. Role, status and email are managed
+// elsewhere.
+type UpdateProfileCommand struct {
+	Email       string  `json:"-"`
+	FirstName   *string `json:"first_name"`
+	LastName    *string `json:"last_name"`
+	Address     *string `json:"address"`
+	PhoneNumber *string `json:"phone_number"`
+	DateOfBirth *string `json:"date_of_birth"`
+	JobTitle    *string `json:"job_title"`
+	Timezone    *string `json:"timezone"`
+	Locale      *string `json:"locale"`
+}
+
+// UserDepartment is the department the logged in user belongs to
+type UserDepartment struct {
+	ID        int       `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Location  *string   `db:"location" json:"location"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
 
 type SearchUserQuery struct {
@@ -131,14 +395,82 @@ type SearchUserResult struct {
 }
 
 type LoginUserCommand struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	IPAddress string `json:"-"` // Set by the handler from the request
+}
+
+// LoginResult carries either a session token or the token for the next
+// two-factor step.
+type LoginResult struct {
+	Token                 string `json:"token,omitempty"`
+	MFARequired           bool   `json:"mfa_required,omitempty"`
+	ChallengeToken        string `json:"challenge_token,omitempty"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	EnrollmentToken       string `json:"enrollment_token,omitempty"`
+}
+
+// VerifyMFACommand completes a login with a TOTP or recovery code
+type VerifyMFACommand struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	IPAddress      string `json:"-"`
+}
+
+// EnrollMFACommand starts TOTP enrollment either for the logged in user or,
+// during a forced enrollment at login, for the holder of the enrollment token.
+type EnrollMFACommand struct {
+	Email           string `json:"-"`
+	EnrollmentToken string `json:"enrollment_token"`
+}
+
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type ConfirmMFACommand struct {
+	Email           string `json:"-"`
+	EnrollmentToken string `json:"enrollment_token"`
+	Code            string `json:"code"`
+}
+
+// MFAConfirmation holds the recovery codes shown once after enrollment and,
+// for forced enrollments, the session token that completes the login.
+type MFAConfirmation struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	Token         string   `json:"token,omitempty"`
+}
+
+// MFACodeCommand proves possession of the authenticator for sensitive changes
+type MFACodeCommand struct {
+	Email string `json:"-"`
+	Code  string `json:"code"`
+}
+
+// ImpersonateCommand lets the superuser ActorEmail act as UserID
+type ImpersonateCommand struct {
+	UserID     int    `json:"-"`
+	ActorEmail string `json:"-"`
+	Reason     string `json:"reason"`
+}
+
+type ImpersonationResult struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
 }
 
 type LogutUserCommand struct {
 	Token string `json:"token"`
 }
 
+type ResendVerificationCommand struct {
+	Email string `json:"email"`
+}
+
 type RegisterUserCommand struct {
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
@@ -150,34 +482,38 @@ type RegisterUserCommand struct {
 	Status      Status `json:"status"`
 }
 
-// Validation for CreateUserCommand
-func (cmd *CreateUserCommand) Validate() error {
-	if len(cmd.FirstName) == 0 || len(cmd.FirstName) <= 2 {
-		return ErrInvalidFirstName
+// Validation for DeactivateUserCommand
+func (cmd *DeactivateUserCommand) Validate() error {
+	if cmd.ID <= 0 {
+		return ErrInvalidID
 	}
-	if len(cmd.LastName) == 0 || len(cmd.LastName) <= 2 {
-		return ErrInvalidLastName
+	if cmd.ReassignTo != nil && (*cmd.ReassignTo <= 0 || *cmd.ReassignTo == cmd.ID) {
+		return ErrInvalidReassignee
 	}
-	if len(cmd.Email) == 0 || !validation.IsValidEmail(cmd.Email) {
-		return ErrInvalidEmail
-	}
-	if len(cmd.Password) == 0 || !util.IsValidPassword(cmd.Password) {
-		return ErrInvalidPassword
+	return nil
+}
+
+// Validation for UnlockUserCommand
+func (cmd *UnlockUserCommand) Validate() error {
+	if cmd.ID <= 0 {
+		return ErrInvalidID
 	}
-	if len(cmd.Address) == 0 {
-		return ErrInvalidAddress
+	if cmd.IPAddress != "" && net.ParseIP(cmd.IPAddress) == nil {
+		return ErrInvalidIPAddress
 	}
-	if len(cmd.PhoneNumber) == 0 {
-		return ErrInvalidPhoneNumber
-	}
-	if len(cmd.DateOfBirth) == 0 {
-		return ErrInvalidDateOfBirth
+	return nil
+}
+
+// Validation for SetManagerCommand
+func (cmd *SetManagerCommand) Validate() error {
+	if cmd.UserID <= 0 {
+		return ErrInvalidID
 	}
-	if !IsValidRole(cmd.Role) {
-		return ErrorInvalidRole
+	if cmd.ManagerID != nil && *cmd.ManagerID <= 0 {
+		return ErrManagerNotFound
 	}
-	if cmd.Status != Active && cmd.Status != Inactive && cmd.Status != Deleted {
-		return ErrInvalidStatus
+	if cmd.ManagerID != nil && *cmd.ManagerID == cmd.UserID {
+		return ErrManagerCycle
 	}
 	return nil
 }
@@ -199,11 +535,45 @@ func (cmd *UpdateUserCommand) Validate() error {
 	if len(cmd.PhoneNumber) == 0 || !validation.IsValidPhoneNumber(cmd.PhoneNumber) {
 		return ErrInvalidPhoneNumber
 	}
-	if len(cmd.Email) > 0 && !validation.IsValidEmail(cmd.Email) {
+	if len(cmd.Email) == 0 || !validation.IsValidEmail(cmd.Email) {
 		return ErrInvalidEmail
 	}
-	if !IsValidRole(cmd.Role) {
-		return ErrorInvalidRole
+	return nil
+}
+
+// Validation for UpdateProfileCommand
+func (cmd *UpdateProfileCommand) Validate() error {
+	if cmd.FirstName != nil && (len(strings.TrimSpace(*cmd.FirstName)) == 0 || len(*cmd.FirstName) <= 2) {
+		return ErrInvalidFirstName
+	}
+	if cmd.LastName != nil && (len(strings.TrimSpace(*cmd.LastName)) == 0 || len(*cmd.LastName) <= 2) {
+		return ErrInvalidLastName
+	}
+	if cmd.Address != nil && len(strings.TrimSpace(*cmd.Address)) == 0 {
+		return ErrInvalidAddress
+	}
+	if cmd.PhoneNumber != nil && !validation.IsValidPhoneNumber(*cmd.PhoneNumber) {
+		return ErrInvalidPhoneNumber
+	}
+	if cmd.DateOfBirth != nil {
+		if _, err := time.Parse(time.DateOnly, *cmd.DateOfBirth); err != nil {
+			return ErrInvalidDateOfBirth
+		}
+	}
+	if cmd.JobTitle != nil && len(*cmd.JobTitle) > 255 {
+		return ErrInvalidJobTitle
+	}
+	if cmd.Timezone != nil {
+		// time.LoadLocation also accepts "" and "Local", neither names a zone
+		if *cmd.Timezone == "" || *cmd.Timezone == "Local" {
+			return ErrInvalidTimezone
+		}
+		if _, err := time.LoadLocation(*cmd.Timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+	}
+	if cmd.Locale != nil && !localePattern.MatchString(*cmd.Locale) {
+		return ErrInvalidLocale
 	}
 	return nil
 }
@@ -244,3 +614,51 @@ func (cmd *RegisterUserCommand) Validate() error {
 	}
 	return nil
 }
+
+// Validation for ResendVerificationCommand
+func (cmd *ResendVerificationCommand) Validate() error {
+	if len(cmd.Email) == 0 || !validation.IsValidEmail(cmd.Email) {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// Validation for VerifyMFACommand
+func (cmd *VerifyMFACommand) Validate() error {
+	if len(cmd.ChallengeToken) == 0 {
+		return ErrInvalidMFAToken
+	}
+	if len(cmd.Code) == 0 && len(cmd.RecoveryCode) == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Validation for ConfirmMFACommand
+func (cmd *ConfirmMFACommand) Validate() error {
+	if len(strings.TrimSpace(cmd.Code)) == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Validation for MFACodeCommand
+func (cmd *MFACodeCommand) Validate() error {
+	if len(strings.TrimSpace(cmd.Code)) == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// Validation for ImpersonateCommand
+func (cmd *ImpersonateCommand) Validate() error {
+	if cmd.UserID <= 0 {
+		return ErrInvalidID
+	}
+
+	if len(cmd.Reason) > 255 {
+		return ErrInvalidImpersonationReason
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package user
+
+import "testing"
+
+func TestUpdateUserCommandValidate(t *testing.T) {
+	valid := func() *UpdateUserCommand {
+		return &UpdateUserCommand{
+			ID:          1,
+			FirstName:   "Jane",
+			LastName:    "Doe",
+			Email:       "jane@example.com",
+			Address:     "1 Main St",
+			PhoneNumber: "0123456789",
+			DateOfBirth: "1990-01-01",
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(cmd *UpdateUserCommand)
+		want   error
+	}{
+		{"valid", func(cmd *UpdateUserCommand) {}, nil},
+		{"missing email", func(cmd *UpdateUserCommand) { cmd.Email = "" }, ErrInvalidEmail},
+		{"invalid email", func(cmd *UpdateUserCommand) { cmd.Email = "jane" }, ErrInvalidEmail},
+		{"email without domain", func(cmd *UpdateUserCommand) { cmd.Email = "jane@" }, ErrInvalidEmail},
+		{"missing id", func(cmd *UpdateUserCommand) { cmd.ID = 0 }, ErrUserNotFound},
+		{"short first name", func(cmd *UpdateUserCommand) { cmd.FirstName = "Jo" }, ErrInvalidFirstName},
+		{"blank last name", func(cmd *UpdateUserCommand) { cmd.LastName = "   " }, ErrInvalidLastName},
+		{"missing address", func(cmd *UpdateUserCommand) { cmd.Address = "" }, ErrInvalidAddress},
+		{"invalid phone number", func(cmd *UpdateUserCommand) { cmd.PhoneNumber = "12ab" }, ErrInvalidPhoneNumber},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := valid()
+			tt.change(cmd)
+
+			if err := cmd.Validate(); err != tt.want {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnlockUserCommandValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  UnlockUserCommand
+		want error
+	}{
+		{"account only", UnlockUserCommand{ID: 1}, nil},
+		{"with an IPv4 address", UnlockUserCommand{ID: 1, IPAddress: "203.0.113.7"}, nil},
+		{"with an IPv6 address", UnlockUserCommand{ID: 1, IPAddress: "2001:db8::1"}, nil},
+		{"invalid address", UnlockUserCommand{ID: 1, IPAddress: "203.0.113"}, ErrInvalidIPAddress},
+		{"key pattern", UnlockUserCommand{ID: 1, IPAddress: "*"}, ErrInvalidIPAddress},
+		{"missing id", UnlockUserCommand{IPAddress: "203.0.113.7"}, ErrInvalidID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cmd.Validate(); err != tt.want {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
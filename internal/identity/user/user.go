@@ -4,12 +4,56 @@ import "context"
 
 type Service interface {
 	RegisterUser(ctx context.Context, cmd *RegisterUserCommand) error
-	CreateUser(ctx context.Context, cmd *CreateUserCommand) error
 	GetUserByID(ctx context.Context, id int) (*User, error)
 	UpdateUser(ctx context.Context, cmd *UpdateUserCommand) error
+	PatchUser(ctx context.Context, cmd *PatchUserCommand) (*User, error)
 	SearchUser(ctx context.Context, query *SearchUserQuery) (*SearchUserResult, error)
 	DeleteUser(ctx context.Context, id int) error
-	GetUserByEmail(ctx context.Context, cmd *LoginUserCommand) (string, error)
+
+	// Bulk onboarding from CSV or XLSX files and CSV export of search results
+	ImportUsers(ctx context.Context, cmd *ImportUsersCommand) (*ImportUsersResult, error)
+	ExportUsers(ctx context.Context, query *SearchUserQuery, fn func(*User) error) error
+	GetUserByEmail(ctx context.Context, cmd *LoginUserCommand) (*LoginResult, error)
+
+	// CompleteLogin finishes a login authenticated elsewhere, such as SSO,
+	// through the same two-factor steps as a password login
+	CompleteLogin(ctx context.Context, id int) (*LoginResult, error)
+
+	// Profile of the logged in user
+	GetProfile(ctx context.Context, email string) (*User, error)
+	UpdateProfile(ctx context.Context, cmd *UpdateProfileCommand) (*User, error)
+	GetProfileDepartment(ctx context.Context, email string) (*UserDepartment, error)
+
+	// Avatars are resized on upload and kept in the configured storage
+	UploadAvatar(ctx context.Context, cmd *UploadAvatarCommand) (*User, error)
+	DeleteAvatar(ctx context.Context, email string) error
+	GetAvatar(ctx context.Context, id int) (*Avatar, error)
+
+	// Email verification for self-registered accounts
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, cmd *ResendVerificationCommand) error
+
+	// Two-factor authentication
+	VerifyMFA(ctx context.Context, cmd *VerifyMFACommand) (string, error)
+	EnrollMFA(ctx context.Context, cmd *EnrollMFACommand) (*MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, cmd *ConfirmMFACommand) (*MFAConfirmation, error)
+	DisableMFA(ctx context.Context, cmd *MFACodeCommand) error
+	RegenerateRecoveryCodes(ctx context.Context, cmd *MFACodeCommand) ([]string, error)
+
+	// Account lifecycle, inactive users cannot log in
+	DeactivateUser(ctx context.Context, cmd *DeactivateUserCommand) (*DeactivationResult, error)
+	ReactivateUser(ctx context.Context, id int, actorEmail string) (*User, error)
+
+	// Reporting lines
+	SetManager(ctx context.Context, cmd *SetManagerCommand) (*User, error)
+	GetReports(ctx context.Context, query *ReportsQuery) ([]*Report, error)
+
+	// Clears failed login attempts and lockouts for an account, and for an
+	// address when one is given
+	UnlockUser(ctx context.Context, cmd *UnlockUserCommand) error
+
+	// Issues a short-lived token for a superuser to act as another user
+	Impersonate(ctx context.Context, cmd *ImpersonateCommand) (*ImpersonationResult, error)
 
 	// For logout
 	InvalidateToken(ctx context.Context, token string) error
@@ -0,0 +1,109 @@
+package userimpl
+
+import (
+	"context"
+	"fmt"
+	"task/internal/identity/user"
+	"task/pkg/util/avatar"
+	"time"
+)
+
+func avatarKey(id int) string {
+	return fmt.Sprintf("avatars/%d.jpg", id)
+}
+
+// avatarURL points to GET /api/users/:id/avatar, the version busts caches
+// when the avatar changes.
+func avatarURL(u *user.User) string {
+	if u.AvatarKey == nil || u.AvatarUpdatedAt == nil {
+		return ""
+	}
+	return fmt.Sprintf("/api/users/%d/avatar?v=%d", u.ID, u.AvatarUpdatedAt.Unix())
+}
+
+func (s *service) UploadAvatar(ctx context.Context, cmd *user.UploadAvatarCommand) (*user.User, error) {
+	if len(cmd.Data) > user.MaxAvatarUploadSize {
+		return nil, user.ErrAvatarTooLarge
+	}
+
+	existing, err := s.store.getUserByEmail(ctx, cmd.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	resized, err := avatar.Resize(cmd.Data)
+	if err != nil {
+		return nil, user.ErrInvalidAvatar
+	}
+
+	key := avatarKey(existing.ID)
+
+	err = s.cfg.Storage.Put(ctx, key, resized)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.setAvatar(ctx, existing.ID, &key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetProfile(ctx, cmd.Email)
+}
+
+func (s *service) DeleteAvatar(ctx context.Context, email string) error {
+	existing, err := s.store.getUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		return user.ErrUserNotFound
+	}
+
+	if existing.AvatarKey == nil {
+		return user.ErrNoAvatar
+	}
+
+	err = s.store.setAvatar(ctx, existing.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	return s.cfg.Storage.Delete(ctx, *existing.AvatarKey)
+}
+
+func (s *service) GetAvatar(ctx context.Context, id int) (*user.Avatar, error) {
+	existing, err := s.store.getUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	if existing.AvatarKey == nil {
+		return nil, user.ErrNoAvatar
+	}
+
+	data, err := s.cfg.Storage.Get(ctx, *existing.AvatarKey)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedAt := time.Now()
+	if existing.AvatarUpdatedAt != nil {
+		updatedAt = *existing.AvatarUpdatedAt
+	}
+
+	return &user.Avatar{
+		Data:        data,
+		ContentType: avatar.ContentType,
+		UpdatedAt:   updatedAt,
+	}, nil
+}
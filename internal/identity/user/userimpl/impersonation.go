@@ -0,0 +1,72 @@
+package userimpl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"task/internal/identity/monitoringactivities"
+	"task/internal/identity/user"
+	"task/pkg/util/jwt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func (s *service) Impersonate(ctx context.Context, cmd *user.ImpersonateCommand) (*user.ImpersonationResult, error) {
+	target, err := s.store.getUserByID(ctx, cmd.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if target == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	if target.Email == cmd.ActorEmail {
+		return nil, user.ErrCannotImpersonateSelf
+	}
+
+	if target.Status != user.Active {
+		return nil, user.ErrCannotImpersonateInactive
+	}
+
+	// Acting as another superuser would hand out their privileges
+	superuser, err := s.store.hasRole(ctx, target.ID, user.RoleSuperUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if superuser {
+		return nil, user.ErrCannotImpersonateSuperuser
+	}
+
+	token, expiresAt, err := jwt.GenerateImpersonationToken(target.Email, target.Role, cmd.ActorEmail, s.cfg.Impersonation.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.activities.LogActivity(ctx, &monitoringactivities.CreateActivityLogCommand{
+		UserID:     target.Email,
+		ActorID:    cmd.ActorEmail,
+		Activity:   "IMPERSONATION",
+		Action:     "impersonation.started",
+		Event:      monitoringactivities.EventImpersonationStarted,
+		TargetType: monitoringactivities.TargetUser,
+		TargetID:   strconv.Itoa(target.ID),
+		Resource:   fmt.Sprintf("/api/admin/impersonate/%d", target.ID),
+		Details:    cmd.Reason,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		// Impersonation must never happen without a trace
+		s.log.Error("Failed to audit impersonation", zap.String("actor", cmd.ActorEmail), zap.Int("user_id", target.ID), zap.Error(err))
+		return nil, err
+	}
+
+	return &user.ImpersonationResult{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		UserID:    target.ID,
+		Email:     target.Email,
+	}, nil
+}
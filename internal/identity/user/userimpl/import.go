@@ -0,0 +1,205 @@
+package userimpl
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"task/internal/identity/invitation"
+	"task/internal/identity/user"
+	"task/pkg/util/spreadsheet"
+
+	apierrors "task/internal/api/errors"
+)
+
+// ImportUsers validates every row of the file and invites the users in one
+// transaction. Nothing is written on a dry run or when any row is invalid.
+// Users are not created directly, there is no password to create them with:
+// they are pending until they accept the invitation and set one. Rows are
+// therefore validated as invitations, see validateImportRow.
+func (s *service) ImportUsers(ctx context.Context, cmd *user.ImportUsersCommand) (*user.ImportUsersResult, error) {
+	rows, err := spreadsheet.Read(cmd.Filename, cmd.Data)
+	if err != nil {
+		return nil, user.ErrInvalidImportFile
+	}
+
+	columns, err := importColumns(rows[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		result = &user.ImportUsersResult{
+			DryRun: cmd.DryRun,
+			Errors: make([]*user.ImportRowError, 0),
+		}
+		cmds   = make([]*invitation.InviteUserCommand, 0, len(rows)-1)
+		lines  = make([]int, 0, len(rows)-1)
+		seen   = make(map[string]int)
+		emails = make([]string, 0, len(rows)-1)
+	)
+
+	for i, row := range rows[1:] {
+		line := i + 2
+
+		if spreadsheet.IsBlank(row) {
+			continue
+		}
+
+		result.Total++
+
+		if result.Total > user.MaxImportRows {
+			return nil, user.ErrImportTooLarge
+		}
+
+		create := importRow(row, columns)
+		create.InvitedBy = cmd.InvitedBy
+
+		err := validateImportRow(create)
+
+		if err != nil {
+			result.Errors = append(result.Errors, importRowError(line, create, err))
+			continue
+		}
+
+		email := strings.ToLower(create.Email)
+		if _, ok := seen[email]; ok {
+			result.Errors = append(result.Errors, importRowError(line, create, user.ErrImportDuplicateEmail))
+			continue
+		}
+
+		seen[email] = line
+		emails = append(emails, email)
+		cmds = append(cmds, create)
+		lines = append(lines, line)
+	}
+
+	if len(emails) > 0 {
+		taken, err := s.store.existingEmails(ctx, emails)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, create := range cmds {
+			if taken[strings.ToLower(create.Email)] {
+				result.Errors = append(result.Errors, importRowError(lines[i], create, user.ErrUserAlreadyExists))
+			}
+		}
+	}
+
+	slices.SortStableFunc(result.Errors, func(a, b *user.ImportRowError) int {
+		return a.Row - b.Row
+	})
+
+	if cmd.DryRun {
+		return result, nil
+	}
+
+	if len(result.Errors) > 0 {
+		return result, user.ErrImportRejected
+	}
+
+	if len(cmds) == 0 {
+		return nil, user.ErrInvalidImportFile
+	}
+
+	invitations, err := s.invitations.InviteUsers(ctx, cmds)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Created = len(invitations)
+	result.Unsent = make([]string, 0)
+
+	for _, invited := range invitations {
+		if invited.Warning != "" {
+			result.Unsent = append(result.Unsent, invited.Email)
+		}
+	}
+
+	return result, nil
+}
+
+// ExportUsers calls fn for each user matching the same filters as SearchUser.
+// Unlike SearchUser it returns every match unless a page size is given.
+func (s *service) ExportUsers(ctx context.Context, query *user.SearchUserQuery, fn func(*user.User) error) error {
+	if query.PerPage > 0 && query.Page <= 0 {
+		query.Page = 1
+	}
+
+	return s.store.exportUsers(ctx, query, fn)
+}
+
+// importColumns maps each known column name to its position in the header
+func importColumns(header []string) (map[string]int, error) {
+	columns := make(map[string]int, len(header))
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if slices.Contains(user.ImportColumns, name) {
+			columns[name] = i
+		}
+	}
+
+	for _, name := range user.ImportColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, apierrors.New(user.ErrImportMissingColumn.Code, user.ErrImportMissingColumn.Message+": "+name)
+		}
+	}
+
+	return columns, nil
+}
+
+func importRow(row []string, columns map[string]int) *invitation.InviteUserCommand {
+	cell := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+
+	return &invitation.InviteUserCommand{
+		FirstName:   cell("first_name"),
+		LastName:    cell("last_name"),
+		Email:       cell("email"),
+		Address:     cell("address"),
+		PhoneNumber: cell("phone_number"),
+		DateOfBirth: cell("date_of_birth"),
+		Role:        cell("role"),
+	}
+}
+
+// validateImportRow checks a row as an invitation and also requires the
+// contact details an invitation leaves optional, so imported profiles are
+// complete like the ones users fill in themselves
+func validateImportRow(cmd *invitation.InviteUserCommand) error {
+	if err := cmd.Validate(); err != nil {
+		return err
+	}
+	if len(cmd.Address) == 0 {
+		return user.ErrInvalidAddress
+	}
+	if len(cmd.PhoneNumber) == 0 {
+		return user.ErrInvalidPhoneNumber
+	}
+	if len(cmd.DateOfBirth) == 0 {
+		return user.ErrInvalidDateOfBirth
+	}
+	return nil
+}
+
+func importRowError(line int, cmd *invitation.InviteUserCommand, err error) *user.ImportRowError {
+	rowError := &user.ImportRowError{
+		Row:     line,
+		Email:   cmd.Email,
+		Message: err.Error(),
+	}
+
+	var status apierrors.ErrorStatus
+	if errors.As(err, &status) {
+		rowError.Code = status.Code
+	}
+
+	return rowError
+}
@@ -0,0 +1,114 @@
+package userimpl
+
+import (
+	"context"
+	"task/internal/identity/monitoringactivities"
+	"task/internal/identity/user"
+)
+
+// DeactivateUser disables the account, revokes its sessions and access
+// tokens and hands its open tasks over to cmd.ReassignTo. Accounts with open
+// tasks cannot be deactivated without a new assignee.
+func (s *service) DeactivateUser(ctx context.Context, cmd *user.DeactivateUserCommand) (*user.DeactivationResult, error) {
+	target, err := s.store.getUserByID(ctx, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if target == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	if target.Email == cmd.ActorEmail {
+		return nil, user.ErrCannotDeactivateSelf
+	}
+
+	if target.Status != user.Active {
+		return nil, user.ErrUserAlreadyInactive
+	}
+
+	// HR and admins must not be able to lock out the superusers
+	superuser, err := s.store.hasRole(ctx, target.ID, user.RoleSuperUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if superuser {
+		actor, err := s.store.getUserByEmail(ctx, cmd.ActorEmail)
+		if err != nil {
+			return nil, err
+		}
+
+		allowed := false
+		if actor != nil {
+			allowed, err = s.store.hasRole(ctx, actor.ID, user.RoleSuperUser)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !allowed {
+			return nil, user.ErrCannotDeactivateSuperuser
+		}
+	}
+
+	reassigned, revoked, err := s.store.deactivate(ctx, cmd.ID, cmd.ReassignTo)
+	if err != nil {
+		return nil, err
+	}
+
+	// Open sessions must stop working on the next request, not when the cache expires
+	s.access.InvalidateUser(cmd.ID)
+
+	result, err := s.store.getUserByID(ctx, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	monitoringactivities.Record(ctx, monitoringactivities.EventUserDeactivated, monitoringactivities.TargetUser, cmd.ID,
+		map[string]interface{}{"status": target.Status},
+		map[string]interface{}{
+			"status":           user.Inactive,
+			"reassign_to":      cmd.ReassignTo,
+			"reassigned_tasks": reassigned,
+			"revoked_tokens":   revoked,
+		},
+	)
+
+	return &user.DeactivationResult{
+		User:            result,
+		ReassignedTasks: reassigned,
+		RevokedTokens:   revoked,
+	}, nil
+}
+
+// ReactivateUser lets an inactive user log in again. Sessions revoked on
+// deactivation stay revoked.
+func (s *service) ReactivateUser(ctx context.Context, id int, actorEmail string) (*user.User, error) {
+	target, err := s.store.getUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if target == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	ok, err := s.store.reactivate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, user.ErrUserNotInactive
+	}
+
+	s.access.InvalidateUser(id)
+
+	monitoringactivities.Record(ctx, monitoringactivities.EventUserReactivated, monitoringactivities.TargetUser, id,
+		map[string]interface{}{"status": target.Status},
+		map[string]interface{}{"status": user.Active},
+	)
+
+	return s.store.getUserByID(ctx, id)
+}
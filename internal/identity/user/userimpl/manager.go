@@ -0,0 +1,53 @@
+package userimpl
+
+import (
+	"context"
+	"task/internal/identity/monitoringactivities"
+	"task/internal/identity/user"
+)
+
+// maxReportDepth bounds how far down the reporting line reports are listed
+const maxReportDepth = 32
+
+func (s *service) SetManager(ctx context.Context, cmd *user.SetManagerCommand) (*user.User, error) {
+	before, err := s.store.getUserByID(ctx, cmd.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.store.setManager(ctx, cmd.UserID, cmd.ManagerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !updated {
+		return nil, user.ErrUserNotFound
+	}
+
+	after, err := s.store.getUserByID(ctx, cmd.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if before != nil && after != nil {
+		monitoringactivities.Record(ctx, monitoringactivities.EventUserManagerChanged, monitoringactivities.TargetUser, cmd.UserID,
+			map[string]interface{}{"manager_id": before.ManagerID},
+			map[string]interface{}{"manager_id": after.ManagerID},
+		)
+	}
+
+	return after, nil
+}
+
+func (s *service) GetReports(ctx context.Context, query *user.ReportsQuery) ([]*user.Report, error) {
+	existing, err := s.store.getUserByID(ctx, query.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	return s.store.getReports(ctx, query.UserID, query.Indirect)
+}
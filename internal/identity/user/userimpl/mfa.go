@@ -0,0 +1,338 @@
+package userimpl
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"task/internal/identity/user"
+	"task/pkg/util/jwt"
+	"task/pkg/util/totp"
+	"time"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	mfaEnrollmentTTL  = 15 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// completeLogin issues a session token, or the token for the two-factor step
+// the user still has to pass.
+func (s *service) completeLogin(ctx context.Context, result *user.User) (*user.LoginResult, error) {
+	if result.MFAEnabled {
+		challengeToken, err := jwt.GenerateActionToken(result.Email, jwt.PurposeMFAChallenge, mfaChallengeTTL)
+		if err != nil {
+			return nil, err
+		}
+
+		return &user.LoginResult{
+			MFARequired:    true,
+			ChallengeToken: challengeToken,
+		}, nil
+	}
+
+	if s.cfg.MFA.RequiredRoles[result.Role] {
+		enrollmentToken, err := jwt.GenerateActionToken(result.Email, jwt.PurposeMFAEnrollment, mfaEnrollmentTTL)
+		if err != nil {
+			return nil, err
+		}
+
+		return &user.LoginResult{
+			MFAEnrollmentRequired: true,
+			EnrollmentToken:       enrollmentToken,
+		}, nil
+	}
+
+	// Only a completed login resets the failure counters
+	err := s.clearLoginFailures(ctx, result.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.GenerateToken(result.Email, result.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.LoginResult{
+		Token: token,
+	}, nil
+}
+
+func (s *service) CompleteLogin(ctx context.Context, id int) (*user.LoginResult, error) {
+	result, err := s.store.getUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	if result.Status != user.Active {
+		return nil, user.ErrAccountInactive
+	}
+
+	return s.completeLogin(ctx, result)
+}
+
+// checkTOTP validates a code against the user's secret and refuses to accept
+// the same code twice.
+func (s *service) checkTOTP(ctx context.Context, result *user.User, code string) error {
+	if result.MFASecret == nil {
+		return user.ErrMFANotEnrolled
+	}
+
+	code = strings.TrimSpace(code)
+	if !totp.Validate(*result.MFASecret, code, time.Now()) {
+		return user.ErrInvalidMFACode
+	}
+
+	key := fmt.Sprintf("mfa:used:%d:%s", result.ID, code)
+	fresh, err := s.redisClient.SetNX(ctx, key, 1, 3*totp.Period).Result()
+	if err != nil {
+		return err
+	}
+
+	if !fresh {
+		return user.ErrInvalidMFACode
+	}
+
+	return nil
+}
+
+// mfaSubject resolves the user either from the session or from an enrollment
+// token handed out by a login that requires enrollment.
+func (s *service) mfaSubject(ctx context.Context, email, enrollmentToken string) (*user.User, error) {
+	if enrollmentToken != "" {
+		subject, err := jwt.ValidateActionToken(enrollmentToken, jwt.PurposeMFAEnrollment)
+		if err != nil {
+			return nil, user.ErrInvalidMFAToken
+		}
+		email = subject
+	}
+
+	result, err := s.store.getUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	return result, nil
+}
+
+func (s *service) VerifyMFA(ctx context.Context, cmd *user.VerifyMFACommand) (string, error) {
+	email, err := jwt.ValidateActionToken(cmd.ChallengeToken, jwt.PurposeMFAChallenge)
+	if err != nil {
+		return "", user.ErrInvalidMFAToken
+	}
+
+	err = s.checkLoginAllowed(ctx, email, cmd.IPAddress)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := s.store.getUserByEmail(ctx, email)
+	if err != nil {
+		return "", err
+	}
+
+	if result == nil || !result.MFAEnabled {
+		return "", user.ErrInvalidMFAToken
+	}
+
+	if result.Status != user.Active {
+		return "", user.ErrAccountInactive
+	}
+
+	if cmd.RecoveryCode != "" {
+		used, err := s.store.useRecoveryCode(ctx, result.ID, hashRecoveryCode(cmd.RecoveryCode))
+		if err != nil {
+			return "", err
+		}
+
+		if !used {
+			err = user.ErrInvalidMFACode
+		}
+	} else {
+		err = s.checkTOTP(ctx, result, cmd.Code)
+	}
+
+	if err == user.ErrInvalidMFACode {
+		failErr := s.recordLoginFailure(ctx, email, cmd.IPAddress)
+		if failErr != nil {
+			return "", failErr
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	err = s.clearLoginFailures(ctx, email)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.GenerateToken(result.Email, result.Role)
+}
+
+func (s *service) EnrollMFA(ctx context.Context, cmd *user.EnrollMFACommand) (*user.MFAEnrollment, error) {
+	result, err := s.mfaSubject(ctx, cmd.Email, cmd.EnrollmentToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MFAEnabled {
+		return nil, user.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.setMFASecret(ctx, result.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.MFAEnrollment{
+		Secret:     secret,
+		OtpauthURI: totp.URI(s.cfg.MFA.Issuer, result.Email, secret),
+	}, nil
+}
+
+func (s *service) ConfirmMFA(ctx context.Context, cmd *user.ConfirmMFACommand) (*user.MFAConfirmation, error) {
+	result, err := s.mfaSubject(ctx, cmd.Email, cmd.EnrollmentToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MFAEnabled {
+		return nil, user.ErrMFAAlreadyEnabled
+	}
+
+	err = s.checkTOTP(ctx, result, cmd.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.enableMFA(ctx, result.ID, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation := &user.MFAConfirmation{
+		RecoveryCodes: codes,
+	}
+
+	// A forced enrollment finishes the login that started it
+	if cmd.EnrollmentToken != "" {
+		err = s.clearLoginFailures(ctx, result.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		confirmation.Token, err = jwt.GenerateToken(result.Email, result.Role)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return confirmation, nil
+}
+
+func (s *service) DisableMFA(ctx context.Context, cmd *user.MFACodeCommand) error {
+	result, err := s.mfaSubject(ctx, cmd.Email, "")
+	if err != nil {
+		return err
+	}
+
+	if !result.MFAEnabled {
+		return user.ErrMFANotEnrolled
+	}
+
+	if s.cfg.MFA.RequiredRoles[result.Role] {
+		return user.ErrMFARequired
+	}
+
+	err = s.checkTOTP(ctx, result, cmd.Code)
+	if err != nil {
+		return err
+	}
+
+	return s.store.disableMFA(ctx, result.ID)
+}
+
+func (s *service) RegenerateRecoveryCodes(ctx context.Context, cmd *user.MFACodeCommand) ([]string, error) {
+	result, err := s.mfaSubject(ctx, cmd.Email, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.MFAEnabled {
+		return nil, user.ErrMFANotEnrolled
+	}
+
+	err = s.checkTOTP(ctx, result, cmd.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.replaceRecoveryCodes(ctx, result.ID, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCodes returns the codes to show to the user and the hashes
+// to store in their place.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+
+		encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))[:10]
+		code := encoded[:5] + "-" + encoded[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed loosely
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(code)
+	normalized = strings.ReplaceAll(normalized, "-", "")
+	normalized = strings.ReplaceAll(normalized, " ", "")
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+package userimpl
+
+import (
+	"context"
+	"task/internal/identity/user"
+)
+
+func (s *service) GetProfile(ctx context.Context, email string) (*user.User, error) {
+	result, err := s.store.getUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	result.AvatarURL = avatarURL(result)
+
+	return result, nil
+}
+
+func (s *service) UpdateProfile(ctx context.Context, cmd *user.UpdateProfileCommand) (*user.User, error) {
+	existing, err := s.store.getUserByEmail(ctx, cmd.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	err = s.store.updateProfile(ctx, existing.ID, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cached access carries the timezone of the principal
+	s.access.InvalidateUser(existing.ID)
+
+	return s.GetProfile(ctx, cmd.Email)
+}
+
+func (s *service) GetProfileDepartment(ctx context.Context, email string) (*user.UserDepartment, error) {
+	result, err := s.store.getDepartmentByUserEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, user.ErrNoDepartment
+	}
+
+	return result, nil
+}
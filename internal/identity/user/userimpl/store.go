@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"strings"
 	"task/internal/db"
+	"task/internal/identity/task"
 	"task/internal/identity/user"
 
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
@@ -25,45 +27,22 @@ func NewStore(db db.DB) *store {
 	}
 }
 
-func (s *store) create(ctx context.Context, cmd *user.CreateUserCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
-		rawSQL := `
-			INSERT INTO users (
-				first_name,
-				last_name,
-				email,
-				password_hash,
-				address,
-				phone_number,
-				date_of_birth,
-				role,
-				status
-			) VALUES (
-				$1, $2, $3, $4, $5, $6, $7, $8, $9 
-			) RETURNING id
-		`
+// existingEmails returns which of the given emails are already registered,
+// compared case-insensitively and keyed in lower case
+func (s *store) existingEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	var taken []string
 
-		var id int
+	err := s.db.Select(ctx, &taken, "SELECT LOWER(email) FROM users WHERE LOWER(email) = ANY($1)", pq.Array(emails))
+	if err != nil {
+		return nil, err
+	}
 
-		err := tx.QueryRow(
-			ctx,
-			rawSQL,
-			cmd.FirstName,
-			cmd.LastName,
-			cmd.Email,
-			cmd.Password,
-			cmd.Address,
-			cmd.PhoneNumber,
-			cmd.DateOfBirth,
-			cmd.Role,
-			cmd.Status,
-		).Scan(&id)
-		if err != nil {
-			return err
-		}
+	result := make(map[string]bool, len(taken))
+	for _, email := range taken {
+		result[email] = true
+	}
 
-		return nil
-	})
+	return result, nil
 }
 
 func (s *store) registerUser(ctx context.Context, cmd *user.RegisterUserCommand, role string) error {
@@ -122,7 +101,18 @@ func (s *store) getUserByID(ctx context.Context, id int) (*user.User, error) {
 			phone_number,
 			date_of_birth,
 			role,
-			status
+			status,
+			email_verified_at,
+			mfa_secret,
+			mfa_enabled,
+			version,
+			job_title,
+			timezone,
+			locale,
+			avatar_key,
+			avatar_updated_at,
+			deactivated_at,
+			manager_id
 		FROM 
 			users
 		WHERE
@@ -141,42 +131,46 @@ func (s *store) getUserByID(ctx context.Context, id int) (*user.User, error) {
 	return &user, nil
 }
 
-func (s *store) updateUser(ctx context.Context, cmd *user.UpdateUserCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
-		rawSQL := `
-			UPDATE users
-			SET
-				first_name = $1,
-				last_name = $2,
-				email = $3,
-				address = $4,
-				phone_number = $5,
-				date_of_birth = $6,
-				role = $7,
-				status = $8
-			WHERE
-				id = $9
-		`
+// updateUser returns false when cmd.Version no longer matches the stored version
+func (s *store) updateUser(ctx context.Context, cmd *user.UpdateUserCommand) (bool, error) {
+	rawSQL := `
+		UPDATE users
+		SET
+			first_name = $1,
+			last_name = $2,
+			email = $3,
+			address = $4,
+			phone_number = $5,
+			date_of_birth = $6,
+			version = version + 1,
+			updated_at = NOW()
+		WHERE
+			id = $7 AND
+			($8 = 0 OR version = $8)
+	`
 
-		_, err := s.db.Exec(
-			ctx,
-			rawSQL,
-			cmd.FirstName,
-			cmd.LastName,
-			cmd.Email,
-			cmd.Address,
-			cmd.PhoneNumber,
-			cmd.DateOfBirth,
-			cmd.Role,
-			cmd.Status,
-			cmd.ID,
-		)
-		if err != nil {
-			return err
-		}
+	result, err := s.db.Exec(
+		ctx,
+		rawSQL,
+		cmd.FirstName,
+		cmd.LastName,
+		cmd.Email,
+		cmd.Address,
+		cmd.PhoneNumber,
+		cmd.DateOfBirth,
+		cmd.ID,
+		cmd.Version,
+	)
+	if err != nil {
+		return false, err
+	}
 
-		return nil
-	})
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
 }
 
 func (s *store) getUserByEmail(ctx context.Context, email string) (*user.User, error) {
@@ -194,7 +188,16 @@ func (s *store) getUserByEmail(ctx context.Context, email string) (*user.User, e
 			phone_number,
 			date_of_birth,
 			role,
-			status
+			status,
+			email_verified_at,
+			mfa_secret,
+			mfa_enabled,
+			version,
+			job_title,
+			timezone,
+			locale,
+			avatar_key,
+			avatar_updated_at
 		FROM 
 			users
 		WHERE
@@ -213,17 +216,96 @@ func (s *store) getUserByEmail(ctx context.Context, email string) (*user.User, e
 	return &user, nil
 }
 
+func (s *store) markEmailVerified(ctx context.Context, id int) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE users
+			SET
+				email_verified_at = NOW(),
+				status = $1,
+				updated_at = NOW()
+			WHERE
+				id = $2
+		`
+
+		_, err := tx.Exec(ctx, rawSQL, user.Active, id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
 func (s *store) searchUser(ctx context.Context, query *user.SearchUserQuery) (*user.SearchUserResult, error) {
-	var (
-		result = &user.SearchUserResult{
-			User: make([]*user.User, 0),
+	result := &user.SearchUserResult{
+		User: make([]*user.User, 0),
+	}
+
+	sql, whereParams, paramIndex := searchUserSQL(query)
+
+	count, err := s.getCount(ctx, sql, whereParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.PerPage > 0 {
+		offset := query.PerPage * (query.Page - 1)
+		sql.WriteString(fmt.Sprintf(" LIMIT $%d OFFSET $%d", paramIndex, paramIndex+1))
+		whereParams = append(whereParams, query.PerPage, offset)
+	}
+
+	err = s.db.Select(ctx, &result.User, sql.String(), whereParams...)
+	if err != nil {
+		return nil, err
+	}
+
+	result.TotalCount = count
+
+	return result, nil
+}
+
+// exportUsers calls fn for every user matching the query, rows are read one
+// at a time so large exports are not held in memory
+func (s *store) exportUsers(ctx context.Context, query *user.SearchUserQuery, fn func(*user.User) error) error {
+	sql, whereParams, paramIndex := searchUserSQL(query)
+
+	if query.PerPage > 0 {
+		offset := query.PerPage * (query.Page - 1)
+		sql.WriteString(fmt.Sprintf(" LIMIT $%d OFFSET $%d", paramIndex, paramIndex+1))
+		whereParams = append(whereParams, query.PerPage, offset)
+	}
+
+	rows, err := s.db.Queryx(ctx, sql.String(), whereParams...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result user.User
+
+		if err := rows.StructScan(&result); err != nil {
+			return err
+		}
+
+		if err := fn(&result); err != nil {
+			return err
 		}
+	}
+
+	return rows.Err()
+}
+
+// searchUserSQL builds the filtered and ordered user query shared by search
+// and export, it returns the next free parameter index
+func searchUserSQL(query *user.SearchUserQuery) (bytes.Buffer, []interface{}, int) {
+	var (
 		sql            bytes.Buffer
 		whereCondition = make([]string, 0)
 		whereParams    = make([]interface{}, 0)
 		paramIndex     = 1
 	)
-
 	sql.WriteString(`
 		SELECT
 			id,
@@ -282,25 +364,7 @@ func (s *store) searchUser(ctx context.Context, query *user.SearchUserQuery) (*u
 
 	sql.WriteString(" ORDER BY id DESC")
 
-	count, err := s.getCount(ctx, sql, whereParams)
-	if err != nil {
-		return nil, err
-	}
-
-	if query.PerPage > 0 {
-		offset := query.PerPage * (query.Page - 1)
-		sql.WriteString(fmt.Sprintf(" LIMIT $%d OFFSET $%d", paramIndex, paramIndex+1))
-		whereParams = append(whereParams, query.PerPage, offset)
-	}
-
-	err = s.db.Select(ctx, &result.User, sql.String(), whereParams...)
-	if err != nil {
-		return nil, err
-	}
-
-	result.TotalCount = count
-
-	return result, nil
+	return sql, whereParams, paramIndex
 }
 
 func (s *store) deleteUser(ctx context.Context, id int) error {
@@ -361,3 +425,475 @@ func (s *store) getCount(ctx context.Context, sql bytes.Buffer, whereParams []in
 
 	return count, nil
 }
+
+// setMFASecret stores a pending TOTP secret, it only takes effect once enabled
+func (s *store) setMFASecret(ctx context.Context, id int, secret string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE users
+			SET
+				mfa_secret = $1,
+				mfa_enabled = FALSE,
+				updated_at = NOW()
+			WHERE
+				id = $2
+		`
+
+		_, err := tx.Exec(ctx, rawSQL, secret, id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// enableMFA turns on two-factor authentication and replaces the recovery codes
+func (s *store) enableMFA(ctx context.Context, id int, codeHashes []string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE users
+			SET
+				mfa_enabled = TRUE,
+				updated_at = NOW()
+			WHERE
+				id = $1
+		`
+
+		_, err := tx.Exec(ctx, rawSQL, id)
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(ctx, tx, id, codeHashes)
+	})
+}
+
+func (s *store) disableMFA(ctx context.Context, id int) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE users
+			SET
+				mfa_secret = NULL,
+				mfa_enabled = FALSE,
+				updated_at = NOW()
+			WHERE
+				id = $1
+		`
+
+		_, err := tx.Exec(ctx, rawSQL, id)
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(ctx, tx, id, nil)
+	})
+}
+
+func (s *store) replaceRecoveryCodes(ctx context.Context, id int, codeHashes []string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, id, codeHashes)
+	})
+}
+
+// useRecoveryCode marks an unused recovery code as used and reports whether
+// one matched.
+func (s *store) useRecoveryCode(ctx context.Context, id int, codeHash string) (bool, error) {
+	rawSQL := `
+		UPDATE user_recovery_codes
+		SET used_at = NOW()
+		WHERE
+			user_id = $1 AND
+			code_hash = $2 AND
+			used_at IS NULL
+	`
+
+	result, err := s.db.Exec(ctx, rawSQL, id, codeHash)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx db.Tx, id int, codeHashes []string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rawSQL := `
+		INSERT INTO user_recovery_codes (
+			user_id,
+			code_hash
+		) VALUES (
+			$1, $2
+		)
+	`
+
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec(ctx, rawSQL, id, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasRole checks both the primary role and the additional roles of a user
+func (s *store) hasRole(ctx context.Context, id int, role string) (bool, error) {
+	var found bool
+
+	rawSQL := `
+		SELECT EXISTS (
+			SELECT 1 FROM users WHERE id = $1 AND role = $2
+			UNION ALL
+			SELECT 1
+			FROM user_roles ur
+			JOIN roles r ON r.id = ur.role_id
+			WHERE ur.user_id = $1 AND r.name = $2
+		)
+	`
+
+	err := s.db.Get(ctx, &found, rawSQL, id, role)
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// updateProfile only changes the fields that were sent, nil keeps the value
+func (s *store) updateProfile(ctx context.Context, id int, cmd *user.UpdateProfileCommand) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE users
+			SET
+				first_name = COALESCE($1, first_name),
+				last_name = COALESCE($2, last_name),
+				address = COALESCE($3, address),
+				phone_number = COALESCE($4, phone_number),
+				date_of_birth = COALESCE($5::DATE, date_of_birth),
+				job_title = COALESCE($6, job_title),
+				timezone = COALESCE($7, timezone),
+				locale = COALESCE($8, locale),
+				version = version + 1,
+				updated_at = NOW()
+			WHERE
+				id = $9
+		`
+
+		_, err := tx.Exec(
+			ctx,
+			rawSQL,
+			cmd.FirstName,
+			cmd.LastName,
+			cmd.Address,
+			cmd.PhoneNumber,
+			cmd.DateOfBirth,
+			cmd.JobTitle,
+			cmd.Timezone,
+			cmd.Locale,
+			id,
+		)
+		return err
+	})
+}
+
+// getDepartmentByUserEmail returns the main department of the user, the ones
+// the user leads come first, then the oldest membership
+func (s *store) getDepartmentByUserEmail(ctx context.Context, email string) (*user.UserDepartment, error) {
+	var result user.UserDepartment
+
+	rawSQL := `
+		SELECT
+			d.id,
+			d.name,
+			d.location,
+			d.created_at,
+			d.updated_at
+		FROM
+			users u
+		JOIN department_members m ON m.user_id = u.id AND m.left_at IS NULL
+		JOIN departments d ON d.id = m.department_id
+		WHERE
+			u.email = $1
+		ORDER BY
+			m.role = 'lead' DESC,
+			m.joined_at,
+			m.id
+		LIMIT 1
+	`
+
+	err := s.db.Get(ctx, &result, rawSQL, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// setAvatar stores the storage key of the avatar, nil removes it
+func (s *store) setAvatar(ctx context.Context, id int, key *string) error {
+	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE users
+			SET
+				avatar_key = $1,
+				avatar_updated_at = CASE WHEN $1::VARCHAR IS NULL THEN NULL ELSE NOW() END,
+				version = version + 1,
+				updated_at = NOW()
+			WHERE
+				id = $2
+		`
+
+		_, err := tx.Exec(ctx, rawSQL, key, id)
+		return err
+	})
+}
+
+// deactivate disables the account, hands its open tasks over to reassignTo
+// and revokes its sessions and access tokens in one transaction
+func (s *store) deactivate(ctx context.Context, id int, reassignTo *int) (int, int, error) {
+	var reassigned, revoked int
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		rawSQL := `
+			UPDATE users
+			SET
+				status = $1,
+				deactivated_at = NOW(),
+				sessions_revoked_at = NOW(),
+				version = version + 1,
+				updated_at = NOW()
+			WHERE
+				id = $2 AND
+				status = $3
+		`
+
+		result, err := tx.Exec(ctx, rawSQL, user.Inactive, id, user.Active)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return user.ErrUserAlreadyInactive
+		}
+
+		if reassignTo == nil {
+			var open int
+
+			err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM tasks WHERE user_id = $1 AND status <> $2", id, task.TaskDone).Scan(&open)
+			if err != nil {
+				return err
+			}
+
+			if open > 0 {
+				return user.ErrReassignmentRequired
+			}
+		} else {
+			// Lock the new assignee so it cannot be deactivated concurrently
+			var status user.Status
+
+			err = tx.QueryRow(ctx, "SELECT status FROM users WHERE id = $1 FOR UPDATE", *reassignTo).Scan(&status)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+
+			if status != user.Active {
+				return user.ErrInvalidReassignee
+			}
+
+			rawSQL = `
+				UPDATE tasks
+				SET
+					user_id = $1,
+					version = version + 1,
+					updated_at = NOW()
+				WHERE
+					user_id = $2 AND
+					status <> $3
+			`
+
+			result, err = tx.Exec(ctx, rawSQL, *reassignTo, id, task.TaskDone)
+			if err != nil {
+				return err
+			}
+
+			affected, err = result.RowsAffected()
+			if err != nil {
+				return err
+			}
+
+			reassigned = int(affected)
+		}
+
+		result, err = tx.Exec(ctx, "UPDATE personal_access_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", id)
+		if err != nil {
+			return err
+		}
+
+		affected, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		revoked = int(affected)
+
+		return nil
+	})
+
+	return reassigned, revoked, err
+}
+
+func (s *store) reactivate(ctx context.Context, id int) (bool, error) {
+	rawSQL := `
+		UPDATE users
+		SET
+			status = $1,
+			deactivated_at = NULL,
+			version = version + 1,
+			updated_at = NOW()
+		WHERE
+			id = $2 AND
+			status = $3
+	`
+
+	result, err := s.db.Exec(ctx, rawSQL, user.Active, id, user.Inactive)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// managerLock is the advisory lock key taken while reporting lines change
+const managerLock = 4301
+
+// setManager returns false when the user does not exist. The new manager must
+// be active and must not report to the user, directly or not.
+func (s *store) setManager(ctx context.Context, id int, managerID *int) (bool, error) {
+	var updated bool
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+		if managerID != nil {
+			_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", managerLock)
+			if err != nil {
+				return err
+			}
+
+			rawSQL := `
+				WITH RECURSIVE chain AS (
+					SELECT id, manager_id FROM users WHERE id = $1 AND status = $3
+					UNION
+					SELECT u.id, u.manager_id FROM users u JOIN chain c ON u.id = c.manager_id
+				)
+				SELECT
+					EXISTS (SELECT 1 FROM chain WHERE id = $1) AS found,
+					EXISTS (SELECT 1 FROM chain WHERE id = $2) AS cycle
+			`
+
+			var found, cycle bool
+
+			err = tx.QueryRow(ctx, rawSQL, *managerID, id, user.Active).Scan(&found, &cycle)
+			if err != nil {
+				return err
+			}
+
+			if !found {
+				return user.ErrManagerNotFound
+			}
+
+			if cycle {
+				return user.ErrManagerCycle
+			}
+		}
+
+		rawSQL := `
+			UPDATE users
+			SET
+				manager_id = $1,
+				version = version + 1,
+				updated_at = NOW()
+			WHERE
+				id = $2
+		`
+
+		result, err := tx.Exec(ctx, rawSQL, managerID, id)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		updated = affected > 0
+
+		return nil
+	})
+
+	return updated, err
+}
+
+// getReports walks down the reporting line of a user, only the direct reports
+// unless indirect is set
+func (s *store) getReports(ctx context.Context, id int, indirect bool) ([]*user.Report, error) {
+	result := make([]*user.Report, 0)
+
+	maxDepth := 1
+	if indirect {
+		maxDepth = maxReportDepth
+	}
+
+	rawSQL := `
+		WITH RECURSIVE reports AS (
+			SELECT id, first_name, last_name, email, job_title, manager_id, 1 AS depth
+			FROM users
+			WHERE manager_id = $1
+			UNION ALL
+			SELECT u.id, u.first_name, u.last_name, u.email, u.job_title, u.manager_id, r.depth + 1
+			FROM users u
+			JOIN reports r ON u.manager_id = r.id
+			WHERE r.depth < $2
+		)
+		SELECT
+			id,
+			first_name,
+			last_name,
+			email,
+			job_title,
+			manager_id,
+			depth
+		FROM
+			reports
+		ORDER BY depth, last_name, first_name
+	`
+
+	err := s.db.Select(ctx, &result, rawSQL, id, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -2,10 +2,14 @@ package userimpl
 
 import (
 	"context"
+	"encoding/json"
 	"task/config"
 	"task/internal/db"
+	"task/internal/identity/invitation"
+	"task/internal/identity/monitoringactivities"
+	"task/internal/identity/rbac"
 	"task/internal/identity/user"
-	"task/pkg/util/jwt"
+	"task/pkg/util/mergepatch"
 	util "task/pkg/util/password"
 	"time"
 
@@ -19,47 +23,26 @@ type service struct {
 	log         *zap.Logger
 	db          db.DB
 	redisClient *redis.Client
+	activities  monitoringactivities.Service
+	access      rbac.Service
+	invitations invitation.Service
 }
 
-func NewService(db db.DB, cfg *config.Config) *service {
+func NewService(db db.DB, cfg *config.Config, activities monitoringactivities.Service, access rbac.Service, invitations invitation.Service) *service {
 	return &service{
 		store:       NewStore(db),
 		cfg:         cfg,
 		db:          db,
 		redisClient: cfg.RedisClient,
+		activities:  activities,
+		access:      access,
+		invitations: invitations,
 		log:         zap.L().Named("user.service"),
 	}
 }
 
-func (s *service) CreateUser(ctx context.Context, cmd *user.CreateUserCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
-		result, err := s.store.userTaken(ctx, 0, cmd.Email)
-		if err != nil {
-			return err
-		}
-
-		if len(result) > 0 {
-			return user.ErrUserAlreadyExists
-		}
-
-		passwordHash, err := util.HashPassword(cmd.Password)
-		if err != nil {
-			return err
-		}
-
-		cmd.Password = passwordHash
-
-		err = s.store.create(ctx, cmd)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-}
-
 func (s *service) UpdateUser(ctx context.Context, cmd *user.UpdateUserCommand) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
 		// Check if the user exists
 		existingUser, err := s.store.getUserByID(ctx, cmd.ID)
 		if err != nil {
@@ -80,13 +63,99 @@ func (s *service) UpdateUser(ctx context.Context, cmd *user.UpdateUserCommand) e
 			return user.ErrUserAlreadyExists
 		}
 
-		err = s.store.updateUser(ctx, cmd)
+		updated, err := s.store.updateUser(ctx, cmd)
+		if err != nil {
+			return err
+		}
+
+		if !updated {
+			return user.ErrVersionConflict
+		}
+
+		after, err := s.store.getUserByID(ctx, cmd.ID)
 		if err != nil {
 			return err
 		}
 
+		monitoringactivities.Record(ctx, monitoringactivities.EventUserUpdated, monitoringactivities.TargetUser, cmd.ID, existingUser, after)
+
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// The cached access holds the email the user logged in with. Dropping it
+	// before the commit would let a concurrent request cache the old row again.
+	s.access.InvalidateUser(cmd.ID)
+
+	return nil
+}
+
+func (s *service) PatchUser(ctx context.Context, cmd *user.PatchUserCommand) (*user.User, error) {
+	existing, err := s.store.getUserByID(ctx, cmd.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, user.ErrUserNotFound
+	}
+
+	if cmd.Version != 0 && cmd.Version != existing.Version {
+		return nil, user.ErrVersionConflict
+	}
+
+	// Role and status have their own endpoints with stricter checks, the
+	// document below leaves them out but the patch must not try to set them
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(cmd.Patch, &fields); err != nil {
+		return nil, user.ErrInvalidPatch
+	}
+
+	for _, field := range []string{"role", "status"} {
+		if _, ok := fields[field]; ok {
+			return nil, user.ErrFieldNotPatchable
+		}
+	}
+
+	current, err := json.Marshal(&user.UpdateUserCommand{
+		ID:          existing.ID,
+		FirstName:   existing.FirstName,
+		LastName:    existing.LastName,
+		Email:       existing.Email,
+		Address:     existing.Address,
+		PhoneNumber: existing.PhoneNumber,
+		DateOfBirth: existing.DateOfBirth.DateOnly(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := mergepatch.Apply(current, cmd.Patch)
+	if err != nil {
+		return nil, user.ErrInvalidPatch
+	}
+
+	var update user.UpdateUserCommand
+	if err := json.Unmarshal(patched, &update); err != nil {
+		return nil, user.ErrInvalidPatch
+	}
+
+	// The patch cannot move the update to another user, and the version read
+	// above guards against changes made in between.
+	update.ID = existing.ID
+	update.Version = existing.Version
+
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.UpdateUser(ctx, &update); err != nil {
+		return nil, err
+	}
+
+	return s.GetUserByID(ctx, existing.ID)
 }
 
 func (s *service) GetUserByID(ctx context.Context, id int) (*user.User, error) {
@@ -95,6 +164,10 @@ func (s *service) GetUserByID(ctx context.Context, id int) (*user.User, error) {
 		return nil, err
 	}
 
+	if result != nil {
+		result.AvatarURL = avatarURL(result)
+	}
+
 	return result, nil
 }
 
@@ -119,7 +192,7 @@ func (s *service) SearchUser(ctx context.Context, query *user.SearchUserQuery) (
 }
 
 func (s *service) DeleteUser(ctx context.Context, id int) error {
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
 		result, err := s.store.getUserByID(ctx, id)
 		if err != nil {
 			return err
@@ -134,40 +207,70 @@ func (s *service) DeleteUser(ctx context.Context, id int) error {
 			return err
 		}
 
+		monitoringactivities.Record(ctx, monitoringactivities.EventUserDeleted, monitoringactivities.TargetUser, id, result, nil)
+
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	s.access.InvalidateUser(id)
+
+	return nil
 }
 
-func (s *service) GetUserByEmail(ctx context.Context, cmd *user.LoginUserCommand) (string, error) {
+func (s *service) GetUserByEmail(ctx context.Context, cmd *user.LoginUserCommand) (*user.LoginResult, error) {
+	err := s.checkLoginAllowed(ctx, cmd.Email, cmd.IPAddress)
+	if err != nil {
+		return nil, err
+	}
+
 	result, err := s.store.getUserByEmail(ctx, cmd.Email)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if result == nil {
-		return "", user.ErrUserNotFound
+		// Unknown emails count too so lockouts don't reveal which accounts exist
+		err = s.recordLoginFailure(ctx, cmd.Email, cmd.IPAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, user.ErrUserNotFound
 	}
 
 	// Check if the password is correct
 	err = util.CheckPasswordHash(result.PasswordHash, cmd.Password)
 	if err != nil {
-		return "", user.ErrInvalidPassword
+		err = s.recordLoginFailure(ctx, cmd.Email, cmd.IPAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, user.ErrInvalidPassword
 	}
 
-	// Generate JWT token
-	token, err := jwt.GenerateToken(result.Email, result.Role)
-	if err != nil {
-		return "", err
+	if result.EmailVerifiedAt == nil {
+		return nil, user.ErrEmailNotVerified
+	}
+
+	if result.Status != user.Active {
+		return nil, user.ErrAccountInactive
 	}
 
-	return token, nil
+	return s.completeLogin(ctx, result)
 }
 
 func (s *service) RegisterUser(ctx context.Context, cmd *user.RegisterUserCommand) error {
 	// Ensuring that the user role is set
 	role := "user"
 
-	return s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
+	// Self-registered accounts stay inactive until the email is verified
+	cmd.Status = user.Inactive
+
+	err := s.db.WithTransaction(ctx, func(ctx context.Context, tx db.Tx) error {
 		result, err := s.store.userTaken(ctx, 0, cmd.Email)
 		if err != nil {
 			return err
@@ -191,7 +294,17 @@ func (s *service) RegisterUser(ctx context.Context, cmd *user.RegisterUserComman
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// The account exists at this point, a failed email can be resent later
+	err = s.sendVerification(ctx, cmd.Email)
+	if err != nil {
+		s.log.Error("Failed to send verification email", zap.String("email", cmd.Email), zap.Error(err))
+	}
 
+	return nil
 }
 
 // InvalidateToken adds the token to a blacklist using Redis
@@ -0,0 +1,184 @@
+package userimpl
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"task/internal/db"
+	"task/internal/identity/rbac"
+	"task/internal/identity/user"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDB serves a single stored user and fails every write, so a test only
+// reaches the statements it expects. With transactions set it runs them,
+// failing the commit with commitErr.
+type fakeDB struct {
+	user         *user.User
+	transactions bool
+	commitErr    error
+	open         int // Transactions in progress
+}
+
+func (f *fakeDB) Get(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	result, ok := dest.(*user.User)
+	if !ok || f.user == nil || args[0] != f.user.ID {
+		return sql.ErrNoRows
+	}
+
+	*result = *f.user
+	return nil
+}
+
+func (f *fakeDB) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return errors.New("unexpected select")
+}
+
+func (f *fakeDB) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, errors.New("unexpected exec")
+}
+
+func (f *fakeDB) Queryx(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (db.Tx, error) {
+	return nil, errors.New("unexpected transaction")
+}
+
+func (f *fakeDB) WithTransaction(ctx context.Context, fn func(ctx context.Context, tx db.Tx) error) error {
+	if !f.transactions {
+		return errors.New("unexpected transaction")
+	}
+
+	f.open++
+	err := fn(ctx, fakeTx{})
+	f.open--
+	if err != nil {
+		return err
+	}
+
+	return f.commitErr
+}
+
+// fakeTx accepts every statement
+type fakeTx struct{}
+
+func (fakeTx) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (fakeTx) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (fakeTx) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+// fakeAccess records cache invalidations and whether one came while a
+// transaction was still open
+type fakeAccess struct {
+	rbac.Service
+	db          *fakeDB
+	invalidated []int
+	early       bool
+}
+
+func (f *fakeAccess) InvalidateUser(userID int) {
+	f.invalidated = append(f.invalidated, userID)
+	if f.db.open > 0 {
+		f.early = true
+	}
+}
+
+func TestPatchUserValidation(t *testing.T) {
+	stored := &user.User{
+		ID:          7,
+		FirstName:   "Jane",
+		LastName:    "Doe",
+		Email:       "jane@example.com",
+		Address:     "1 Main St",
+		PhoneNumber: "0123456789",
+		DateOfBirth: "1990-01-01T00:00:00Z",
+		Version:     3,
+	}
+
+	tests := []struct {
+		name    string
+		patch   string
+		version int
+		want    error
+	}{
+		{"null email", `{"email":null}`, 0, user.ErrInvalidEmail},
+		{"empty email", `{"email":""}`, 0, user.ErrInvalidEmail},
+		{"invalid email", `{"email":"jane"}`, 0, user.ErrInvalidEmail},
+		{"null first name", `{"first_name":null}`, 0, user.ErrInvalidFirstName},
+		{"role", `{"role":"admin"}`, 0, user.ErrFieldNotPatchable},
+		{"status", `{"status":"inactive"}`, 0, user.ErrFieldNotPatchable},
+		{"not an object", `["email"]`, 0, user.ErrInvalidPatch},
+		{"stale version", `{"first_name":"Janet"}`, 2, user.ErrVersionConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := &fakeDB{user: stored}
+			s := &service{store: NewStore(database), db: database}
+
+			_, err := s.PatchUser(context.Background(), &user.PatchUserCommand{
+				ID:      stored.ID,
+				Patch:   []byte(tt.patch),
+				Version: tt.version,
+			})
+			if err != tt.want {
+				t.Fatalf("PatchUser() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchUserNotFound(t *testing.T) {
+	database := &fakeDB{}
+	s := &service{store: NewStore(database), db: database}
+
+	_, err := s.PatchUser(context.Background(), &user.PatchUserCommand{ID: 7, Patch: []byte(`{}`)})
+	if err != user.ErrUserNotFound {
+		t.Fatalf("PatchUser() error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestDeleteUserInvalidatesAfterCommit(t *testing.T) {
+	tests := []struct {
+		name      string
+		commitErr error
+		want      []int
+	}{
+		{"committed", nil, []int{7}},
+		{"commit failed", errors.New("serialization failure"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := &fakeDB{user: &user.User{ID: 7}, transactions: true, commitErr: tt.commitErr}
+			access := &fakeAccess{db: database}
+			s := &service{store: NewStore(database), db: database, access: access}
+
+			if err := s.DeleteUser(context.Background(), 7); err != tt.commitErr {
+				t.Fatalf("DeleteUser() error = %v, want %v", err, tt.commitErr)
+			}
+
+			if access.early {
+				t.Fatal("access invalidated before the commit")
+			}
+
+			if len(access.invalidated) != len(tt.want) || (len(tt.want) == 1 && access.invalidated[0] != tt.want[0]) {
+				t.Fatalf("invalidated = %v, want %v", access.invalidated, tt.want)
+			}
+		})
+	}
+}
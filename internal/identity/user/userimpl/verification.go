@@ -0,0 +1,93 @@
+package userimpl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"task/internal/identity/user"
+	"task/internal/mailer"
+	"task/pkg/util/jwt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	verificationTokenTTL     = 24 * time.Hour
+	verificationResendLimit  = 3
+	verificationResendWindow = time.Hour
+)
+
+// sendVerification emails a signed link that activates the account
+func (s *service) sendVerification(ctx context.Context, email string) error {
+	token, err := jwt.GenerateActionToken(email, jwt.PurposeEmailVerification, verificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/users/verify?token=%s", s.cfg.AppURL, url.QueryEscape(token))
+
+	return s.cfg.Mailer.Send(ctx, &mailer.Message{
+		To:      []string{email},
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Welcome!\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			link,
+			verificationTokenTTL,
+		),
+	})
+}
+
+func (s *service) VerifyEmail(ctx context.Context, token string) error {
+	email, err := jwt.ValidateActionToken(token, jwt.PurposeEmailVerification)
+	if err != nil {
+		return user.ErrInvalidVerificationToken
+	}
+
+	result, err := s.store.getUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return user.ErrInvalidVerificationToken
+	}
+
+	// Verifying twice is harmless
+	if result.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.store.markEmailVerified(ctx, result.ID)
+}
+
+func (s *service) ResendVerification(ctx context.Context, cmd *user.ResendVerificationCommand) error {
+	key := "email-verification:resend:" + cmd.Email
+
+	count, err := s.incrWithExpiry(ctx, key, verificationResendWindow)
+	if err != nil {
+		return err
+	}
+
+	if count > verificationResendLimit {
+		return user.ErrVerificationResendLimited
+	}
+
+	result, err := s.store.getUserByEmail(ctx, cmd.Email)
+	if err != nil {
+		return err
+	}
+
+	// Do not reveal whether the address is registered or already verified
+	if result == nil || result.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	err = s.sendVerification(ctx, result.Email)
+	if err != nil {
+		s.log.Error("Failed to send verification email", zap.String("email", result.Email), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -2,20 +2,26 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"task/pkg/util/jwt"
 	"time"
 
+	"task/internal/api/model"
 	"task/internal/identity/accesscontrol"
+	"task/internal/identity/accesstoken"
 	"task/internal/identity/monitoringactivities"
+	"task/internal/identity/policy"
+	"task/internal/identity/rbac"
 	"task/internal/identity/user"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
 )
 
-// Middleware to check if the user has a valid JWT
-func JWTProtected(secret string, service user.Service) fiber.Handler {
+// Middleware to check if the user has a valid JWT or personal access token
+func JWTProtected(secret string, service user.Service, tokens accesstoken.Service, access rbac.Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -32,6 +38,21 @@ func JWTProtected(secret string, service user.Service) fiber.Handler {
 
 		tokenStr := authHeader[len("Bearer "):]
 
+		// Personal access tokens are limited to the scopes they were granted
+		if strings.HasPrefix(tokenStr, accesstoken.Prefix) {
+			owner, err := tokens.Authenticate(c.Context(), tokenStr)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid, expired or revoked access token",
+				})
+			}
+
+			c.Locals("userID", owner.Email)
+			c.Locals("scopes", []string(owner.Scopes))
+
+			return loadAccess(c, access, owner.Email, time.Time{})
+		}
+
 		claims, err := jwt.ValidateToken(tokenStr)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -53,24 +74,88 @@ func JWTProtected(secret string, service user.Service) fiber.Handler {
 			})
 		}
 
+		// Impersonation tokens stop working as soon as the actor loses the superuser role
+		if claims.ActorID != "" {
+			actor, err := access.GetUserAccess(c.Context(), claims.ActorID)
+			if err != nil || !actor.Active || !actor.HasRole(accesscontrol.RoleSuperUser) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Impersonation is no longer allowed",
+				})
+			}
+
+			c.Locals("actorID", claims.ActorID)
+		}
+
 		c.Locals("userID", claims.UserID)
-		c.Locals("role", claims.Role)
 
-		return c.Next()
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+
+		return loadAccess(c, access, claims.UserID, issuedAt)
+	}
+}
+
+// loadAccess stores the roles and permissions of the authenticated user. They
+// are read from the database rather than the token so changes apply to
+// sessions that are already open. issuedAt is zero for personal access
+// tokens, which are revoked individually.
+func loadAccess(c *fiber.Ctx, access rbac.Service, email string, issuedAt time.Time) error {
+	result, err := access.GetUserAccess(c.Context(), email)
+	if err == rbac.ErrUserNotFound {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User no longer exists",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error while loading permissions",
+		})
+	}
+
+	if !result.Active {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Account has been deactivated",
+		})
+	}
+
+	if !issuedAt.IsZero() && result.SessionRevoked(issuedAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session has been revoked",
+		})
 	}
+
+	c.Locals("role", result.Role)
+	c.Locals("roles", result.Roles)
+	c.Locals("permissions", result.Permissions)
+	actorID, _ := c.Locals("actorID").(string)
+
+	c.Locals("principal", &policy.Principal{
+		UserID:      result.UserID,
+		Email:       result.Email,
+		ActorID:     actorID,
+		Timezone:    result.Timezone,
+		Roles:       result.Roles,
+		Permissions: result.Permissions,
+	})
+
+	return c.Next()
 }
 
-// Middleware to check if the user has the required role
+// Middleware to check if the user has one of the required roles
 func RequireRole(requiredRoles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		role := c.Locals("role").(string) // Get the user's role from context
+		roles, _ := c.Locals("roles").([]string) // Get the user's roles from context
 
-		// Check if the user's role is in the list of allowed roles
+		// Check if any of the user's roles is in the list of allowed roles
 		roleAllowed := false
-		for _, allowedRole := range requiredRoles {
-			if role == allowedRole {
-				roleAllowed = true
-				break
+		for _, role := range roles {
+			for _, allowedRole := range requiredRoles {
+				if role == allowedRole {
+					roleAllowed = true
+					break
+				}
 			}
 		}
 
@@ -84,20 +169,31 @@ func RequireRole(requiredRoles ...string) fiber.Handler {
 	}
 }
 
-// RequirePermission checks if the user has the required permission
+// RequirePermission checks if one of the user's roles grants the permission.
+// Personal access tokens also need the scope that covers it.
 func RequirePermission(permission string) fiber.Handler {
+	scope := accesstoken.ScopeForPermission(permission)
+
 	return func(c *fiber.Ctx) error {
-		role := c.Locals("role").(string)
+		permissions, _ := c.Locals("permissions").([]string)
+
+		allowed := false
+		for _, granted := range permissions {
+			if granted == permission {
+				allowed = true
+				break
+			}
+		}
 
-		if !accesscontrol.HasPermission(role, permission) {
+		if !allowed {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"error": "You do not have permission to access this resource",
 			})
 		}
 
-		if !accesscontrol.HasTaskPermission(role, permission) {
+		if !hasScope(c, scope) {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "You do not have permission to access this resource",
+				"error": "Access token is missing the required scope: " + scope,
 			})
 		}
 
@@ -105,7 +201,55 @@ func RequirePermission(permission string) fiber.Handler {
 	}
 }
 
-// ActivityLoggingMiddleware logs the activity of the user
+// hasScope checks that a personal access token was granted the scope.
+// Sessions opened with a password or SSO are not limited by scopes.
+func hasScope(c *fiber.Ctx, scope string) bool {
+	scopes, ok := c.Locals("scopes").([]string)
+	if !ok {
+		return true
+	}
+
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequireSession rejects personal access tokens on routes that manage the
+// account itself, such as creating further tokens.
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := c.Locals("scopes").([]string); ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This action requires a login session, access tokens are not accepted",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// RejectImpersonation blocks sensitive actions, such as changing credentials
+// or creating tokens, while a superuser is acting as another user.
+func RejectImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := c.Locals("actorID").(string); ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This action is not allowed while impersonating a user",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// ActivityLoggingMiddleware logs the activity of the user once the request is
+// handled, one entry per audit event the services recorded or a single
+// request entry when there was none. The entries are queued and written in
+// the background, a full queue drops them rather than failing the request.
 func NewActivityLoggingMiddleware(service monitoringactivities.Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Retrieve userID from context, which is expected to be a string
@@ -117,26 +261,70 @@ func NewActivityLoggingMiddleware(service monitoringactivities.Service) fiber.Ha
 			})
 		}
 
-		// Create an activity log command
-		activityLogCommand := &monitoringactivities.CreateActivityLogCommand{
-			UserID:    userIDStr, // UserID is a string now
-			Activity:  c.Method(),
-			Action:    c.Path(),
-			Resource:  c.OriginalURL(),
-			Details:   "",                              // Add any additional details if available
-			CreatedAt: time.Now().Format(time.RFC3339), // Set current time in RFC3339 format
+		// Set when a superuser is impersonating userID
+		actorID, _ := c.Locals("actorID").(string)
+
+		recorder := monitoringactivities.NewRecorder()
+		c.Locals(monitoringactivities.RecorderKey, recorder)
+
+		// Continue with the next middleware/handler
+		err := c.Next()
+
+		requestID, _ := c.Locals("requestid").(string)
+
+		// The entries outlive the request, so nothing may point into its
+		// buffers
+		base := monitoringactivities.CreateActivityLogCommand{
+			UserID:    userIDStr,
+			ActorID:   actorID,
+			Activity:  utils.CopyString(c.Method()),
+			Action:    utils.CopyString(c.Path()),
+			Resource:  utils.CopyString(c.OriginalURL()),
+			Status:    responseStatus(c, err),
+			IP:        utils.CopyString(c.IP()),
+			UserAgent: utils.CopyString(c.Get(fiber.HeaderUserAgent)),
+			RequestID: utils.CopyString(requestID),
+			CreatedAt: time.Now().Format(time.RFC3339),
 		}
 
-		// Log activity
-		err := service.LogActivity(c.Context(), activityLogCommand)
-		if err != nil {
-			fmt.Printf("Error logging activity: %v\n", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to log activity",
-			})
+		events := recorder.Events()
+		if len(events) == 0 {
+			entry := base
+			entry.Event = monitoringactivities.EventRequest
+			service.Enqueue(&entry)
 		}
 
-		// Continue with the next middleware/handler
-		return c.Next()
+		// Dropped entries are counted in the queue stats
+		for _, event := range events {
+			entry := base
+			entry.Event = event.Name
+			entry.TargetType = event.TargetType
+			entry.TargetID = event.TargetID
+			entry.Before = event.Before
+			entry.After = event.After
+			service.Enqueue(&entry)
+		}
+
+		return err
 	}
 }
+
+// responseStatus returns the status the response will be sent with, errors
+// are only turned into a response by the error handler after the middleware
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+
+	var apiErr *model.ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+
+	return fiber.StatusInternalServerError
+}
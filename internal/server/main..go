@@ -1,14 +1,18 @@
 package server
 
 import (
+	"context"
 	"task/config"
 	"task/internal/db"
+	"task/internal/identity/monitoringactivities"
 	"task/internal/logger"
+	"time"
 
 	"task/internal/api/errors"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 type Server struct {
@@ -18,8 +22,14 @@ type Server struct {
 	cfg       *config.Config
 	log       *logger.Logger
 	jwtSecret string
+
+	// Set up with the routes, its queue is flushed on Stop
+	activities monitoringactivities.Service
 }
 
+// activityFlushTimeout bounds how long Stop waits for queued activities
+const activityFlushTimeout = 5 * time.Second
+
 func NewServer(cfg *config.Config) *Server {
 	app := fiber.New(fiber.Config{
 		ErrorHandler: errors.DefaultErrorHandler,
@@ -27,6 +37,9 @@ func NewServer(cfg *config.Config) *Server {
 
 	app.Use(cors.New())
 
+	// Reuses X-Request-ID when the client sends one, audit entries carry it
+	app.Use(requestid.New())
+
 	port := ":" + cfg.Port
 
 	// Initialize Database
@@ -49,7 +62,20 @@ func (s *Server) Start() error {
 	return s.app.Listen(s.port)
 }
 
+// Stop waits for the requests in flight, then writes the activities they
+// queued before the process exits
 func (s *Server) Stop() error {
+	err := s.app.Shutdown()
+
+	if s.activities != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), activityFlushTimeout)
+		defer cancel()
+
+		if flushErr := s.activities.Close(ctx); flushErr != nil && err == nil {
+			err = flushErr
+		}
+	}
+
 	s.log.Sync()
-	return s.app.Shutdown()
+	return err
 }
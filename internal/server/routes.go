@@ -5,10 +5,16 @@ import (
 	"errors"
 	"task/internal/api/response"
 	"task/internal/db"
+	"task/internal/identity/accesscontrol"
+	"task/internal/identity/accesstoken/accesstokenimpl"
 	"task/internal/identity/department/departmentimpl"
+	"task/internal/identity/invitation/invitationimpl"
 	"task/internal/identity/monitoringactivities/logsmonitoring/logsmonitoringimpl"
 	"task/internal/identity/monitoringactivities/monitoringactivitiesimpl"
+	"task/internal/identity/policy/policyimpl"
 	"task/internal/identity/protocol/rest"
+	"task/internal/identity/rbac/rbacimpl"
+	"task/internal/identity/sso/ssoimpl"
 	"task/internal/identity/task/taskimpl"
 	"task/internal/identity/user/userimpl"
 	"task/internal/middleware"
@@ -17,15 +23,20 @@ import (
 )
 
 var (
-	requireCreateUser = middleware.RequirePermission("create")
-	requireReadUser   = middleware.RequirePermission("read")
-	requireUpdateUser = middleware.RequirePermission("update")
-	requireDeleteUser = middleware.RequirePermission("delete")
+	reqOnlyBySuperuser = middleware.RequireRole(accesscontrol.RoleSuperUser)
 
-	reqOnlyBySuperuser      = middleware.RequireRole("superuser")
-	reqBothUserAndSuperuser = middleware.RequireRole("user", "superuser")
+	reqSession = middleware.RequireSession()
+
+	// Sensitive actions a superuser may not take while acting as someone else
+	reqNoImpersonation = middleware.RejectImpersonation()
 )
 
+// can declares the permission a route needs, personal access tokens must
+// also carry the matching scope
+func can(permission string) fiber.Handler {
+	return middleware.RequirePermission(permission)
+}
+
 func healthCheck(db db.DB) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		var result int
@@ -43,58 +54,156 @@ func (s *Server) SetupRoutes() {
 	api := s.app.Group("/api")
 	api.Get("/health", healthCheck(s.db))
 
-	// User Routes
-	user := userimpl.NewService(s.db, s.cfg)
-	userHttp := rest.NewUserHandler(user)
-
 	monitoringActivities := monitoringactivitiesimpl.NewService(s.db, s.cfg)
+	s.activities = monitoringActivities
 	logMonitoring := logsmonitoringimpl.NewService(s.db, s.cfg)
 	monitoringActivitiesHttp := rest.NewMonitoringActivitiesHandler(monitoringActivities, logMonitoring)
 
+	// Ownership and attribute based rules evaluated by the handlers
+	policy := policyimpl.NewService(s.db, s.cfg)
+
+	// Roles and permissions
+	access := rbacimpl.NewService(s.db, s.cfg)
+	accessHttp := rest.NewRBACHandler(access)
+
+	// Invitations, bulk imports of users go through them
+	invitation := invitationimpl.NewService(s.db, s.cfg)
+
+	// User Routes
+	user := userimpl.NewService(s.db, s.cfg, monitoringActivities, access, invitation)
+	userHttp := rest.NewUserHandler(user, policy)
+
 	api.Post("/users/register", userHttp.RegisterUser)
 	api.Post("/users/login", userHttp.LoginUser)
+	api.Get("/users/verify", userHttp.VerifyEmail)
+	api.Post("/users/verify/resend", userHttp.ResendVerification)
+	api.Post("/users/login/mfa", userHttp.VerifyMFA)
+	api.Post("/users/login/mfa/enroll", userHttp.EnrollMFA)
+	api.Post("/users/login/mfa/enroll/confirm", userHttp.ConfirmMFA)
+
+	// Single sign-on
+	sso := ssoimpl.NewService(s.db, s.cfg, user)
+	ssoHttp := rest.NewSSOHandler(sso)
+
+	api.Get("/auth/oidc/:provider/login", ssoHttp.Login)
+	api.Get("/auth/oidc/:provider/callback", ssoHttp.Callback)
+
+	// Personal access tokens
+	accessToken := accesstokenimpl.NewService(s.db, s.cfg)
+	accessTokenHttp := rest.NewAccessTokenHandler(accessToken)
+
+	// Invitations
+	invitationHttp := rest.NewInvitationHandler(invitation)
 
-	api.Use(middleware.JWTProtected(s.jwtSecret, user))
+	api.Post("/invitations/accept", invitationHttp.AcceptInvitation)
+
+	api.Use(middleware.JWTProtected(s.jwtSecret, user, accessToken, access))
 	api.Use(middleware.NewActivityLoggingMiddleware(monitoringActivities))
 
-	api.Post("/users", reqOnlyBySuperuser, requireCreateUser, userHttp.CreateUser)
-	api.Get("/users", reqBothUserAndSuperuser, requireReadUser, userHttp.SearchUser)
-	api.Get("/users/:id", reqBothUserAndSuperuser, requireReadUser, userHttp.GetUserByID)
-	api.Put("/users/:id", reqBothUserAndSuperuser, requireUpdateUser, userHttp.UpdateUser)
-	api.Delete("/users/:id", reqOnlyBySuperuser, requireDeleteUser, userHttp.DeleteUser)
+	api.Get("/users", can(accesscontrol.PermUsersRead), userHttp.SearchUser)
+	api.Post("/users/import", reqOnlyBySuperuser, can(accesscontrol.PermUsersCreate), reqNoImpersonation, userHttp.ImportUsers)
+	api.Get("/users/export", can(accesscontrol.PermUsersRead), userHttp.ExportUsers)
+	api.Get("/users/:id", can(accesscontrol.PermUsersRead), userHttp.GetUserByID)
+	api.Get("/users/:id/avatar", can(accesscontrol.PermUsersRead), userHttp.GetAvatar)
+	api.Put("/users/:id", can(accesscontrol.PermUsersUpdate), userHttp.UpdateUser)
+	api.Patch("/users/:id", can(accesscontrol.PermUsersUpdate), userHttp.PatchUser)
+	api.Delete("/users/:id", can(accesscontrol.PermUsersDelete), userHttp.DeleteUser)
+	api.Post("/users/:id/unlock", can(accesscontrol.PermUsersUnlock), userHttp.UnlockUser)
+	api.Get("/users/:id/reports", can(accesscontrol.PermUsersRead), userHttp.GetReports)
+	api.Post("/users/:id/deactivate", can(accesscontrol.PermUsersDeactivate), reqNoImpersonation, userHttp.DeactivateUser)
+	api.Post("/users/:id/reactivate", can(accesscontrol.PermUsersDeactivate), reqNoImpersonation, userHttp.ReactivateUser)
+
+	// Profile of the logged in user
+	api.Get("/me", can(accesscontrol.PermUsersRead), userHttp.GetProfile)
+	api.Patch("/me", can(accesscontrol.PermUsersUpdate), userHttp.UpdateProfile)
+	api.Get("/me/department", can(accesscontrol.PermDepartmentsRead), userHttp.GetProfileDepartment)
+	api.Put("/me/avatar", can(accesscontrol.PermUsersUpdate), userHttp.UploadAvatar)
+	api.Delete("/me/avatar", can(accesscontrol.PermUsersUpdate), userHttp.DeleteAvatar)
+
+	// Two-factor authentication for the logged in user
+	api.Post("/me/mfa/enroll", reqSession, reqNoImpersonation, userHttp.EnrollMFA)
+	api.Post("/me/mfa/confirm", reqSession, reqNoImpersonation, userHttp.ConfirmMFA)
+	api.Post("/me/mfa/recovery-codes", reqSession, reqNoImpersonation, userHttp.RegenerateRecoveryCodes)
+	api.Delete("/me/mfa", reqSession, reqNoImpersonation, userHttp.DisableMFA)
+
+	api.Get("/me/tokens", reqSession, accessTokenHttp.ListTokens)
+	api.Post("/me/tokens", reqSession, reqNoImpersonation, accessTokenHttp.CreateToken)
+	api.Delete("/me/tokens/:id", reqSession, reqNoImpersonation, accessTokenHttp.RevokeToken)
+
+	// Effective capabilities of the caller
+	api.Get("/me/permissions", accessHttp.MyPermissions)
+
+	api.Get("/roles", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.ListRoles)
+	api.Post("/roles", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.CreateRole)
+	api.Get("/roles/:id", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.GetRoleByID)
+	api.Put("/roles/:id", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.UpdateRole)
+	api.Delete("/roles/:id", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.DeleteRole)
+	api.Put("/roles/:id/permissions", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.SetRolePermissions)
+
+	api.Get("/permissions", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.ListPermissions)
+	api.Post("/permissions", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.CreatePermission)
+	api.Delete("/permissions/:id", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.DeletePermission)
+
+	api.Get("/users/:id/roles", reqOnlyBySuperuser, can(accesscontrol.PermUsersRead), accessHttp.GetUserRoles)
+	api.Put("/users/:id/roles", reqOnlyBySuperuser, reqSession, reqNoImpersonation, accessHttp.SetUserRoles)
+
+	// New users are invited and choose their own password
+	api.Post("/invitations", reqOnlyBySuperuser, can(accesscontrol.PermUsersCreate), reqNoImpersonation, invitationHttp.InviteUser)
+	api.Get("/invitations", reqOnlyBySuperuser, can(accesscontrol.PermUsersCreate), invitationHttp.SearchInvitations)
+	api.Post("/invitations/:id/resend", reqOnlyBySuperuser, can(accesscontrol.PermUsersCreate), reqNoImpersonation, invitationHttp.ResendInvitation)
+	api.Delete("/invitations/:id", reqOnlyBySuperuser, can(accesscontrol.PermUsersCreate), reqNoImpersonation, invitationHttp.RevokeInvitation)
+
+	// Support engineers act as a user to reproduce what they see
+	api.Post("/admin/impersonate/:userID", reqOnlyBySuperuser, reqSession, reqNoImpersonation, userHttp.Impersonate)
 
 	// Logout
-	api.Post("/users/logout", reqBothUserAndSuperuser, userHttp.LogoutUser)
+	api.Post("/users/logout", reqSession, userHttp.LogoutUser)
 
 	// Monitoring activities and logs Routes
-	api.Get("/monitoring-activities/logs", reqBothUserAndSuperuser, requireReadUser, monitoringActivitiesHttp.MonitoringLogs)
-	api.Get("/monitoring-activities", reqOnlyBySuperuser, requireReadUser, monitoringActivitiesHttp.GetMonitoringActivities)
+	api.Get("/monitoring-activities/logs", can(accesscontrol.PermActivityRead), monitoringActivitiesHttp.MonitoringLogs)
+	api.Get("/monitoring-activities", can(accesscontrol.PermActivityRead), monitoringActivitiesHttp.GetMonitoringActivities)
+	api.Get("/monitoring-activities/queue", can(accesscontrol.PermActivityRead), monitoringActivitiesHttp.QueueStats)
+	api.Get("/monitoring-activities/verify", can(accesscontrol.PermActivityRead), monitoringActivitiesHttp.VerifyChain)
 
 	// Department Routes
 	department := departmentimpl.NewService(s.db, s.cfg)
 	departmentHttp := rest.NewDepartmentHandler(department)
 
-	api.Post("/departments", reqOnlyBySuperuser, requireCreateUser, departmentHttp.CreateDepartment)
-	api.Get("/departments", reqBothUserAndSuperuser, requireReadUser, departmentHttp.SearchDepartment)
-	api.Get("/departments/:id", reqBothUserAndSuperuser, requireReadUser, departmentHttp.GetDepartmentByID)
-	api.Put("/departments/:id", reqOnlyBySuperuser, requireUpdateUser, departmentHttp.UpdateDepartment)
-	api.Delete("/departments/:id", reqOnlyBySuperuser, requireDeleteUser, departmentHttp.DeleteDepartment)
+	api.Post("/departments", can(accesscontrol.PermDepartmentsCreate), departmentHttp.CreateDepartment)
+	api.Get("/departments", can(accesscontrol.PermDepartmentsRead), departmentHttp.SearchDepartment)
+	api.Get("/departments/tree", can(accesscontrol.PermDepartmentsRead), departmentHttp.GetDepartmentTree)
+	api.Get("/departments/:id", can(accesscontrol.PermDepartmentsRead), departmentHttp.GetDepartmentByID)
+	api.Put("/departments/:id", can(accesscontrol.PermDepartmentsUpdate), departmentHttp.UpdateDepartment)
+	api.Patch("/departments/:id", can(accesscontrol.PermDepartmentsUpdate), departmentHttp.PatchDepartment)
+	api.Delete("/departments/:id", can(accesscontrol.PermDepartmentsDelete), departmentHttp.DeleteDepartment)
+	api.Get("/departments/:id/members", can(accesscontrol.PermDepartmentsRead), departmentHttp.GetDepartmentMembers)
+	api.Post("/departments/:id/members", can(accesscontrol.PermDepartmentsAssign), departmentHttp.AssignUsersToDepartment)
+
+	// Heads and reporting lines are part of the organisation, like department membership
+	api.Put("/departments/:id/head", can(accesscontrol.PermDepartmentsAssign), departmentHttp.SetDepartmentHead)
+	api.Put("/users/:id/manager", can(accesscontrol.PermDepartmentsAssign), userHttp.SetManager)
 
-	api.Post("/users/assigned/departments", reqOnlyBySuperuser, requireUpdateUser, departmentHttp.AssignUserToDepartment)
-	api.Get("/users/assigned/:id/departments", reqBothUserAndSuperuser, requireReadUser, departmentHttp.GetUsersByDepartment)
-	api.Delete("/users/assigned/:id/departments", reqOnlyBySuperuser, requireUpdateUser, departmentHttp.RemoveUserFromDepartment)
-	api.Get("users/assigned/departments", reqBothUserAndSuperuser, requireReadUser, departmentHttp.SearchAllUsersByDepartment)
+	api.Post("/users/assigned/departments", can(accesscontrol.PermDepartmentsAssign), departmentHttp.AssignUserToDepartment)
+	api.Get("/users/assigned/:id/departments", can(accesscontrol.PermDepartmentsRead), departmentHttp.GetUsersByDepartment)
+	api.Delete("/users/assigned/:id/departments", can(accesscontrol.PermDepartmentsAssign), departmentHttp.RemoveUserFromDepartment)
+	api.Get("users/assigned/departments", can(accesscontrol.PermDepartmentsRead), departmentHttp.SearchAllUsersByDepartment)
+
+	// Registered after the assigned routes so "assigned" is not taken for an id
+	api.Get("/users/:id/departments", can(accesscontrol.PermDepartmentsRead), departmentHttp.GetUserMemberships)
 
 	// Task Routes
 	task := taskimpl.NewService(s.db, s.cfg)
-	taskHttp := rest.NewTaskHandler(task)
+	taskHttp := rest.NewTaskHandler(task, policy)
+
+	api.Post("/tasks", can(accesscontrol.PermTasksCreate), taskHttp.CreateTask)
+	api.Get("/tasks", can(accesscontrol.PermTasksRead), taskHttp.SearchTask)
+	api.Get("/tasks/:id", can(accesscontrol.PermTasksRead), taskHttp.GetTaskByID)
+	api.Put("/tasks/:id", can(accesscontrol.PermTasksUpdate), taskHttp.UpdateTask)
+	api.Patch("/tasks/:id", can(accesscontrol.PermTasksUpdate), taskHttp.PatchTask)
+	api.Delete("/tasks/:id", can(accesscontrol.PermTasksDelete), taskHttp.DeleteTask)
 
-	api.Post("/tasks", reqOnlyBySuperuser, requireCreateUser, taskHttp.CreateTask)
-	api.Get("/tasks", reqBothUserAndSuperuser, requireReadUser, taskHttp.SearchTask)
-	api.Get("/tasks/:id", reqBothUserAndSuperuser, requireReadUser, taskHttp.GetTaskByID)
-	api.Put("/tasks/:id", reqBothUserAndSuperuser, requireUpdateUser, taskHttp.UpdateTask)
-	api.Delete("/tasks/:id", reqOnlyBySuperuser, requireDeleteUser, taskHttp.DeleteTask)
+	api.Post("/tasks/:id/submit", can(accesscontrol.PermTasksSubmit), taskHttp.SubmitTask)
+	api.Post("/tasks/:id/approved", can(accesscontrol.PermTasksApprove), taskHttp.ApprovedTask)
 
-	api.Post("/tasks/:id/submit", reqBothUserAndSuperuser, requireUpdateUser, taskHttp.SubmitTask)
-	api.Post("/tasks/:id/approved", reqOnlyBySuperuser, requireUpdateUser, taskHttp.ApprovedTask)
+	api.Get("/departments/:id/dashboard", can(accesscontrol.PermDepartmentsRead), can(accesscontrol.PermTasksRead), taskHttp.GetDepartmentDashboard)
 }
@@ -0,0 +1,7 @@
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Accounts that existed before email verification are treated as verified
+UPDATE users
+SET email_verified_at = created_at
+WHERE email_verified_at IS NULL;
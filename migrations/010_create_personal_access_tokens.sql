@@ -0,0 +1,18 @@
+CREATE TABLE personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 of the token, the token itself is never stored
+    token_prefix VARCHAR(16) NOT NULL, -- First characters of the token to tell tokens apart
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Names only need to be unique among a user's active tokens
+CREATE UNIQUE INDEX personal_access_tokens_user_name_idx
+ON personal_access_tokens(user_id, name)
+WHERE revoked_at IS NULL;
@@ -0,0 +1,48 @@
+CREATE TABLE permissions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    description VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE role_permissions (
+    id SERIAL PRIMARY KEY,
+    role_id INT NOT NULL,
+    permission_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE,
+    UNIQUE(role_id, permission_id)
+);
+
+-- Seed the roles and permissions that used to be hard-coded in accesscontrol
+INSERT INTO roles (name, description) VALUES
+    ('superuser', 'Full access'),
+    ('admin', 'Administrator'),
+    ('hr', 'Human resources'),
+    ('manager', 'Department manager'),
+    ('user', 'Regular user')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('create', 'Create resources'),
+    ('read', 'Read resources'),
+    ('update', 'Update resources'),
+    ('delete', 'Delete resources')
+ON CONFLICT (name) DO NOTHING;
+
+-- A role used to need a permission in both the user and the task map
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON (r.name, p.name) IN (
+    ('superuser', 'create'), ('superuser', 'read'), ('superuser', 'update'), ('superuser', 'delete'),
+    ('admin', 'create'), ('admin', 'read'), ('admin', 'update'),
+    ('hr', 'read'),
+    ('manager', 'read'), ('manager', 'update'),
+    ('user', 'read'), ('user', 'update')
+)
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+
+-- users.role stays the primary role of a user, user_roles holds any additional roles
@@ -0,0 +1,60 @@
+-- Permissions are now scoped to a resource, e.g. tasks:approve, instead of a
+-- bare verb that was checked against users and tasks at the same time
+INSERT INTO permissions (name, description) VALUES
+    ('users:create', 'Create users'),
+    ('users:read', 'Read users'),
+    ('users:update', 'Update users'),
+    ('users:delete', 'Delete users'),
+    ('users:unlock', 'Unlock locked out users'),
+    ('departments:create', 'Create departments'),
+    ('departments:read', 'Read departments'),
+    ('departments:update', 'Update departments'),
+    ('departments:delete', 'Delete departments'),
+    ('departments:assign', 'Assign users to departments'),
+    ('tasks:create', 'Create tasks'),
+    ('tasks:read', 'Read tasks'),
+    ('tasks:update', 'Update tasks'),
+    ('tasks:delete', 'Delete tasks'),
+    ('tasks:submit', 'Submit tasks for approval'),
+    ('tasks:approve', 'Approve submitted tasks'),
+    ('activity:read', 'Read activity logs')
+ON CONFLICT (name) DO NOTHING;
+
+-- User and department rights follow the old user permission map, task rights
+-- follow the old task permission map. Activity logs stay with superusers, the
+-- other roles get them per endpoint in 013.
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON (r.name, p.name) IN (
+    ('superuser', 'users:create'), ('superuser', 'users:read'), ('superuser', 'users:update'),
+    ('superuser', 'users:delete'), ('superuser', 'users:unlock'),
+    ('superuser', 'departments:create'), ('superuser', 'departments:read'), ('superuser', 'departments:update'),
+    ('superuser', 'departments:delete'), ('superuser', 'departments:assign'),
+    ('superuser', 'tasks:create'), ('superuser', 'tasks:read'), ('superuser', 'tasks:update'),
+    ('superuser', 'tasks:delete'), ('superuser', 'tasks:submit'), ('superuser', 'tasks:approve'),
+    ('superuser', 'activity:read'),
+
+    ('admin', 'users:create'), ('admin', 'users:read'), ('admin', 'users:update'), ('admin', 'users:unlock'),
+    ('admin', 'departments:create'), ('admin', 'departments:read'), ('admin', 'departments:update'),
+    ('admin', 'departments:assign'),
+    ('admin', 'tasks:create'), ('admin', 'tasks:read'), ('admin', 'tasks:update'), ('admin', 'tasks:delete'),
+    ('admin', 'tasks:submit'), ('admin', 'tasks:approve'),
+
+    ('hr', 'users:create'), ('hr', 'users:read'),
+    ('hr', 'departments:read'),
+    ('hr', 'tasks:read'), ('hr', 'tasks:update'),
+
+    ('manager', 'users:read'), ('manager', 'users:update'),
+    ('manager', 'departments:read'), ('manager', 'departments:assign'),
+    ('manager', 'tasks:create'), ('manager', 'tasks:read'), ('manager', 'tasks:update'),
+    ('manager', 'tasks:submit'), ('manager', 'tasks:approve'),
+
+    ('user', 'users:read'), ('user', 'users:update'),
+    ('user', 'departments:read'),
+    ('user', 'tasks:read'), ('user', 'tasks:update'), ('user', 'tasks:submit')
+)
+ON CONFLICT (role_id, permission_id) DO NOTHING;
+
+-- The bare verbs are no longer checked by any route
+DELETE FROM permissions WHERE name IN ('create', 'read', 'update', 'delete');
@@ -0,0 +1,36 @@
+-- Routes no longer gate on the user and superuser roles, each role is granted
+-- what it needs per endpoint instead:
+--   admin    manages users, departments and tasks, but cannot delete users
+--   hr       manages users and departments
+--   manager  creates and approves tasks for their department
+--   user     works on their own profile and tasks
+DELETE FROM role_permissions
+WHERE role_id IN (SELECT id FROM roles WHERE name IN ('admin', 'hr', 'manager', 'user'));
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON (r.name, p.name) IN (
+    ('admin', 'users:create'), ('admin', 'users:read'), ('admin', 'users:update'), ('admin', 'users:unlock'),
+    ('admin', 'departments:create'), ('admin', 'departments:read'), ('admin', 'departments:update'),
+    ('admin', 'departments:delete'), ('admin', 'departments:assign'),
+    ('admin', 'tasks:create'), ('admin', 'tasks:read'), ('admin', 'tasks:update'), ('admin', 'tasks:delete'),
+    ('admin', 'tasks:submit'), ('admin', 'tasks:approve'),
+    ('admin', 'activity:read'),
+
+    ('hr', 'users:create'), ('hr', 'users:read'), ('hr', 'users:update'), ('hr', 'users:unlock'),
+    ('hr', 'departments:create'), ('hr', 'departments:read'), ('hr', 'departments:update'),
+    ('hr', 'departments:assign'),
+    ('hr', 'tasks:read'), ('hr', 'tasks:submit'),
+    ('hr', 'activity:read'),
+
+    ('manager', 'users:read'), ('manager', 'users:update'),
+    ('manager', 'departments:read'),
+    ('manager', 'tasks:create'), ('manager', 'tasks:read'), ('manager', 'tasks:update'),
+    ('manager', 'tasks:submit'), ('manager', 'tasks:approve'),
+
+    ('user', 'users:read'), ('user', 'users:update'),
+    ('user', 'departments:read'),
+    ('user', 'tasks:read'), ('user', 'tasks:update'), ('user', 'tasks:submit')
+)
+ON CONFLICT (role_id, permission_id) DO NOTHING;
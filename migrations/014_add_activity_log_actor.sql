@@ -0,0 +1,5 @@
+-- The superuser acting on behalf of user_id while impersonating them
+ALTER TABLE activity_logs
+ADD COLUMN actor_id VARCHAR(255);
+
+CREATE INDEX idx_activity_logs_actor_id ON activity_logs(actor_id) WHERE actor_id IS NOT NULL;
@@ -0,0 +1,9 @@
+-- Incremented on every update, exposed as the ETag for optimistic concurrency
+ALTER TABLE users
+ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE tasks
+ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE departments
+ADD COLUMN version INT NOT NULL DEFAULT 1;
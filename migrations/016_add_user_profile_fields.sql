@@ -0,0 +1,6 @@
+ALTER TABLE users
+ADD COLUMN job_title VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+ADD COLUMN locale VARCHAR(16) NOT NULL DEFAULT 'en-US',
+ADD COLUMN avatar_key VARCHAR(255), -- Storage key of the resized avatar, NULL when none was uploaded
+ADD COLUMN avatar_updated_at TIMESTAMP;
@@ -0,0 +1,23 @@
+-- Invited users are created with status 4 (pending) and an empty password
+-- until they accept the invitation.
+CREATE TABLE user_invitations (
+    id SERIAL PRIMARY KEY,
+    user_id INT, -- The pending user, cleared when a revoked invitee is removed
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    department_id INT,
+    invited_by VARCHAR(255) NOT NULL, -- Email of the superuser who sent it
+    nonce VARCHAR(64) NOT NULL, -- Rotated on resend so older links stop working
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, accepted or revoked
+    expires_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    accepted_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (department_id) REFERENCES departments(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_user_invitations_email ON user_invitations(email);
+CREATE UNIQUE INDEX idx_user_invitations_pending_email ON user_invitations(email) WHERE status = 'pending';
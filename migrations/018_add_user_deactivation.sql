@@ -0,0 +1,21 @@
+ALTER TABLE users
+ADD COLUMN deactivated_at TIMESTAMP, -- Set while an administrator has deactivated the account
+ADD COLUMN sessions_revoked_at TIMESTAMP; -- Session tokens issued before this are rejected
+
+-- Open tasks are looked up by assignee when reassigning them
+CREATE INDEX idx_tasks_user_id_status ON tasks(user_id, status);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:deactivate', 'Deactivate and reactivate users')
+ON CONFLICT (name) DO NOTHING;
+
+-- HR offboards leavers, admins and superusers can do everything HR can
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON (r.name, p.name) IN (
+    ('superuser', 'users:deactivate'),
+    ('admin', 'users:deactivate'),
+    ('hr', 'users:deactivate')
+)
+ON CONFLICT (role_id, permission_id) DO NOTHING;
@@ -0,0 +1,7 @@
+-- Departments form a tree, NULL marks a top level department. Cycles are
+-- prevented by the service, deleting a parent is refused while it has children.
+ALTER TABLE departments
+ADD COLUMN parent_id INT REFERENCES departments(id) ON DELETE RESTRICT,
+ADD CONSTRAINT departments_parent_not_self CHECK (parent_id <> id);
+
+CREATE INDEX idx_departments_parent_id ON departments(parent_id);
@@ -0,0 +1,20 @@
+-- The user leading a department and the user each user reports to
+ALTER TABLE departments
+ADD COLUMN head_id INT REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE users
+ADD COLUMN manager_id INT REFERENCES users(id) ON DELETE SET NULL,
+ADD CONSTRAINT users_manager_not_self CHECK (manager_id <> id);
+
+CREATE INDEX idx_users_manager_id ON users(manager_id);
+
+-- Department heads approve the tasks of their department whatever their role,
+-- the policy rules still limit users and HR to the departments they lead
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+JOIN permissions p ON (r.name, p.name) IN (
+    ('hr', 'tasks:approve'),
+    ('user', 'tasks:approve')
+)
+ON CONFLICT (role_id, permission_id) DO NOTHING;
@@ -0,0 +1,31 @@
+-- A user can belong to several departments. Each row is one membership
+-- period, leaving sets left_at and joining again or changing role starts a
+-- new row, so past rows are the membership history.
+CREATE TABLE department_members (
+    id SERIAL PRIMARY KEY,
+    department_id INT NOT NULL,
+    user_id INT NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'member', -- member or lead
+    joined_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    left_at TIMESTAMP, -- NULL while the membership is current
+    FOREIGN KEY (department_id) REFERENCES departments(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT department_members_role_check CHECK (role IN ('member', 'lead')),
+    CONSTRAINT department_members_period_check CHECK (left_at IS NULL OR left_at >= joined_at)
+);
+
+-- Only one current membership per user and department
+CREATE UNIQUE INDEX idx_department_members_current
+ON department_members(department_id, user_id)
+WHERE left_at IS NULL;
+
+CREATE INDEX idx_department_members_user_id ON department_members(user_id);
+
+-- Carry over the single department users had so far
+INSERT INTO department_members (department_id, user_id, joined_at)
+SELECT department_id, id, COALESCE(updated_at, created_at, NOW())
+FROM users
+WHERE department_id IS NOT NULL;
+
+ALTER TABLE users
+DROP COLUMN department_id;
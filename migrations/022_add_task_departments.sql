@@ -0,0 +1,37 @@
+-- Priority and difficulty are read and written by the task service but were
+-- left commented out in 005, add them where they are still missing
+ALTER TABLE tasks
+ADD COLUMN IF NOT EXISTS priority VARCHAR(10) NOT NULL DEFAULT 'medium',
+ADD COLUMN IF NOT EXISTS difficulty VARCHAR(10) NOT NULL DEFAULT 'medium';
+
+-- Department the task belongs to, due date for overdue tracking and the
+-- moment it was approved for throughput
+ALTER TABLE tasks
+ADD COLUMN department_id INT,
+ADD COLUMN due_at TIMESTAMPTZ,
+ADD COLUMN completed_at TIMESTAMPTZ,
+ADD CONSTRAINT fk_task_department
+    FOREIGN KEY (department_id)
+    REFERENCES departments(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_tasks_department_status ON tasks(department_id, status);
+CREATE INDEX idx_tasks_department_completed_at ON tasks(department_id, completed_at);
+
+-- Existing tasks go to the main department of their assignee, the one they
+-- lead first, then the oldest membership
+UPDATE tasks t
+SET department_id = (
+    SELECT m.department_id
+    FROM department_members m
+    WHERE
+        m.user_id = t.user_id AND
+        m.left_at IS NULL
+    ORDER BY m.role = 'lead' DESC, m.joined_at, m.id
+    LIMIT 1
+);
+
+-- Approval time is unknown for tasks done so far, their last update is the
+-- closest we have
+UPDATE tasks
+SET completed_at = updated_at
+WHERE status = 3;
@@ -0,0 +1,19 @@
+-- Semantic audit events recorded once the request is handled, activity,
+-- action and resource keep the method, path and URL of the request
+ALTER TABLE activity_logs
+ADD COLUMN event VARCHAR(100) NOT NULL DEFAULT 'api.request',
+ADD COLUMN target_type VARCHAR(50),
+ADD COLUMN target_id VARCHAR(100),
+ADD COLUMN before JSONB,
+ADD COLUMN after JSONB,
+ADD COLUMN status INT,
+ADD COLUMN ip VARCHAR(64),
+ADD COLUMN user_agent TEXT,
+ADD COLUMN request_id VARCHAR(100);
+
+ALTER TABLE activity_logs
+ALTER COLUMN resource TYPE TEXT;
+
+CREATE INDEX idx_activity_logs_event ON activity_logs(event);
+CREATE INDEX idx_activity_logs_target ON activity_logs(target_type, target_id) WHERE target_type IS NOT NULL;
+CREATE INDEX idx_activity_logs_request_id ON activity_logs(request_id) WHERE request_id IS NOT NULL;
@@ -0,0 +1,122 @@
+-- Hash chain over activity_logs, every entry stores the hash of the previous
+-- entry and its own hash over prev_hash and its content. Editing or deleting
+-- an entry breaks the link to the next one.
+ALTER TABLE activity_logs
+ADD COLUMN seq BIGINT,
+ADD COLUMN prev_hash TEXT,
+ADD COLUMN hash TEXT;
+
+-- Content covered by the hash of an entry, the verifier hashes the same text
+CREATE FUNCTION activity_log_payload(a activity_logs) RETURNS TEXT AS $$
+    SELECT jsonb_build_array(
+        a.seq,
+        a.id,
+        a.user_id,
+        a.actor_id,
+        a.activity,
+        a."action",
+        a.resource,
+        a.details,
+        a.event,
+        a.target_type,
+        a.target_id,
+        a.before,
+        a.after,
+        a.status,
+        a.ip,
+        a.user_agent,
+        a.request_id,
+        a.created_at
+    )::text
+$$ LANGUAGE SQL STABLE;
+
+-- Chain the existing entries in insertion order, the first one links to 64 zeros
+DO $$
+DECLARE
+    r activity_logs%ROWTYPE;
+    n BIGINT := 0;
+    prev TEXT := repeat('0', 64);
+BEGIN
+    FOR r IN SELECT * FROM activity_logs ORDER BY id LOOP
+        n := n + 1;
+        r.seq := n;
+        r.prev_hash := prev;
+        r.hash := encode(sha256(convert_to(prev || activity_log_payload(r), 'UTF8')), 'hex');
+
+        UPDATE activity_logs SET seq = r.seq, prev_hash = r.prev_hash, hash = r.hash WHERE id = r.id;
+
+        prev := r.hash;
+    END LOOP;
+END $$;
+
+ALTER TABLE activity_logs
+ALTER COLUMN seq SET NOT NULL,
+ALTER COLUMN prev_hash SET NOT NULL,
+ALTER COLUMN hash SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_activity_logs_seq ON activity_logs(seq);
+
+-- Links every new entry to the last one. The advisory lock serializes the
+-- writers so two transactions never link to the same entry, seq is used for
+-- the order because ids are handed out before the lock is taken.
+CREATE FUNCTION activity_logs_chain() RETURNS TRIGGER AS $$
+DECLARE
+    last_seq BIGINT;
+    last_hash TEXT;
+BEGIN
+    PERFORM pg_advisory_xact_lock(4202);
+
+    SELECT seq, hash INTO last_seq, last_hash
+    FROM activity_logs
+    ORDER BY seq DESC
+    LIMIT 1;
+
+    NEW.seq := COALESCE(last_seq, 0) + 1;
+    NEW.prev_hash := COALESCE(last_hash, repeat('0', 64));
+    NEW.hash := encode(sha256(convert_to(NEW.prev_hash || activity_log_payload(NEW), 'UTF8')), 'hex');
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER activity_logs_chain
+BEFORE INSERT ON activity_logs
+FOR EACH ROW EXECUTE FUNCTION activity_logs_chain();
+
+-- Signed seq and hash of the last entry, taken periodically so a chain
+-- rewritten from scratch or cut at the end does not match them anymore
+CREATE TABLE activity_log_checkpoints (
+    id SERIAL PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    hash TEXT NOT NULL,
+    signature TEXT NOT NULL, -- Base64 ed25519 signature
+    key_id VARCHAR(16) NOT NULL, -- Identifies the key that signed it
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_activity_log_checkpoints_seq ON activity_log_checkpoints(seq);
+
+-- Both tables are append-only for the application, only the owner can drop
+-- the triggers
+CREATE FUNCTION reject_append_only_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME
+        USING ERRCODE = 'insufficient_privilege';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER activity_logs_append_only
+BEFORE UPDATE OR DELETE ON activity_logs
+FOR EACH ROW EXECUTE FUNCTION reject_append_only_change();
+
+CREATE TRIGGER activity_logs_no_truncate
+BEFORE TRUNCATE ON activity_logs
+FOR EACH STATEMENT EXECUTE FUNCTION reject_append_only_change();
+
+CREATE TRIGGER activity_log_checkpoints_append_only
+BEFORE UPDATE OR DELETE ON activity_log_checkpoints
+FOR EACH ROW EXECUTE FUNCTION reject_append_only_change();
+
+CREATE TRIGGER activity_log_checkpoints_no_truncate
+BEFORE TRUNCATE ON activity_log_checkpoints
+FOR EACH STATEMENT EXECUTE FUNCTION reject_append_only_change();
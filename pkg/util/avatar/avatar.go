@@ -0,0 +1,57 @@
+// Package avatar turns uploaded pictures into square JPEG avatars.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	// Formats accepted for uploads
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	Size        = 256              // Width and height of stored avatars
+	ContentType = "image/jpeg"     // Format of stored avatars
+	MaxPixels   = 40 * 1000 * 1000 // Larger uploads are refused before decoding
+)
+
+var ErrUnsupportedImage = errors.New("unsupported or invalid image")
+
+// Resize decodes a JPEG, PNG or GIF image, crops it to a centered square and
+// scales it to Size x Size.
+func Resize(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrUnsupportedImage
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Point{
+		X: bounds.Min.X + (bounds.Dx()-side)/2,
+		Y: bounds.Min.Y + (bounds.Dy()-side)/2,
+	})
+
+	// JPEG has no alpha channel, transparent pixels end up white
+	dst := image.NewRGBA(image.Rect(0, 0, Size, Size))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
@@ -1,15 +1,28 @@
 package jwt
 
 import (
+	"errors"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Purposes for short-lived action tokens. Action tokens carry their purpose as
+// the audience so they can never be used as session tokens.
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposeMFAChallenge      = "mfa_challenge"
+	PurposeMFAEnrollment     = "mfa_enrollment"
+	PurposeInvitation        = "invitation"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID  string `json:"user_id"`
+	Role    string `json:"role"`
+	ActorID string `json:"actor_id,omitempty"` // Set when a superuser acts as UserID
 	jwt.RegisteredClaims
 }
 
@@ -27,6 +40,27 @@ func GenerateToken(userID string, role string) (string, error) {
 	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
 }
 
+// GenerateImpersonationToken signs a session token for userID that also
+// carries the actor who is impersonating them.
+func GenerateImpersonationToken(userID, role, actorID string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+
+	claims := &Claims{
+		UserID:  userID,
+		Role:    role,
+		ActorID: actorID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+
+	return signed, expiresAt, err
+}
+
 func ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(os.Getenv("JWT_SECRET")), nil
@@ -36,9 +70,47 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
-	} else {
-		return nil, err
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	// Action tokens are scoped to an audience and must not open a session
+	if len(claims.Audience) > 0 {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// GenerateActionToken signs a token for subject that is only accepted by
+// ValidateActionToken with the same purpose.
+func GenerateActionToken(subject, purpose string, ttl time.Duration) (string, error) {
+	claims := &jwt.RegisteredClaims{
+		Subject:   subject,
+		Audience:  jwt.ClaimStrings{purpose},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+// ValidateActionToken checks the signature, expiry and purpose of an action
+// token and returns its subject.
+func ValidateActionToken(tokenString, purpose string) (string, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	}, jwt.WithAudience(purpose))
+	if err != nil {
+		return "", err
+	}
+
+	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	if !ok || !token.Valid || claims.Subject == "" {
+		return "", ErrInvalidToken
 	}
+
+	return claims.Subject, nil
 }
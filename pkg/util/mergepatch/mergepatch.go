@@ -0,0 +1,50 @@
+// Package mergepatch applies JSON Merge Patch documents as described in RFC 7396.
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidPatch = errors.New("patch must be a JSON object")
+
+// Apply merges patch into the JSON object doc. Members set to null in the
+// patch are removed, objects are merged recursively and any other value
+// replaces the original.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var target map[string]interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	var changes map[string]interface{}
+	if err := json.Unmarshal(patch, &changes); err != nil || changes == nil {
+		return nil, ErrInvalidPatch
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target, patch map[string]interface{}) map[string]interface{} {
+	if target == nil {
+		target = make(map[string]interface{})
+	}
+
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			target[key] = value
+			continue
+		}
+
+		current, _ := target[key].(map[string]interface{})
+		target[key] = merge(current, nested)
+	}
+
+	return target
+}
@@ -0,0 +1,87 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	// RFC 7396 appendix A, the cases whose target is an object
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replace member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"remove member", `{"a":"b"}`, `{"a":null}`, `{}`},
+		{"remove one of two", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"array replaces object", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"value replaces array", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{"nested merge", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{"arrays are not merged", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{"nested object created", `{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{"null removes nested", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{"empty patch", `{"a":"b"}`, `{}`, `{"a":"b"}`},
+		{"object replaces scalar", `{"a":"b"}`, `{"a":{"c":"d"}}`, `{"a":{"c":"d"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+
+			assertJSONEqual(t, got, []byte(tt.want))
+		})
+	}
+}
+
+func TestApplyInvalidPatch(t *testing.T) {
+	// Patches that are not objects would replace the whole document, which
+	// never makes sense for an update command
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"array", `["a"]`},
+		{"string", `"a"`},
+		{"number", `1`},
+		{"null", `null`},
+		{"malformed", `{"a":`},
+		{"empty", ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Apply([]byte(`{"a":"b"}`), []byte(tt.patch)); err != ErrInvalidPatch {
+				t.Fatalf("Apply() error = %v, want ErrInvalidPatch", err)
+			}
+		})
+	}
+}
+
+func TestApplyInvalidDocument(t *testing.T) {
+	if _, err := Apply([]byte(`{"a":`), []byte(`{"a":"b"}`)); err == nil {
+		t.Fatal("expected an error for a malformed document")
+	}
+}
+
+func assertJSONEqual(t *testing.T, got, want []byte) {
+	t.Helper()
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid result %s: %v", got, err)
+	}
+	if err := json.Unmarshal(want, &w); err != nil {
+		t.Fatalf("invalid expectation %s: %v", want, err)
+	}
+
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
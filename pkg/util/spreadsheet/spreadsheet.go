@@ -0,0 +1,83 @@
+// Package spreadsheet reads tabular uploads from CSV and XLSX files.
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported spreadsheet format, expected .csv or .xlsx")
+	ErrInvalidFile       = errors.New("invalid or empty spreadsheet")
+)
+
+// Read returns the rows of a CSV file or of the first sheet of an XLSX
+// workbook, the format is chosen from the file extension. Cells are trimmed
+// and fully blank rows are kept so row numbers match what the user sees.
+func Read(filename string, data []byte) ([][]string, error) {
+	var (
+		rows [][]string
+		err  error
+	)
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		rows, err = readCSV(data)
+	case ".xlsx":
+		rows, err = readXLSX(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if err != nil || len(rows) == 0 {
+		return nil, ErrInvalidFile
+	}
+
+	for _, row := range rows {
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+	}
+
+	return rows, nil
+}
+
+// IsBlank reports whether every cell of a row is empty
+func IsBlank(row []string) bool {
+	for _, cell := range row {
+		if cell != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	// Spreadsheet applications often prepend a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+
+	return reader.ReadAll()
+}
+
+func readXLSX(data []byte) ([][]string, error) {
+	file, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, ErrInvalidFile
+	}
+
+	return file.GetRows(sheets[0])
+}
@@ -0,0 +1,149 @@
+package spreadsheet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want [][]string
+	}{
+		{
+			name: "header and rows",
+			data: "email,role\njane@example.com,user\njohn@example.com,admin\n",
+			want: [][]string{{"email", "role"}, {"jane@example.com", "user"}, {"john@example.com", "admin"}},
+		},
+		{
+			name: "byte order mark",
+			data: "\xef\xbb\xbfemail,role\njane@example.com,user\n",
+			want: [][]string{{"email", "role"}, {"jane@example.com", "user"}},
+		},
+		{
+			name: "cells are trimmed",
+			data: " email , role \n  jane@example.com ,user\n",
+			want: [][]string{{"email", "role"}, {"jane@example.com", "user"}},
+		},
+		{
+			name: "rows of different lengths",
+			data: "email,role,status\njane@example.com\n",
+			want: [][]string{{"email", "role", "status"}, {"jane@example.com"}},
+		},
+		{
+			name: "quoted cells",
+			data: "name,address\n\"Doe, Jane\",\"1 Main St\nApt 2\"\n",
+			want: [][]string{{"name", "address"}, {"Doe, Jane", "1 Main St\nApt 2"}},
+		},
+		{
+			name: "blank rows are kept",
+			data: "email\n,\njane@example.com\n",
+			want: [][]string{{"email"}, {"", ""}, {"jane@example.com"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read("users.csv", []byte(tt.data))
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		want     error
+	}{
+		{"unknown extension", "users.txt", "email\n", ErrUnsupportedFormat},
+		{"no extension", "users", "email\n", ErrUnsupportedFormat},
+		{"empty csv", "users.csv", "", ErrInvalidFile},
+		{"malformed csv", "users.csv", "email\n\"unterminated\n", ErrInvalidFile},
+		{"not a workbook", "users.xlsx", "email\n", ErrInvalidFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(tt.filename, []byte(tt.data)); err != tt.want {
+				t.Fatalf("Read() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	sheet := file.GetSheetName(0)
+	rows := [][]interface{}{
+		{"email", "role"},
+		{" jane@example.com ", "user"},
+		{"john@example.com", "admin"},
+	}
+
+	for i, row := range rows {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := file.SetSheetRow(sheet, cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the first sheet is read
+	if _, err := file.NewSheet("Other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.SetCellValue("Other", "A1", "ignored"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := file.WriteToBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The extension is matched case-insensitively
+	got, err := Read("Users.XLSX", buf.Bytes())
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	want := [][]string{{"email", "role"}, {"jane@example.com", "user"}, {"john@example.com", "admin"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %q, want %q", got, want)
+	}
+}
+
+func TestIsBlank(t *testing.T) {
+	tests := []struct {
+		row  []string
+		want bool
+	}{
+		{nil, true},
+		{[]string{}, true},
+		{[]string{"", ""}, true},
+		{[]string{"", "a"}, false},
+		{[]string{"a"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsBlank(tt.row); got != tt.want {
+			t.Errorf("IsBlank(%q) = %v, want %v", tt.row, got, tt.want)
+		}
+	}
+}
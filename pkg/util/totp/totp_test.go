@@ -0,0 +1,122 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := GenerateCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateCode(%d): %v", tt.unix, err)
+		}
+
+		if code != tt.code {
+			t.Errorf("GenerateCode(%d) = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestGenerateCodeInvalidSecret(t *testing.T) {
+	if _, err := GenerateCode("not base32!", time.Now()); err == nil {
+		t.Fatal("expected an error for an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	code, err := GenerateCode(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		want   bool
+	}{
+		{"current step", rfcSecret, code, now, true},
+		{"previous step", rfcSecret, code, now.Add(Period), true},
+		{"next step", rfcSecret, code, now.Add(-Period), true},
+		{"two steps late", rfcSecret, code, now.Add(2 * Period), false},
+		{"two steps early", rfcSecret, code, now.Add(-2 * Period), false},
+		{"surrounding spaces", rfcSecret, " " + code + " ", now, true},
+		{"lower case secret", strings.ToLower(rfcSecret), code, now, true},
+		{"wrong code", rfcSecret, "000000", now, false},
+		{"too short", rfcSecret, code[:5], now, false},
+		{"too long", rfcSecret, code + "0", now, false},
+		{"empty", rfcSecret, "", now, false},
+		{"invalid secret", "not base32!", code, now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Validate(tt.secret, tt.code, tt.at); got != tt.want {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 20 random bytes are 32 base32 characters without padding
+	if len(secret) != 32 {
+		t.Fatalf("len(secret) = %d, want 32", len(secret))
+	}
+
+	if _, err := GenerateCode(secret, time.Now()); err != nil {
+		t.Fatalf("generated secret is not usable: %v", err)
+	}
+
+	other, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret == other {
+		t.Fatal("two secrets are equal")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Task", "jane@example.com", rfcSecret)
+
+	for _, part := range []string{
+		"otpauth://totp/Task:jane@example.com?",
+		"secret=" + rfcSecret,
+		"issuer=Task",
+		"digits=6",
+		"period=30",
+		"algorithm=SHA1",
+	} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("URI() = %s, missing %s", uri, part)
+		}
+	}
+}